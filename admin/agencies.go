@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	pb "github.com/wallaceicy06/muni-sign/proto"
+)
+
+// How long before the agency list expires it is refreshed in the background.
+const agencyRefreshMargin = time.Hour
+
+// How long to wait before trying again when refreshing the agency list fails.
+const agencyRetryDelay = time.Minute
+
+// How long to wait for the nextbus server to list the agencies.
+const agencyTimeout = 10 * time.Second
+
+// agencyCache holds the list of agencies offered in the configuration form,
+// which rarely changes. It is safe for concurrent use.
+type agencyCache struct {
+	nbClient pb.NextbusClient
+
+	mu          sync.Mutex
+	agencies    []*pb.Agency
+	lastRefresh time.Time
+	lastAttempt time.Time
+	lastErr     error
+	// The refresh in progress, if any. Every caller that wants the list
+	// refreshed joins it rather than starting another.
+	inFlight *agencyRefresh
+	// Where the agency list is saved so that it survives restarts, or empty
+	// to keep it only in memory.
+	path string
+}
+
+// agencyRefresh is a fetch of the agency list from the nextbus server. Its
+// error is set before done is closed.
+type agencyRefresh struct {
+	done chan struct{}
+	err  error
+}
+
+// The format of the file that the agency list is saved to.
+type agencyCacheFile struct {
+	Agencies    []*pb.Agency `json:"agencies"`
+	LastRefresh time.Time    `json:"last_refresh"`
+}
+
+func newAgencyCache(nbClient pb.NextbusClient) *agencyCache {
+	return &agencyCache{nbClient: nbClient}
+}
+
+// persist saves the agency list to the file at path whenever it is refreshed,
+// and loads the list saved there by a previous run, if any. That way agencies
+// can be chosen even if the nextbus server is down when the admin server
+// starts.
+func (c *agencyCache) persist(path string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.path = path
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading agency cache: %v", err)
+	}
+	f := &agencyCacheFile{}
+	if err := json.Unmarshal(data, f); err != nil {
+		return fmt.Errorf("error parsing agency cache: %v", err)
+	}
+	c.agencies = f.Agencies
+	c.lastRefresh = f.LastRefresh
+	return nil
+}
+
+// get returns the cached agencies without waiting for the nextbus server. An
+// empty or expired list is returned as is while it is refreshed in the
+// background, at most one refresh at a time, and no sooner than
+// agencyRetryDelay after a failed one.
+func (c *agencyCache) get() []*pb.Agency {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := timeNow()
+	stale := len(c.agencies) == 0 || now.Sub(c.lastRefresh) > cacheTimeout
+	retrying := c.lastErr != nil && now.Sub(c.lastAttempt) < agencyRetryDelay
+	if stale && !retrying {
+		c.startRefresh(now)
+	}
+	return c.agencies
+}
+
+// status returns the cached agencies, when they were last refreshed and the
+// error from the last attempt to refresh them, if it failed.
+func (c *agencyCache) status() (agencies []*pb.Agency, lastRefresh time.Time, lastErr error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.agencies, c.lastRefresh, c.lastErr
+}
+
+// refresh fetches the agency list from the nextbus server, or waits for the
+// refresh in progress if there is one. If that fails, the cached list is kept.
+func (c *agencyCache) refresh() error {
+	c.mu.Lock()
+	r := c.startRefresh(timeNow())
+	c.mu.Unlock()
+	<-r.done
+	return r.err
+}
+
+// startRefresh returns the refresh in progress, or starts one recorded as made
+// at now if there is none. The caller must hold c.mu.
+func (c *agencyCache) startRefresh(now time.Time) *agencyRefresh {
+	if c.inFlight != nil {
+		return c.inFlight
+	}
+	r := &agencyRefresh{done: make(chan struct{})}
+	c.inFlight = r
+	go func() {
+		r.err = c.fetch(now)
+		if r.err != nil {
+			log.Printf("Error refreshing agencies: %v", r.err)
+		}
+		c.mu.Lock()
+		c.inFlight = nil
+		c.mu.Unlock()
+		close(r.done)
+	}()
+	return r
+}
+
+// fetch fetches the agency list from the nextbus server and records the
+// attempt as made at now.
+func (c *agencyCache) fetch(now time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), agencyTimeout)
+	defer cancel()
+	res, err := c.nbClient.ListAgencies(ctx, &pb.ListAgenciesRequest{})
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastAttempt, c.lastErr = now, err
+	if err != nil {
+		return err
+	}
+	c.agencies = res.GetAgencies()
+	c.lastRefresh = c.lastAttempt
+	if c.path != "" {
+		if err := c.save(); err != nil {
+			log.Printf("Error saving agency cache: %v", err)
+		}
+	}
+	return nil
+}
+
+// save writes the agency list to c.path. The caller must hold c.mu.
+func (c *agencyCache) save() error {
+	data, err := json.Marshal(&agencyCacheFile{Agencies: c.agencies, LastRefresh: c.lastRefresh})
+	if err != nil {
+		return err
+	}
+	tmpPath := c.path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, c.path)
+}
+
+// nextRefresh returns how long to wait before the agency list should be
+// refreshed in the background.
+func (c *agencyCache) nextRefresh() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	due := c.lastRefresh.Add(cacheTimeout - agencyRefreshMargin)
+	if retry := c.lastAttempt.Add(agencyRetryDelay); c.lastErr != nil && retry.After(due) {
+		due = retry
+	}
+	if wait := due.Sub(timeNow()); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// run refreshes the agency list shortly before it expires, so that requests
+// never have to wait for it, until done is closed.
+func (c *agencyCache) run(done <-chan struct{}) {
+	for {
+		t := time.NewTimer(c.nextRefresh())
+		select {
+		case <-t.C:
+			// A failed refresh is logged, and retried after agencyRetryDelay.
+			c.refresh()
+		case <-done:
+			t.Stop()
+			return
+		}
+	}
+}
+
+type agenciesResponse struct {
+	Agencies    []*pb.Agency `json:"agencies"`
+	LastRefresh time.Time    `json:"last_refresh"`
+	// Why the last attempt to refresh the agencies failed, if it did.
+	LastError string `json:"last_error,omitempty"`
+}
+
+// apiAgenciesHandler serves the cached agency list. With refresh=1, the list
+// is fetched from the nextbus server first, unless a refresh is already in
+// progress, in which case that one is waited for.
+func (s *server) apiAgenciesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, fmt.Sprintf("Unsupported method: %s.", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+
+	if isTrue(r.FormValue("refresh")) {
+		if err := s.agencies.refresh(); err != nil {
+			http.Error(w, fmt.Sprintf("Error refreshing agencies: %v", err), http.StatusBadGateway)
+			return
+		}
+	}
+
+	// Refresh a stale list in the background for later requests.
+	s.agencies.get()
+	agencies, lastRefresh, lastErr := s.agencies.status()
+	res := &agenciesResponse{Agencies: agencies, LastRefresh: lastRefresh}
+	if lastErr != nil {
+		res.LastError = lastErr.Error()
+	}
+	writeJSON(w, res)
+}
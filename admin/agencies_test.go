@@ -0,0 +1,324 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/wallaceicy06/muni-sign/proto"
+)
+
+var cachedAgencies = []*pb.Agency{{Name: "Los Angeles Metro", Tag: "la-metro"}}
+
+func agenciesEqual(a, b []*pb.Agency) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !proto.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestAgencyCacheGet(t *testing.T) {
+	defer func() { timeNow = time.Now }()
+	lastRefresh := time.Now()
+
+	tests := []struct {
+		name      string
+		cached    []*pb.Agency
+		timeNow   time.Time
+		lastErr   error
+		fakeNb    *fakeNbClient
+		want      []*pb.Agency
+		wantFinal []*pb.Agency
+		wantCalls int32
+	}{
+		{
+			// An empty list is also refreshed in the background, so that
+			// requests never wait for the nextbus server.
+			name:      "Empty",
+			timeNow:   lastRefresh,
+			fakeNb:    &fakeNbClient{agenciesRes: goodFakeNb.agenciesRes},
+			want:      nil,
+			wantFinal: goodFakeNb.agenciesRes.Agencies,
+			wantCalls: 1,
+		},
+		{
+			name:      "EmptyError",
+			timeNow:   lastRefresh,
+			fakeNb:    &fakeNbClient{agenciesErr: errors.New("fake list agencies error")},
+			want:      nil,
+			wantCalls: 1,
+		},
+		{
+			name:      "Fresh",
+			cached:    cachedAgencies,
+			timeNow:   lastRefresh.Add(cacheTimeout - time.Second),
+			fakeNb:    &fakeNbClient{agenciesRes: goodFakeNb.agenciesRes},
+			want:      cachedAgencies,
+			wantFinal: cachedAgencies,
+			wantCalls: 0,
+		},
+		{
+			// An expired list is served while it is refreshed in the
+			// background.
+			name:      "Expired",
+			cached:    cachedAgencies,
+			timeNow:   lastRefresh.Add(cacheTimeout + time.Second),
+			fakeNb:    &fakeNbClient{agenciesRes: goodFakeNb.agenciesRes},
+			want:      cachedAgencies,
+			wantFinal: goodFakeNb.agenciesRes.Agencies,
+			wantCalls: 1,
+		},
+		{
+			name:      "ExpiredError",
+			cached:    cachedAgencies,
+			timeNow:   lastRefresh.Add(cacheTimeout + time.Second),
+			fakeNb:    &fakeNbClient{agenciesErr: errors.New("fake list agencies error")},
+			want:      cachedAgencies,
+			wantFinal: cachedAgencies,
+			wantCalls: 1,
+		},
+		{
+			// A refresh that just failed is not retried until
+			// agencyRetryDelay has passed.
+			name:      "ExpiredRecentError",
+			cached:    cachedAgencies,
+			timeNow:   lastRefresh.Add(cacheTimeout + time.Second),
+			lastErr:   errors.New("fake list agencies error"),
+			fakeNb:    &fakeNbClient{agenciesRes: goodFakeNb.agenciesRes},
+			want:      cachedAgencies,
+			wantFinal: cachedAgencies,
+			wantCalls: 0,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := newAgencyCache(test.fakeNb)
+			c.agencies, c.lastRefresh = test.cached, lastRefresh
+			if test.lastErr != nil {
+				c.lastAttempt, c.lastErr = test.timeNow, test.lastErr
+			}
+			timeNow = func() time.Time { return test.timeNow }
+
+			if got := c.get(); !agenciesEqual(got, test.want) {
+				t.Errorf("c.get() = %v want %v", got, test.want)
+			}
+			// Requests made while the list is being refreshed do not start
+			// refreshes of their own.
+			for i := 0; i < 10; i++ {
+				c.get()
+			}
+
+			deadline := time.Now().Add(time.Second)
+			for atomic.LoadInt32(&test.fakeNb.agenciesCalls) < test.wantCalls && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+			if got := atomic.LoadInt32(&test.fakeNb.agenciesCalls); got != test.wantCalls {
+				t.Errorf("ListAgencies called %d times want %d", got, test.wantCalls)
+			}
+			// Wait for a background refresh to finish updating the cache.
+			for time.Now().Before(deadline) {
+				c.mu.Lock()
+				done := c.inFlight == nil
+				c.mu.Unlock()
+				if done {
+					break
+				}
+				time.Sleep(time.Millisecond)
+			}
+			c.mu.Lock()
+			got := c.agencies
+			c.mu.Unlock()
+			if !agenciesEqual(got, test.wantFinal) {
+				t.Errorf("cached agencies = %v want %v", got, test.wantFinal)
+			}
+		})
+	}
+}
+
+func TestAgencyCacheNextRefresh(t *testing.T) {
+	defer func() { timeNow = time.Now }()
+	now := time.Now()
+	timeNow = func() time.Time { return now }
+
+	tests := []struct {
+		name        string
+		lastRefresh time.Time
+		lastAttempt time.Time
+		lastErr     error
+		want        time.Duration
+	}{
+		{
+			name:        "Fresh",
+			lastRefresh: now,
+			lastAttempt: now,
+			want:        cacheTimeout - agencyRefreshMargin,
+		},
+		{
+			name:        "NearExpiry",
+			lastRefresh: now.Add(-cacheTimeout + agencyRefreshMargin/2),
+			lastAttempt: now.Add(-cacheTimeout + agencyRefreshMargin/2),
+			want:        0,
+		},
+		{
+			name: "NeverRefreshed",
+			want: 0,
+		},
+		{
+			name:        "RecentFailure",
+			lastAttempt: now.Add(-time.Second),
+			lastErr:     errors.New("fake list agencies error"),
+			want:        agencyRetryDelay - time.Second,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := newAgencyCache(goodFakeNb)
+			c.lastRefresh, c.lastAttempt, c.lastErr = test.lastRefresh, test.lastAttempt, test.lastErr
+			if got := c.nextRefresh(); got != test.want {
+				t.Errorf("c.nextRefresh() = %v want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestAgencyCacheOneRefreshAtATime(t *testing.T) {
+	fakeNb := &fakeNbClient{agenciesRes: goodFakeNb.agenciesRes, agenciesBlock: make(chan struct{})}
+	c := newAgencyCache(fakeNb)
+
+	// Refreshes asked for by get, run and ?refresh=1 while one is in progress
+	// all wait for that one.
+	c.get()
+	errs := make(chan error)
+	for i := 0; i < 10; i++ {
+		go func() { errs <- c.refresh() }()
+	}
+	c.get()
+	// Give the refreshes time to join the one in progress.
+	time.Sleep(50 * time.Millisecond)
+	close(fakeNb.agenciesBlock)
+
+	for i := 0; i < 10; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("c.refresh() = %v want <nil>", err)
+		}
+	}
+	if got := atomic.LoadInt32(&fakeNb.agenciesCalls); got != 1 {
+		t.Errorf("ListAgencies called %d times want 1", got)
+	}
+	if got, want := c.get(), goodFakeNb.agenciesRes.Agencies; !agenciesEqual(got, want) {
+		t.Errorf("c.get() after refresh = %v want %v", got, want)
+	}
+}
+
+func TestAgencyCachePersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "admin")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "agencies.json")
+
+	c := newAgencyCache(goodFakeNb)
+	if err := c.persist(path); err != nil {
+		t.Fatalf("c.persist() with no saved file = %v want <nil>", err)
+	}
+	if err := c.refresh(); err != nil {
+		t.Fatalf("c.refresh() = %v want <nil>", err)
+	}
+
+	// After a restart, the saved list is used while the nextbus server is
+	// down.
+	downNb := &fakeNbClient{agenciesErr: errors.New("fake list agencies error")}
+	c = newAgencyCache(downNb)
+	if err := c.persist(path); err != nil {
+		t.Fatalf("c.persist() = %v want <nil>", err)
+	}
+	if got, want := c.get(), goodFakeNb.agenciesRes.Agencies; !agenciesEqual(got, want) {
+		t.Errorf("c.get() after restart = %v want %v", got, want)
+	}
+}
+
+func TestApiAgencies(t *testing.T) {
+	tests := []struct {
+		name      string
+		url       string
+		fakeNb    *fakeNbClient
+		lastErr   error
+		wantCode  int
+		want      []*pb.Agency
+		wantError string
+	}{
+		{
+			name:     "Cached",
+			url:      "/api/agencies",
+			fakeNb:   &fakeNbClient{agenciesRes: goodFakeNb.agenciesRes},
+			wantCode: http.StatusOK,
+			want:     cachedAgencies,
+		},
+		{
+			name:      "CachedAfterError",
+			url:       "/api/agencies",
+			fakeNb:    &fakeNbClient{agenciesRes: goodFakeNb.agenciesRes},
+			lastErr:   errors.New("fake list agencies error"),
+			wantCode:  http.StatusOK,
+			want:      cachedAgencies,
+			wantError: "fake list agencies error",
+		},
+		{
+			name:     "Refresh",
+			url:      "/api/agencies?refresh=1",
+			fakeNb:   &fakeNbClient{agenciesRes: goodFakeNb.agenciesRes},
+			wantCode: http.StatusOK,
+			want:     goodFakeNb.agenciesRes.Agencies,
+		},
+		{
+			name:     "RefreshError",
+			url:      "/api/agencies?refresh=1",
+			fakeNb:   &fakeNbClient{agenciesErr: errors.New("fake list agencies error")},
+			wantCode: http.StatusBadGateway,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srv := newServer(testPort, test.fakeNb, &fakeConfig{}, testUsers)
+			srv.agencies.agencies, srv.agencies.lastRefresh = cachedAgencies, time.Now()
+			srv.agencies.lastAttempt, srv.agencies.lastErr = time.Now(), test.lastErr
+
+			rec := httptest.NewRecorder()
+			srv.apiAgenciesHandler(rec, httptest.NewRequest(http.MethodGet, test.url, nil))
+			if rec.Code != test.wantCode {
+				t.Fatalf("got code %d want %d", rec.Code, test.wantCode)
+			}
+			if test.wantCode != http.StatusOK {
+				return
+			}
+			got := &agenciesResponse{}
+			if err := json.NewDecoder(rec.Body).Decode(got); err != nil {
+				t.Fatalf("error unmarshaling JSON response: %v", err)
+			}
+			if !agenciesEqual(got.Agencies, test.want) {
+				t.Errorf("got agencies %v want %v", got.Agencies, test.want)
+			}
+			if got.LastError != test.wantError {
+				t.Errorf("got last error %q want %q", got.LastError, test.wantError)
+			}
+		})
+	}
+}
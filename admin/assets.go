@@ -0,0 +1,95 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"path"
+)
+
+// The templates and static files are built into the binary, so that the admin
+// server works no matter which directory it is started from.
+//
+//go:embed templates public
+var embeddedAssets embed.FS
+
+// pageTemplates lists the template files that make up each page, relative to
+// the templates directory. Every page is rendered through the layout in
+// index.html.
+var pageTemplates = map[string][]string{
+	"home":     {"index.html", "account.html", "home.html"},
+	"sign":     {"index.html", "account.html", "config_form.html", "sign.html"},
+	"conflict": {"index.html", "account.html", "config_form.html", "conflict.html"},
+	"login":    {"index.html", "login.html"},
+	"status":   {"index.html", "account.html", "status.html"},
+	"audit":    {"index.html", "account.html", "audit.html"},
+	"emulator": {"index.html", "account.html", "emulator.html"},
+}
+
+// assets holds the page templates and static files served by the admin server.
+type assets struct {
+	fsys      fs.FS
+	templates map[string]*template.Template
+	// If set, templates are parsed again every time a page is rendered, so
+	// that edits show up without restarting the server.
+	reload bool
+}
+
+// loadAssets parses the templates in the templates directory of fsys and
+// serves the static files in its public directory.
+func loadAssets(fsys fs.FS, reload bool) (*assets, error) {
+	a := &assets{
+		fsys:      fsys,
+		templates: make(map[string]*template.Template),
+		reload:    reload,
+	}
+	for name := range pageTemplates {
+		t, err := a.parse(name)
+		if err != nil {
+			return nil, err
+		}
+		a.templates[name] = t
+	}
+	return a, nil
+}
+
+func (a *assets) parse(name string) (*template.Template, error) {
+	var files []string
+	for _, f := range pageTemplates[name] {
+		files = append(files, path.Join("templates", f))
+	}
+	t, err := template.ParseFS(a.fsys, files...)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s page: %v", name, err)
+	}
+	return t, nil
+}
+
+// page returns the template for the named page.
+func (a *assets) page(name string) (*template.Template, error) {
+	if a.reload {
+		return a.parse(name)
+	}
+	return a.templates[name], nil
+}
+
+// static serves the files in the public directory.
+func (a *assets) static() http.Handler {
+	public, err := fs.Sub(a.fsys, "public")
+	if err != nil {
+		// fs.Sub only fails for invalid directory names.
+		panic(err)
+	}
+	return http.FileServer(http.FS(public))
+}
+
+// builtinAssets returns the assets built into the binary.
+func builtinAssets() *assets {
+	a, err := loadAssets(embeddedAssets, false)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
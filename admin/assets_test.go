@@ -0,0 +1,80 @@
+package main
+
+import (
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStaticFiles(t *testing.T) {
+	srv := newServer(testPort, goodFakeNb, newFakeConfig(testConfig, ""), testUsers)
+
+	// Static files are built into the binary and do not require signing in.
+	rec := httptest.NewRecorder()
+	srv.handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/public/css/styles.css", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("GET /public/css/styles.css got code %d want %d", rec.Code, http.StatusOK)
+	}
+	if !strings.Contains(rec.Body.String(), "font-family") {
+		t.Errorf("GET /public/css/styles.css got %q want the stylesheet", rec.Body)
+	}
+}
+
+func TestAssetsDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "admin")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Copy the built in assets, so that the login page can be changed.
+	err = fs.WalkDir(embeddedAssets, ".", func(f string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return os.MkdirAll(filepath.Join(dir, f), 0755)
+		}
+		data, err := embeddedAssets.ReadFile(f)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(filepath.Join(dir, f), data, 0644)
+	})
+	if err != nil {
+		t.Fatalf("error copying built in assets: %v", err)
+	}
+
+	srv := newServer(testPort, goodFakeNb, newFakeConfig(testConfig, ""), testUsers)
+	if srv.assets, err = loadAssets(os.DirFS(dir), true); err != nil {
+		t.Fatalf("loadAssets() = _, %v want _, <nil>", err)
+	}
+
+	login := `{{ define "index-content" }}Edited login page{{ end }}`
+	if err := ioutil.WriteFile(filepath.Join(dir, "templates/login.html"), []byte(login), 0644); err != nil {
+		t.Fatalf("error writing login.html: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	srv.handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/login", nil))
+	if !strings.Contains(rec.Body.String(), "Edited login page") {
+		t.Errorf("GET /login did not pick up the edited template, got %q", rec.Body)
+	}
+}
+
+func TestLoadAssetsMissing(t *testing.T) {
+	dir, err := ioutil.TempDir("", "admin")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if _, err := loadAssets(os.DirFS(dir), true); err == nil {
+		t.Errorf("loadAssets() of empty directory = _, <nil> want _, <non-nil>")
+	}
+}
@@ -0,0 +1,487 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/wallaceicy06/muni-sign/admin/config"
+	pb "github.com/wallaceicy06/muni-sign/proto"
+)
+
+// How many audit entries are returned at a time, unless the request asks for
+// a different number up to maxAuditPageSize.
+const (
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 500
+)
+
+// How many of the latest audit entries are kept in memory. Older entries are
+// read back from the file when a page needs them, or dropped if the log is
+// only kept in memory.
+var auditMemoryLimit = 1000
+
+// The kinds of change recorded in the audit log.
+const (
+	auditCreate      = "create"
+	auditRename      = "rename"
+	auditDelete      = "delete"
+	auditUpdate      = "update"
+	auditImport      = "import"
+	auditLogin       = "login"
+	auditLoginFailed = "login_failed"
+	auditPassword    = "password"
+)
+
+// auditEntry records a change made through the admin server, or an attempt to
+// sign in.
+type auditEntry struct {
+	// Entries are numbered from 1 in the order they were recorded.
+	ID   int64     `json:"id"`
+	Time time.Time `json:"time"`
+	// The user who made the change, or who tried to sign in.
+	User       string `json:"user,omitempty"`
+	RemoteAddr string `json:"remote_addr,omitempty"`
+	Action     string `json:"action"`
+	Sign       string `json:"sign,omitempty"`
+	// The revision of the configuration stored by an update.
+	Revision string `json:"revision,omitempty"`
+	// The lines of the configuration removed by an update, starting with
+	// "-", and added by it, starting with "+".
+	Diff []string `json:"diff,omitempty"`
+	// Anything else worth knowing, such as the new name of a renamed sign.
+	Detail string `json:"detail,omitempty"`
+}
+
+// auditLog is an append-only record of changes. The latest entries are kept
+// in memory and, once persist is called, every entry is appended to a file as
+// a line of JSON. It is safe for concurrent use.
+type auditLog struct {
+	mu sync.Mutex
+	// The latest entries, at most auditMemoryLimit of them, oldest first.
+	entries []*auditEntry
+	// How many entries have been recorded, which is the ID of the latest.
+	count int64
+	// The file that entries are appended to, or nil to only keep them in
+	// memory, and its path, from which older entries are read.
+	file *os.File
+	path string
+}
+
+func newAuditLog() *auditLog {
+	return &auditLog{}
+}
+
+// persist appends every entry to the file at path, after loading the latest
+// entries recorded there by previous runs. Entries recorded before persist is
+// called are numbered after the loaded ones and appended too.
+func (l *auditLog) persist(path string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("error opening audit log: %v", err)
+	}
+	var entries []*auditEntry
+	var count int64
+	err = scanAuditLog(f, func(e *auditEntry) bool {
+		entries = keepLatest(append(entries, e), auditMemoryLimit)
+		count = e.ID
+		return true
+	})
+	if err != nil {
+		f.Close()
+		return err
+	}
+	for _, e := range l.entries {
+		count++
+		e.ID = count
+		if err := writeAuditEntry(f, e); err != nil {
+			f.Close()
+			return fmt.Errorf("error writing audit log: %v", err)
+		}
+		entries = keepLatest(append(entries, e), auditMemoryLimit)
+	}
+	l.entries, l.count, l.file, l.path = entries, count, f, path
+	return nil
+}
+
+// scanAuditLog calls fn with each entry of an audit log file, numbered by its
+// line, until fn returns false.
+func scanAuditLog(r io.Reader, fn func(*auditEntry) bool) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	var id int64
+	for scanner.Scan() {
+		id++
+		e := &auditEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), e); err != nil {
+			return fmt.Errorf("error parsing audit log entry %d: %v", id, err)
+		}
+		e.ID = id
+		if !fn(e) {
+			return nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading audit log: %v", err)
+	}
+	return nil
+}
+
+func writeAuditEntry(w io.Writer, e *auditEntry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// keepLatest returns the last n entries.
+func keepLatest(entries []*auditEntry, n int) []*auditEntry {
+	if len(entries) > n {
+		return entries[len(entries)-n:]
+	}
+	return entries
+}
+
+// record stamps an entry with its ID and the current time and adds it to the
+// log. Entries that cannot be written to the file are still kept in memory.
+func (l *auditLog) record(e *auditEntry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.count++
+	e.ID = l.count
+	e.Time = timeNow()
+	l.entries = keepLatest(append(l.entries, e), auditMemoryLimit)
+	if l.file == nil {
+		return
+	}
+	if err := writeAuditEntry(l.file, e); err != nil {
+		log.Printf("Error writing audit log: %v", err)
+	}
+}
+
+// page returns up to limit entries recorded before the one with the given ID,
+// or the latest ones if before is 0, newest first. If sign is not empty, only
+// entries about that sign are returned. The returned ID is the before of the
+// next page, or 0 if there are no more entries.
+func (l *auditLog) page(before int64, limit int, sign string) ([]*auditEntry, int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if before <= 0 || before > l.count {
+		before = l.count + 1
+	}
+
+	// Find one entry more than asked for, to tell whether there is another
+	// page.
+	var entries []*auditEntry
+	first := l.count - int64(len(l.entries)) + 1
+	for i := int(before-first) - 1; i >= 0 && len(entries) <= limit; i-- {
+		if e := l.entries[i]; sign == "" || e.Sign == sign {
+			entries = append(entries, e)
+		}
+	}
+	if len(entries) <= limit && first > 1 && l.path != "" {
+		if before > first {
+			before = first
+		}
+		older, err := l.readOlder(before, limit+1-len(entries), sign)
+		if err != nil {
+			log.Printf("Error reading audit log: %v", err)
+		}
+		entries = append(entries, older...)
+	}
+	if len(entries) > limit {
+		return entries[:limit], entries[limit-1].ID
+	}
+	return entries, 0
+}
+
+// readOlder reads up to n entries recorded before the one with the given ID
+// from the file, newest first. If sign is not empty, only entries about that
+// sign are returned.
+func (l *auditLog) readOlder(before int64, n int, sign string) ([]*auditEntry, error) {
+	f, err := os.Open(l.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []*auditEntry
+	err = scanAuditLog(f, func(e *auditEntry) bool {
+		if e.ID >= before {
+			return false
+		}
+		if sign == "" || e.Sign == sign {
+			entries = keepLatest(append(entries, e), n)
+		}
+		return true
+	})
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	return entries, err
+}
+
+func (l *auditLog) close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	return l.file.Close()
+}
+
+// remoteHost returns the address of the client that made a request, without
+// its port.
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// auditedConfig records every change made through it in the audit log, on
+// behalf of the user who made a request.
+type auditedConfig struct {
+	config.SignConfig
+	log        *auditLog
+	user, addr string
+}
+
+// configFor returns the configuration of the signs, recording the changes
+// made to it in the audit log as the user who made the request.
+func (s *server) configFor(r *http.Request) config.SignConfig {
+	return &auditedConfig{s.cfg, s.audit, requestUser(r), remoteHost(r)}
+}
+
+func (c *auditedConfig) record(action, id string, e *auditEntry) {
+	e.User, e.RemoteAddr, e.Action, e.Sign = c.user, c.addr, action, id
+	c.log.record(e)
+}
+
+func (c *auditedConfig) Create(id, name string) error {
+	if err := c.SignConfig.Create(id, name); err != nil {
+		return err
+	}
+	c.record(auditCreate, id, &auditEntry{Detail: name})
+	return nil
+}
+
+func (c *auditedConfig) Rename(id, name string) error {
+	if err := c.SignConfig.Rename(id, name); err != nil {
+		return err
+	}
+	c.record(auditRename, id, &auditEntry{Detail: name})
+	return nil
+}
+
+func (c *auditedConfig) Delete(id string) error {
+	before, _, _ := c.SignConfig.Get(id)
+	if err := c.SignConfig.Delete(id); err != nil {
+		return err
+	}
+	c.record(auditDelete, id, &auditEntry{Diff: diffConfigs(before, nil)})
+	return nil
+}
+
+// RestoreRevisions restores the revision history of a sign if the underlying
+// configuration keeps one. It is not recorded, since restoring the sign itself
+// is.
+func (c *auditedConfig) RestoreRevisions(id string, revs []*pb.ConfigurationRevision) error {
+	if hr, ok := c.SignConfig.(config.HistoryRestorer); ok {
+		return hr.RestoreRevisions(id, revs)
+	}
+	return nil
+}
+
+// Put records the difference between the configuration that it replaced and
+// the one that it stored. So that no other change can slip in between reading
+// the old configuration and storing the new one, the configuration is only
+// stored if it is still at the revision that was read. A Put without a
+// revision reads it again and retries when that fails.
+func (c *auditedConfig) Put(id string, cfg *pb.Configuration, rev string) (string, error) {
+	// The backend stores cfg upgraded to the current schema.
+	after, err := config.Migrate(cfg)
+	if err != nil {
+		return "", err
+	}
+	for {
+		before, currentRev, err := c.SignConfig.Get(id)
+		if err != nil {
+			return "", err
+		}
+		putRev := rev
+		if putRev == "" {
+			putRev = currentRev
+		}
+		newRev, err := c.SignConfig.Put(id, cfg, putRev)
+		if err == config.ErrConflict && rev == "" {
+			continue
+		}
+		if err != nil {
+			return newRev, err
+		}
+		c.record(auditUpdate, id, &auditEntry{Revision: newRev, Diff: diffConfigs(before, after)})
+		return newRev, nil
+	}
+}
+
+// diffConfigs describes how a configuration changed as the top-level fields
+// that were removed, starting with "-", and added, starting with "+". Either
+// configuration may be nil.
+func diffConfigs(before, after *pb.Configuration) []string {
+	a, b := configFields(before), configFields(after)
+
+	// Find the longest common subsequence of fields, so that fields that
+	// stayed put are left out.
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var diff []string
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			diff = append(diff, "-"+a[i])
+			i++
+		default:
+			diff = append(diff, "+"+b[j])
+			j++
+		}
+	}
+	return diff
+}
+
+// configFields formats each top-level field of a configuration on its own
+// line, leaving out the schema version.
+func configFields(c *pb.Configuration) []string {
+	if c == nil {
+		return nil
+	}
+	c = proto.Clone(c).(*pb.Configuration)
+	c.SchemaVersion = 0
+
+	var fields []string
+	for _, line := range strings.Split(proto.MarshalTextString(c), "\n") {
+		if line == "" {
+			continue
+		}
+		// Lines of nested messages are indented, and belong to the field
+		// above them, as does the line that closes them.
+		if (strings.HasPrefix(line, " ") || line == ">") && len(fields) > 0 {
+			fields[len(fields)-1] += " " + strings.TrimSpace(line)
+			continue
+		}
+		fields = append(fields, line)
+	}
+	return fields
+}
+
+type auditTemplate struct {
+	Entries []*auditEntry
+	// The sign that the entries are limited to, if any.
+	Sign string
+	// The link to the next page of older entries, if any.
+	Older string
+	accountTemplate
+}
+
+// auditPage is a page of audit log entries served by apiAuditHandler.
+type auditPage struct {
+	Entries []*auditEntry `json:"entries"`
+	// The value of the before parameter that returns the next page, if there
+	// are more entries.
+	Next int64 `json:"next,omitempty"`
+}
+
+// parseAuditQuery reads the before, limit and sign parameters of a request
+// for audit log entries.
+func parseAuditQuery(r *http.Request) (before int64, limit int, sign string, err error) {
+	limit = defaultAuditPageSize
+	if v := r.FormValue("before"); v != "" {
+		if before, err = strconv.ParseInt(v, 10, 64); err != nil || before < 0 {
+			return 0, 0, "", fmt.Errorf("invalid before %q", v)
+		}
+	}
+	if v := r.FormValue("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit <= 0 || limit > maxAuditPageSize {
+			return 0, 0, "", fmt.Errorf("limit must be between 1 and %d", maxAuditPageSize)
+		}
+	}
+	return before, limit, r.FormValue("sign"), nil
+}
+
+// auditHandler serves the audit log page, which lists changes newest first.
+func (s *server) auditHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, fmt.Sprintf("Unsupported method: %s.", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+	before, limit, sign, err := parseAuditQuery(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid query: %v.", err), http.StatusBadRequest)
+		return
+	}
+	entries, next := s.audit.page(before, limit, sign)
+	t := &auditTemplate{Entries: entries, Sign: sign, accountTemplate: requestAccount(r)}
+	if next > 0 {
+		q := url.Values{"before": {strconv.FormatInt(next, 10)}}
+		if sign != "" {
+			q.Set("sign", sign)
+		}
+		t.Older = "/audit?" + q.Encode()
+	}
+	s.renderPage("audit", t, w)
+}
+
+// apiAuditHandler serves a page of the audit log as JSON, newest first. The
+// before, limit and sign parameters select the page.
+func (s *server) apiAuditHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, fmt.Sprintf("Unsupported method: %s.", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+	before, limit, sign, err := parseAuditQuery(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid query: %v.", err), http.StatusBadRequest)
+		return
+	}
+	entries, next := s.audit.page(before, limit, sign)
+	if entries == nil {
+		entries = []*auditEntry{}
+	}
+	writeJSON(w, &auditPage{Entries: entries, Next: next})
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/wallaceicy06/muni-sign/admin/config"
+	pb "github.com/wallaceicy06/muni-sign/proto"
+)
+
+func TestDiffConfigs(t *testing.T) {
+	tests := []struct {
+		name   string
+		before *pb.Configuration
+		after  *pb.Configuration
+		want   []string
+	}{
+		{
+			name:   "Same",
+			before: testConfig,
+			after:  testConfig,
+		},
+		{
+			name:   "ChangedStop",
+			before: testConfig,
+			after:  &pb.Configuration{Agency: "sf-muni", Stops: []*pb.Stop{{Id: "1234"}, {Id: "9012"}}},
+			want:   []string{`-stops: < id: "5678" >`, `+stops: < id: "9012" >`},
+		},
+		{
+			name:   "SchemaVersionIgnored",
+			before: &pb.Configuration{Agency: "sf-muni"},
+			after:  &pb.Configuration{SchemaVersion: 2, Agency: "actransit"},
+			want:   []string{`-agency: "sf-muni"`, `+agency: "actransit"`},
+		},
+		{
+			name:   "Deleted",
+			before: &pb.Configuration{Agency: "sf-muni"},
+			after:  nil,
+			want:   []string{`-agency: "sf-muni"`},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := diffConfigs(test.before, test.after); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("diffConfigs() = %q want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestAuditConfigChanges(t *testing.T) {
+	cfg := newFakeConfig(testConfig, "rev1")
+	srv := newServer(testPort, goodFakeNb, cfg, testUsers)
+	h := srv.handler()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer driver-token")
+		req.RemoteAddr = "192.0.2.1:1234"
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := do(http.MethodPut, "/api/signs/default/config", `{"agency": "sf-muni", "stops": [{"id": "9012"}]}`); rec.Code != http.StatusOK {
+		t.Fatalf("PUT config got code %d want %d", rec.Code, http.StatusOK)
+	}
+	if rec := do(http.MethodDelete, "/api/signs/default/override", ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("DELETE override got code %d want %d", rec.Code, http.StatusNoContent)
+	}
+	// Failed changes are not recorded.
+	if rec := do(http.MethodPut, "/api/signs/lobby/config", `{"agency": "sf-muni"}`); rec.Code != http.StatusNotFound {
+		t.Fatalf("PUT config of unknown sign got code %d want %d", rec.Code, http.StatusNotFound)
+	}
+
+	rec := do(http.MethodGet, "/api/audit", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /api/audit got code %d want %d", rec.Code, http.StatusOK)
+	}
+	page := &auditPage{}
+	if err := json.NewDecoder(rec.Body).Decode(page); err != nil {
+		t.Fatalf("error decoding audit page: %v", err)
+	}
+	if len(page.Entries) != 2 {
+		t.Fatalf("got %d audit entries want 2", len(page.Entries))
+	}
+	// Newest first.
+	override, update := page.Entries[0], page.Entries[1]
+	if update.User != "sean" || update.RemoteAddr != "192.0.2.1" || update.Action != auditUpdate || update.Sign != "default" {
+		t.Errorf("got entry %+v want an update of default by sean from 192.0.2.1", update)
+	}
+	if want := []string{`-stops: < id: "1234" >`, `-stops: < id: "5678" >`, `+stops: < id: "9012" >`}; !reflect.DeepEqual(update.Diff, want) {
+		t.Errorf("got diff %q want %q", update.Diff, want)
+	}
+	if override.Action != auditUpdate || len(override.Diff) != 0 {
+		t.Errorf("got entry %+v want an update without changes", override)
+	}
+}
+
+// racingConfig stores another configuration just before the first Put, as if
+// someone else changed the sign at the same time.
+type racingConfig struct {
+	*fakeConfig
+	other *pb.Configuration
+}
+
+func (rc *racingConfig) Put(id string, cfg *pb.Configuration, rev string) (string, error) {
+	if other := rc.other; other != nil {
+		rc.other = nil
+		rc.fakeConfig.Put(id, other, "")
+	}
+	return rc.fakeConfig.Put(id, cfg, rev)
+}
+
+func TestAuditPutConcurrentChange(t *testing.T) {
+	other := &pb.Configuration{Agency: "actransit"}
+	cfg := &racingConfig{newFakeConfig(testConfig, config.Revision(testConfig)), other}
+	l := newAuditLog()
+	ac := &auditedConfig{cfg, l, "sean", "192.0.2.1"}
+
+	// The diff is against the configuration that was actually replaced.
+	if _, err := ac.Put(config.DefaultSignID, &pb.Configuration{Agency: "sf-muni"}, ""); err != nil {
+		t.Fatalf("ac.Put() = %v want <nil>", err)
+	}
+	entries, _ := l.page(0, defaultAuditPageSize, "")
+	if len(entries) != 1 {
+		t.Fatalf("got %d audit entries want 1", len(entries))
+	}
+	if want := []string{`-agency: "actransit"`, `+agency: "sf-muni"`}; !reflect.DeepEqual(entries[0].Diff, want) {
+		t.Errorf("got diff %q want %q", entries[0].Diff, want)
+	}
+
+	// A Put with a revision is not retried.
+	cfg.other = other
+	if _, err := ac.Put(config.DefaultSignID, testConfig, config.Revision(&pb.Configuration{Agency: "sf-muni"})); err != config.ErrConflict {
+		t.Errorf("ac.Put() with a stale revision = %v want %v", err, config.ErrConflict)
+	}
+}
+
+func TestAuditLogin(t *testing.T) {
+	srv := newServer(testPort, goodFakeNb, newFakeConfig(testConfig, ""), testUsers)
+	for _, password := range []string{"wrong", "hunter2"} {
+		srv.loginHandler(httptest.NewRecorder(), newLoginRequest("username=sean&password="+password))
+	}
+
+	entries, _ := srv.audit.page(0, defaultAuditPageSize, "")
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.User+" "+e.Action)
+	}
+	if want := []string{"sean login", "sean login_failed"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got audit entries %q want %q", got, want)
+	}
+}
+
+func TestAuditPage(t *testing.T) {
+	l := newAuditLog()
+	for i := 0; i < 5; i++ {
+		l.record(&auditEntry{Action: auditUpdate, Sign: fmt.Sprintf("sign%d", i%2)})
+	}
+
+	tests := []struct {
+		name     string
+		before   int64
+		limit    int
+		sign     string
+		wantIDs  []int64
+		wantNext int64
+	}{
+		{name: "All", limit: 10, wantIDs: []int64{5, 4, 3, 2, 1}},
+		{name: "FirstPage", limit: 2, wantIDs: []int64{5, 4}, wantNext: 4},
+		{name: "SecondPage", before: 4, limit: 2, wantIDs: []int64{3, 2}, wantNext: 2},
+		{name: "LastPage", before: 2, limit: 2, wantIDs: []int64{1}},
+		{name: "Sign", limit: 2, sign: "sign0", wantIDs: []int64{5, 3}, wantNext: 3},
+		{name: "SignLastPage", before: 3, limit: 2, sign: "sign0", wantIDs: []int64{1}},
+		{name: "UnknownSign", limit: 2, sign: "lobby"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			entries, next := l.page(test.before, test.limit, test.sign)
+			var ids []int64
+			for _, e := range entries {
+				ids = append(ids, e.ID)
+			}
+			if !reflect.DeepEqual(ids, test.wantIDs) || next != test.wantNext {
+				t.Errorf("l.page(%d, %d, %q) = %v, %d want %v, %d", test.before, test.limit, test.sign, ids, next, test.wantIDs, test.wantNext)
+			}
+		})
+	}
+}
+
+func TestAuditLogPersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "admin")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.jsonl")
+
+	l := newAuditLog()
+	if err := l.persist(path); err != nil {
+		t.Fatalf("l.persist() with no saved file = %v want <nil>", err)
+	}
+	l.record(&auditEntry{User: "sean", Action: auditLogin})
+	l.record(&auditEntry{User: "sean", Action: auditRename, Sign: "lobby", Detail: "Front Lobby"})
+	l.close()
+
+	// After a restart, earlier entries are kept and new ones are numbered
+	// after them.
+	l = newAuditLog()
+	if err := l.persist(path); err != nil {
+		t.Fatalf("l.persist() = %v want <nil>", err)
+	}
+	l.record(&auditEntry{User: "sean", Action: auditDelete, Sign: "lobby"})
+	l.close()
+
+	entries, _ := l.page(0, defaultAuditPageSize, "")
+	var got []string
+	for _, e := range entries {
+		got = append(got, fmt.Sprintf("%d %s %s", e.ID, e.Action, e.Detail))
+	}
+	if want := []string{"3 delete ", "2 rename Front Lobby", "1 login "}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got audit entries %q want %q", got, want)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("error reading audit log: %v", err)
+	}
+	if n := strings.Count(string(data), "\n"); n != 3 {
+		t.Errorf("audit log has %d lines want 3", n)
+	}
+}
+
+func TestAuditLogMemoryLimit(t *testing.T) {
+	defer func(limit int) { auditMemoryLimit = limit }(auditMemoryLimit)
+	auditMemoryLimit = 2
+
+	dir, err := ioutil.TempDir("", "admin")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name     string
+		persist  bool
+		before   int64
+		limit    int
+		sign     string
+		wantIDs  []int64
+		wantNext int64
+	}{
+		{name: "All", persist: true, limit: 10, wantIDs: []int64{5, 4, 3, 2, 1}},
+		{name: "FirstPage", persist: true, limit: 3, wantIDs: []int64{5, 4, 3}, wantNext: 3},
+		{name: "SecondPage", persist: true, before: 3, limit: 3, wantIDs: []int64{2, 1}},
+		{name: "Sign", persist: true, limit: 2, sign: "sign0", wantIDs: []int64{5, 3}, wantNext: 3},
+		{name: "SignSecondPage", persist: true, before: 3, limit: 2, sign: "sign0", wantIDs: []int64{1}},
+		// Without a file, older entries are dropped.
+		{name: "InMemory", limit: 10, wantIDs: []int64{5, 4}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l := newAuditLog()
+			if test.persist {
+				if err := l.persist(filepath.Join(dir, test.name+".jsonl")); err != nil {
+					t.Fatalf("l.persist() = %v want <nil>", err)
+				}
+				defer l.close()
+			}
+			for i := 0; i < 5; i++ {
+				l.record(&auditEntry{Action: auditLoginFailed, Sign: fmt.Sprintf("sign%d", i%2)})
+			}
+			if len(l.entries) != auditMemoryLimit {
+				t.Errorf("got %d entries in memory want %d", len(l.entries), auditMemoryLimit)
+			}
+
+			entries, next := l.page(test.before, test.limit, test.sign)
+			var ids []int64
+			for _, e := range entries {
+				ids = append(ids, e.ID)
+			}
+			if !reflect.DeepEqual(ids, test.wantIDs) || next != test.wantNext {
+				t.Errorf("l.page(%d, %d, %q) = %v, %d want %v, %d", test.before, test.limit, test.sign, ids, next, test.wantIDs, test.wantNext)
+			}
+		})
+	}
+}
+
+func TestAuditHandlers(t *testing.T) {
+	srv := newServer(testPort, goodFakeNb, newFakeConfig(testConfig, ""), testUsers)
+	for i := 0; i < 3; i++ {
+		srv.audit.record(&auditEntry{User: "sean", Action: auditUpdate, Sign: "default", Diff: []string{`+agency: "sf-muni"`}})
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		wantCode int
+		wantBody string
+	}{
+		{name: "Page", path: "/audit?limit=2&sign=default", wantCode: http.StatusOK, wantBody: `href="/audit?before=2&amp;sign=default"`},
+		{name: "APIPage", path: "/api/audit?limit=2&sign=default", wantCode: http.StatusOK, wantBody: `"next":2`},
+		{name: "APILastPage", path: "/api/audit?before=2", wantCode: http.StatusOK, wantBody: `"entries":[{"id":1,`},
+		{name: "InvalidLimit", path: "/api/audit?limit=0", wantCode: http.StatusBadRequest},
+		{name: "InvalidBefore", path: "/api/audit?before=soon", wantCode: http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, test.path, nil)
+			if strings.HasPrefix(test.path, "/api/") {
+				srv.apiAuditHandler(rec, req)
+			} else {
+				srv.auditHandler(rec, req)
+			}
+			if rec.Code != test.wantCode {
+				t.Fatalf("got code %d want %d", rec.Code, test.wantCode)
+			}
+			if !strings.Contains(rec.Body.String(), test.wantBody) {
+				t.Errorf("response %q does not contain %q", rec.Body.String(), test.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidCredentials is returned when a username, password or token is not
+// recognized.
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// CredentialStore holds the local user accounts and API tokens that are
+// allowed to use the admin server.
+type CredentialStore interface {
+	// Authenticate returns nil if the password is correct for the user.
+	Authenticate(user, password string) error
+
+	// AuthenticateToken returns the user that an API token was issued to.
+	AuthenticateToken(token string) (string, error)
+
+	// SetPassword creates the user if necessary and sets its password.
+	SetPassword(user, password string) error
+
+	// NewToken issues a new API token for an existing user. Only a hash of the
+	// token is stored, so it cannot be retrieved again later.
+	NewToken(user string) (string, error)
+
+	// Export returns every account, including the password and token hashes,
+	// in the form accepted by Import.
+	Export() ([]byte, error)
+
+	// Import replaces every account with those in data, which must have been
+	// returned by Export and satisfy ValidateExport.
+	Import(data []byte) error
+}
+
+// randomString returns a URL-safe string encoding n random bytes.
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating random bytes: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,229 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/spf13/afero"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type fileCredentialStore struct {
+	mu   sync.Mutex
+	path string
+}
+
+type credentialsFile struct {
+	Users []*userEntry `json:"users"`
+}
+
+type userEntry struct {
+	Name         string `json:"name"`
+	PasswordHash string `json:"password_hash"`
+	// SHA-256 hashes of the API tokens issued to the user, hex encoded.
+	TokenHashes []string `json:"token_hashes,omitempty"`
+}
+
+// NewFileCredentialStore returns a CredentialStore that keeps its accounts in
+// a JSON file at path. The file is created when the first user is added.
+func NewFileCredentialStore(path string) CredentialStore {
+	return &fileCredentialStore{path: path}
+}
+
+var fs afero.Fs = afero.NewOsFs()
+
+func (cs *fileCredentialStore) Authenticate(user, password string) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	creds, err := readCredentialsFile(cs.path)
+	if err != nil {
+		return err
+	}
+	u := creds.find(user)
+	if u == nil {
+		return ErrInvalidCredentials
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)); err != nil {
+		return ErrInvalidCredentials
+	}
+	return nil
+}
+
+func (cs *fileCredentialStore) AuthenticateToken(token string) (string, error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	creds, err := readCredentialsFile(cs.path)
+	if err != nil {
+		return "", err
+	}
+	h := hashToken(token)
+	for _, u := range creds.Users {
+		for _, th := range u.TokenHashes {
+			if subtle.ConstantTimeCompare([]byte(th), []byte(h)) == 1 {
+				return u.Name, nil
+			}
+		}
+	}
+	return "", ErrInvalidCredentials
+}
+
+func (cs *fileCredentialStore) SetPassword(user, password string) error {
+	if user == "" {
+		return fmt.Errorf("user name must not be empty")
+	}
+	if password == "" {
+		return fmt.Errorf("password must not be empty")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("error hashing password: %v", err)
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	creds, err := readCredentialsFile(cs.path)
+	if err != nil {
+		return err
+	}
+	u := creds.find(user)
+	if u == nil {
+		u = &userEntry{Name: user}
+		creds.Users = append(creds.Users, u)
+	}
+	u.PasswordHash = string(hash)
+	return writeCredentialsFile(cs.path, creds)
+}
+
+func (cs *fileCredentialStore) NewToken(user string) (string, error) {
+	token, err := randomString(32)
+	if err != nil {
+		return "", err
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	creds, err := readCredentialsFile(cs.path)
+	if err != nil {
+		return "", err
+	}
+	u := creds.find(user)
+	if u == nil {
+		return "", fmt.Errorf("no such user: %s", user)
+	}
+	u.TokenHashes = append(u.TokenHashes, hashToken(token))
+	if err := writeCredentialsFile(cs.path, creds); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func (cs *fileCredentialStore) Export() ([]byte, error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	creds, err := readCredentialsFile(cs.path)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(creds, "", "  ")
+}
+
+func (cs *fileCredentialStore) Import(data []byte) error {
+	creds, err := parseExport(data)
+	if err != nil {
+		return err
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return writeCredentialsFile(cs.path, creds)
+}
+
+// ValidateExport checks that data holds accounts returned by
+// CredentialStore.Export, and returns the names of the users in it.
+func ValidateExport(data []byte) ([]string, error) {
+	creds, err := parseExport(data)
+	if err != nil {
+		return nil, err
+	}
+	var users []string
+	for _, u := range creds.Users {
+		users = append(users, u.Name)
+	}
+	return users, nil
+}
+
+func parseExport(data []byte) (*credentialsFile, error) {
+	creds := &credentialsFile{}
+	if err := json.Unmarshal(data, creds); err != nil {
+		return nil, fmt.Errorf("error parsing credentials: %v", err)
+	}
+	// Importing no users would lock everyone out.
+	if len(creds.Users) == 0 {
+		return nil, fmt.Errorf("there must be at least one user")
+	}
+	seen := make(map[string]bool)
+	for _, u := range creds.Users {
+		if u.Name == "" {
+			return nil, fmt.Errorf("user name must not be empty")
+		}
+		if seen[u.Name] {
+			return nil, fmt.Errorf("duplicate user %s", u.Name)
+		}
+		seen[u.Name] = true
+		if _, err := bcrypt.Cost([]byte(u.PasswordHash)); err != nil {
+			return nil, fmt.Errorf("invalid password hash for user %s: %v", u.Name, err)
+		}
+	}
+	return creds, nil
+}
+
+func (c *credentialsFile) find(user string) *userEntry {
+	for _, u := range c.Users {
+		if u.Name == user {
+			return u
+		}
+	}
+	return nil
+}
+
+func hashToken(token string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(token)))
+}
+
+// readCredentialsFile reads the credentials at path. A missing file is treated
+// as a store with no users.
+func readCredentialsFile(path string) (*credentialsFile, error) {
+	data, err := afero.ReadFile(fs, path)
+	if os.IsNotExist(err) {
+		return &credentialsFile{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading credentials file: %v", err)
+	}
+	creds := &credentialsFile{}
+	if err := json.Unmarshal(data, creds); err != nil {
+		return nil, fmt.Errorf("error parsing credentials file: %v", err)
+	}
+	return creds, nil
+}
+
+func writeCredentialsFile(path string, creds *credentialsFile) error {
+	data, err := json.MarshalIndent(creds, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshalling credentials: %v", err)
+	}
+	// The file contains password hashes, so keep it private to the owner.
+	if err := afero.WriteFile(fs, path, data, 0600); err != nil {
+		return fmt.Errorf("error writing credentials file: %v", err)
+	}
+	return nil
+}
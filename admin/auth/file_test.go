@@ -0,0 +1,186 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestAuthenticate(t *testing.T) {
+	tests := []struct {
+		name     string
+		user     string
+		password string
+		wantErr  bool
+	}{
+		{
+			name:     "Good",
+			user:     "sean",
+			password: "hunter2",
+		},
+		{
+			name:     "WrongPassword",
+			user:     "sean",
+			password: "hunter3",
+			wantErr:  true,
+		},
+		{
+			name:     "UnknownUser",
+			user:     "mallory",
+			password: "hunter2",
+			wantErr:  true,
+		},
+		{
+			name:     "EmptyPassword",
+			user:     "sean",
+			password: "",
+			wantErr:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fs = afero.NewMemMapFs()
+			cs := NewFileCredentialStore("/path/to/creds")
+			if err := cs.SetPassword("sean", "hunter2"); err != nil {
+				t.Fatalf("cs.SetPassword() = %v want <nil>", err)
+			}
+
+			err := cs.Authenticate(test.user, test.password)
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("cs.Authenticate() = <nil> want <non-nil>")
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("cs.Authenticate() = %v want <nil>", err)
+			}
+		})
+	}
+}
+
+func TestPasswordNotStoredInPlaintext(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	cs := NewFileCredentialStore("/path/to/creds")
+	if err := cs.SetPassword("sean", "hunter2"); err != nil {
+		t.Fatalf("cs.SetPassword() = %v want <nil>", err)
+	}
+
+	if found, _ := afero.FileContainsBytes(fs, "/path/to/creds", []byte("hunter2")); found {
+		t.Errorf("credentials file contains the plaintext password")
+	}
+}
+
+func TestSetPasswordReplacesOld(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	cs := NewFileCredentialStore("/path/to/creds")
+	if err := cs.SetPassword("sean", "hunter2"); err != nil {
+		t.Fatalf("cs.SetPassword() = %v want <nil>", err)
+	}
+	if err := cs.SetPassword("sean", "correct horse"); err != nil {
+		t.Fatalf("cs.SetPassword() = %v want <nil>", err)
+	}
+
+	if err := cs.Authenticate("sean", "hunter2"); err == nil {
+		t.Errorf("cs.Authenticate() with old password = <nil> want <non-nil>")
+	}
+	if err := cs.Authenticate("sean", "correct horse"); err != nil {
+		t.Errorf("cs.Authenticate() with new password = %v want <nil>", err)
+	}
+}
+
+func TestTokens(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	cs := NewFileCredentialStore("/path/to/creds")
+	if err := cs.SetPassword("sean", "hunter2"); err != nil {
+		t.Fatalf("cs.SetPassword() = %v want <nil>", err)
+	}
+
+	token, err := cs.NewToken("sean")
+	if err != nil {
+		t.Fatalf("cs.NewToken() = _, %v want _, <nil>", err)
+	}
+
+	if user, err := cs.AuthenticateToken(token); err != nil || user != "sean" {
+		t.Errorf("cs.AuthenticateToken() = %q, %v want %q, <nil>", user, err, "sean")
+	}
+	if _, err := cs.AuthenticateToken("bogus"); err == nil {
+		t.Errorf("cs.AuthenticateToken(bogus) = _, <nil> want _, <non-nil>")
+	}
+	if found, _ := afero.FileContainsBytes(fs, "/path/to/creds", []byte(token)); found {
+		t.Errorf("credentials file contains the plaintext token")
+	}
+	if _, err := cs.NewToken("mallory"); err == nil {
+		t.Errorf("cs.NewToken(mallory) = _, <nil> want _, <non-nil>")
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	src := NewFileCredentialStore("/path/to/creds")
+	if err := src.SetPassword("sean", "hunter2"); err != nil {
+		t.Fatalf("cs.SetPassword() = %v want <nil>", err)
+	}
+	token, err := src.NewToken("sean")
+	if err != nil {
+		t.Fatalf("cs.NewToken() = _, %v want _, <nil>", err)
+	}
+
+	data, err := src.Export()
+	if err != nil {
+		t.Fatalf("cs.Export() = _, %v want _, <nil>", err)
+	}
+	if users, err := ValidateExport(data); err != nil || len(users) != 1 || users[0] != "sean" {
+		t.Errorf("ValidateExport() = %v, %v want [sean], <nil>", users, err)
+	}
+
+	dst := NewFileCredentialStore("/path/to/restored")
+	if err := dst.SetPassword("mallory", "hunter2"); err != nil {
+		t.Fatalf("cs.SetPassword() = %v want <nil>", err)
+	}
+	if err := dst.Import(data); err != nil {
+		t.Fatalf("cs.Import() = %v want <nil>", err)
+	}
+	if err := dst.Authenticate("sean", "hunter2"); err != nil {
+		t.Errorf("cs.Authenticate() after import = %v want <nil>", err)
+	}
+	if user, err := dst.AuthenticateToken(token); err != nil || user != "sean" {
+		t.Errorf("cs.AuthenticateToken() after import = %q, %v want %q, <nil>", user, err, "sean")
+	}
+	if err := dst.Authenticate("mallory", "hunter2"); err == nil {
+		t.Errorf("cs.Authenticate() of user missing from import = <nil> want <non-nil>")
+	}
+}
+
+func TestImportInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{name: "NotJSON", data: `users: sean`},
+		{name: "NoUsers", data: `{"users": []}`},
+		{name: "EmptyName", data: `{"users": [{"name": "", "password_hash": "$2a$10$abcdefghijklmnopqrstuuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0"}]}`},
+		{name: "BadHash", data: `{"users": [{"name": "sean", "password_hash": "hunter2"}]}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fs = afero.NewMemMapFs()
+			cs := NewFileCredentialStore("/path/to/creds")
+			if err := cs.SetPassword("sean", "hunter2"); err != nil {
+				t.Fatalf("cs.SetPassword() = %v want <nil>", err)
+			}
+
+			if _, err := ValidateExport([]byte(test.data)); err == nil {
+				t.Errorf("ValidateExport() = _, <nil> want _, <non-nil>")
+			}
+			if err := cs.Import([]byte(test.data)); err == nil {
+				t.Errorf("cs.Import() = <nil> want <non-nil>")
+			}
+			if err := cs.Authenticate("sean", "hunter2"); err != nil {
+				t.Errorf("cs.Authenticate() after failed import = %v want <nil>", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+// Alias for time.Now to facilitate testing.
+var timeNow = time.Now
+
+// Session is a signed in user's browser session.
+type Session struct {
+	ID      string
+	User    string
+	Expires time.Time
+	// A secret that must accompany every state-changing request made with the
+	// session, proving that the request came from one of our own pages.
+	CSRFToken string
+}
+
+// SessionManager keeps track of the active sessions in memory. Sessions do not
+// survive a restart of the admin server.
+type SessionManager struct {
+	mu       sync.Mutex
+	sessions map[string]*Session
+	timeout  time.Duration
+}
+
+// NewSessionManager returns a SessionManager whose sessions expire after the
+// given period of inactivity.
+func NewSessionManager(timeout time.Duration) *SessionManager {
+	return &SessionManager{
+		sessions: make(map[string]*Session),
+		timeout:  timeout,
+	}
+}
+
+// NewCSRFToken returns a new random CSRF token, like the one of every session.
+// It is also used on its own by forms that are submitted before there is a
+// session, such as the login form.
+func NewCSRFToken() (string, error) {
+	return randomString(32)
+}
+
+// Create starts a new session for user. Expired sessions are removed at the
+// same time, so that abandoned ones do not pile up.
+func (m *SessionManager) Create(user string) (*Session, error) {
+	id, err := randomString(32)
+	if err != nil {
+		return nil, err
+	}
+	csrfToken, err := NewCSRFToken()
+	if err != nil {
+		return nil, err
+	}
+	s := &Session{
+		ID:        id,
+		User:      user,
+		Expires:   timeNow().Add(m.timeout),
+		CSRFToken: csrfToken,
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := timeNow()
+	for id, s := range m.sessions {
+		if now.After(s.Expires) {
+			delete(m.sessions, id)
+		}
+	}
+	m.sessions[id] = s
+	cp := *s
+	return &cp, nil
+}
+
+// Get returns the session with the given ID if it exists and has not expired,
+// extending its lifetime.
+func (m *SessionManager) Get(id string) (*Session, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.sessions[id]
+	if !ok {
+		return nil, false
+	}
+	now := timeNow()
+	if now.After(s.Expires) {
+		delete(m.sessions, id)
+		return nil, false
+	}
+	s.Expires = now.Add(m.timeout)
+	cp := *s
+	return &cp, true
+}
+
+// Delete ends the session with the given ID.
+func (m *SessionManager) Delete(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, id)
+}
+
+// DeleteUser ends every session of user, such as after its password changed.
+func (m *SessionManager) DeleteUser(user string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, s := range m.sessions {
+		if s.User == user {
+			delete(m.sessions, id)
+		}
+	}
+}
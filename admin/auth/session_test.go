@@ -0,0 +1,140 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSessions(t *testing.T) {
+	start := time.Now()
+	timeout := time.Hour
+
+	tests := []struct {
+		name    string
+		elapsed time.Duration
+		deleted bool
+		wantOK  bool
+	}{
+		{
+			name:    "Fresh",
+			elapsed: timeout - time.Second,
+			wantOK:  true,
+		},
+		{
+			name:    "Expired",
+			elapsed: timeout + time.Second,
+			wantOK:  false,
+		},
+		{
+			name:    "Deleted",
+			elapsed: 0,
+			deleted: true,
+			wantOK:  false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			timeNow = func() time.Time { return start }
+			m := NewSessionManager(timeout)
+
+			s, err := m.Create("sean")
+			if err != nil {
+				t.Fatalf("m.Create() = _, %v want _, <nil>", err)
+			}
+			if test.deleted {
+				m.Delete(s.ID)
+			}
+
+			timeNow = func() time.Time { return start.Add(test.elapsed) }
+			got, ok := m.Get(s.ID)
+			if ok != test.wantOK {
+				t.Fatalf("m.Get() = _, %t want _, %t", ok, test.wantOK)
+			}
+			if ok && got.User != "sean" {
+				t.Errorf("m.Get() = %v, _ want user %q", got, "sean")
+			}
+			if ok && got.CSRFToken != s.CSRFToken {
+				t.Errorf("m.Get() = %v, _ want CSRF token %q", got, s.CSRFToken)
+			}
+		})
+	}
+}
+
+func TestSessionRenewedOnUse(t *testing.T) {
+	start := time.Now()
+	timeout := time.Hour
+
+	timeNow = func() time.Time { return start }
+	m := NewSessionManager(timeout)
+	s, err := m.Create("sean")
+	if err != nil {
+		t.Fatalf("m.Create() = _, %v want _, <nil>", err)
+	}
+
+	timeNow = func() time.Time { return start.Add(timeout / 2) }
+	if _, ok := m.Get(s.ID); !ok {
+		t.Fatalf("m.Get() = _, false want _, true")
+	}
+
+	timeNow = func() time.Time { return start.Add(timeout + time.Second) }
+	if _, ok := m.Get(s.ID); !ok {
+		t.Errorf("m.Get() after renewal = _, false want _, true")
+	}
+}
+
+func TestSessionCSRFTokensDiffer(t *testing.T) {
+	m := NewSessionManager(time.Hour)
+
+	s1, err := m.Create("sean")
+	if err != nil {
+		t.Fatalf("m.Create() = _, %v want _, <nil>", err)
+	}
+	s2, err := m.Create("sean")
+	if err != nil {
+		t.Fatalf("m.Create() = _, %v want _, <nil>", err)
+	}
+
+	if s1.CSRFToken == "" || s1.CSRFToken == s2.CSRFToken {
+		t.Errorf("CSRF tokens %q and %q should be distinct and non-empty", s1.CSRFToken, s2.CSRFToken)
+	}
+}
+
+func TestSessionsReaped(t *testing.T) {
+	start := time.Now()
+	timeout := time.Hour
+
+	timeNow = func() time.Time { return start }
+	m := NewSessionManager(timeout)
+	if _, err := m.Create("sean"); err != nil {
+		t.Fatalf("m.Create() = _, %v want _, <nil>", err)
+	}
+
+	timeNow = func() time.Time { return start.Add(timeout + time.Second) }
+	if _, err := m.Create("sean"); err != nil {
+		t.Fatalf("m.Create() = _, %v want _, <nil>", err)
+	}
+	if got := len(m.sessions); got != 1 {
+		t.Errorf("got %d sessions after the first expired want 1", got)
+	}
+}
+
+func TestDeleteUser(t *testing.T) {
+	m := NewSessionManager(time.Hour)
+
+	var sessions []*Session
+	for _, user := range []string{"sean", "sean", "alice"} {
+		s, err := m.Create(user)
+		if err != nil {
+			t.Fatalf("m.Create() = _, %v want _, <nil>", err)
+		}
+		sessions = append(sessions, s)
+	}
+
+	m.DeleteUser("sean")
+	for _, s := range sessions {
+		if _, ok := m.Get(s.ID); ok != (s.User == "alice") {
+			t.Errorf("m.Get() of a session of %s = _, %t want _, %t", s.User, ok, s.User == "alice")
+		}
+	}
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/wallaceicy06/muni-sign/admin/auth"
+	"github.com/wallaceicy06/muni-sign/admin/config"
+	pb "github.com/wallaceicy06/muni-sign/proto"
+)
+
+// The largest backup archive that may be imported.
+const maxBackupSize = 10 << 20
+
+// Names of the files in a backup archive. The revision history of each sign is
+// stored in its own file in the revisions directory, named after the sign.
+const (
+	backupFleetFile     = "fleet.json"
+	backupUsersFile     = "users.json"
+	backupRevisionsDir  = "revisions/"
+	backupRevisionsFile = ".json"
+)
+
+// backup is the contents of a backup archive.
+type backup struct {
+	fleet   *pb.Fleet
+	history map[string][]*pb.ConfigurationRevision
+	// The exported credential store, or nil if the archive has no users.
+	users []byte
+}
+
+// importSummary describes the changes made, or that would be made during a
+// dry run, by importing a backup.
+type importSummary struct {
+	DryRun  bool     `json:"dry_run"`
+	Created []string `json:"created,omitempty"`
+	Updated []string `json:"updated,omitempty"`
+	Deleted []string `json:"deleted,omitempty"`
+	// The users in the backup, which replace all existing users.
+	Users []string `json:"users,omitempty"`
+}
+
+// apiExportHandler serves a gzipped tar archive holding every sign, the
+// revision history of each sign and the admin users.
+func (s *server) apiExportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, fmt.Sprintf("Unsupported method: %s.", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+
+	b, err := s.backup()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Internal error: %v", err), http.StatusInternalServerError)
+		return
+	}
+	var buf bytes.Buffer
+	if err := writeBackup(&buf, b); err != nil {
+		http.Error(w, fmt.Sprintf("Internal error: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="muni-sign-backup-%s.tar.gz"`, timeNow().Format("20060102")))
+	if _, err := buf.WriteTo(w); err != nil {
+		log.Printf("Error writing backup: %v", err)
+	}
+}
+
+// apiImportHandler restores a backup made by apiExportHandler. The archive is
+// either the request body or, when uploaded from a form, the "archive" file.
+// Nothing is changed if the archive is invalid, if restoring it fails or if
+// the dry_run parameter is set, and the response describes the changes
+// either way. Every change to a sign is recorded in the audit log.
+func (s *server) apiImportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, fmt.Sprintf("Unsupported method: %s.", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Limit the body before parsing any form, so that uploads are limited too.
+	r.Body = http.MaxBytesReader(w, r.Body, maxBackupSize)
+	var archive io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		f, _, err := r.FormFile("archive")
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid backup: %v", err), http.StatusBadRequest)
+			return
+		}
+		defer f.Close()
+		archive = f
+	}
+
+	b, err := readBackup(archive)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid backup: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := config.ValidateBackup(b.fleet, b.history); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid backup: %v", err), http.StatusBadRequest)
+		return
+	}
+	summary := &importSummary{DryRun: isTrue(r.FormValue("dry_run"))}
+	if b.users != nil {
+		if summary.Users, err = auth.ValidateExport(b.users); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid backup: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	current, err := s.cfg.List()
+	if err != nil {
+		configError(w, err)
+		return
+	}
+	summarizeImport(summary, current, b.fleet)
+	if summary.DryRun {
+		writeJSON(w, summary)
+		return
+	}
+
+	// The users are replaced first, since they are the easier to put back if
+	// restoring the signs fails.
+	var oldUsers []byte
+	if b.users != nil {
+		if oldUsers, err = s.users.Export(); err != nil {
+			http.Error(w, fmt.Sprintf("Internal error: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if err := s.users.Import(b.users); err != nil {
+			http.Error(w, fmt.Sprintf("Internal error: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := config.Restore(s.configFor(r), b.fleet, b.history); err != nil {
+		if b.users != nil {
+			if err := s.users.Import(oldUsers); err != nil {
+				log.Printf("Error putting back the users after a failed import: %v", err)
+			}
+		}
+		configError(w, err)
+		return
+	}
+	log.Printf("%s imported a backup: %d signs created, %d updated, %d deleted.", requestUser(r), len(summary.Created), len(summary.Updated), len(summary.Deleted))
+	s.audit.record(&auditEntry{
+		User:       requestUser(r),
+		RemoteAddr: remoteHost(r),
+		Action:     auditImport,
+		Detail:     fmt.Sprintf("%d signs created, %d updated, %d deleted", len(summary.Created), len(summary.Updated), len(summary.Deleted)),
+	})
+	writeJSON(w, summary)
+}
+
+// backup collects everything that goes into a backup archive.
+func (s *server) backup() (*backup, error) {
+	signs, err := s.cfg.List()
+	if err != nil {
+		return nil, err
+	}
+	b := &backup{
+		fleet:   &pb.Fleet{Signs: signs},
+		history: make(map[string][]*pb.ConfigurationRevision),
+	}
+	for _, sign := range signs {
+		if b.history[sign.GetId()], err = s.cfg.Revisions(sign.GetId()); err != nil {
+			return nil, err
+		}
+	}
+	if b.users, err = s.users.Export(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// summarizeImport fills in the signs that replacing the current fleet with the
+// imported one would create, update and delete. The imported configurations
+// must already be upgraded by config.ValidateBackup, so that they compare
+// equal to the stored ones when nothing would change.
+func summarizeImport(summary *importSummary, current []*pb.Sign, imported *pb.Fleet) {
+	existing := make(map[string]*pb.Sign)
+	for _, sign := range current {
+		existing[sign.GetId()] = sign
+	}
+	for _, sign := range imported.GetSigns() {
+		old, ok := existing[sign.GetId()]
+		switch {
+		case !ok:
+			summary.Created = append(summary.Created, sign.GetId())
+		case old.GetName() != sign.GetName() || !proto.Equal(old.GetConfiguration(), sign.GetConfiguration()):
+			summary.Updated = append(summary.Updated, sign.GetId())
+		}
+		delete(existing, sign.GetId())
+	}
+	for _, sign := range current {
+		if _, ok := existing[sign.GetId()]; ok {
+			summary.Deleted = append(summary.Deleted, sign.GetId())
+		}
+	}
+}
+
+func writeBackup(w io.Writer, b *backup) error {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+
+	if err := writeBackupJSON(tw, backupFleetFile, b.fleet); err != nil {
+		return err
+	}
+	for _, sign := range b.fleet.GetSigns() {
+		name := backupRevisionsDir + sign.GetId() + backupRevisionsFile
+		if err := writeBackupJSON(tw, name, b.history[sign.GetId()]); err != nil {
+			return err
+		}
+	}
+	if err := writeBackupFile(tw, backupUsersFile, b.users); err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+func writeBackupJSON(tw *tar.Writer, name string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshalling %s: %v", name, err)
+	}
+	return writeBackupFile(tw, name, data)
+}
+
+func writeBackupFile(tw *tar.Writer, name string, data []byte) error {
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    0600,
+		Size:    int64(len(data)),
+		ModTime: timeNow(),
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+func readBackup(r io.Reader) (*backup, error) {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(gr)
+
+	b := &backup{history: make(map[string][]*pb.ConfigurationRevision)}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+
+		switch name := hdr.Name; {
+		case name == backupFleetFile:
+			b.fleet = &pb.Fleet{}
+			if err := json.Unmarshal(data, b.fleet); err != nil {
+				return nil, fmt.Errorf("error parsing %s: %v", name, err)
+			}
+		case name == backupUsersFile:
+			b.users = data
+		case path.Dir(name)+"/" == backupRevisionsDir && strings.HasSuffix(name, backupRevisionsFile):
+			var revs []*pb.ConfigurationRevision
+			if err := json.Unmarshal(data, &revs); err != nil {
+				return nil, fmt.Errorf("error parsing %s: %v", name, err)
+			}
+			b.history[strings.TrimSuffix(path.Base(name), backupRevisionsFile)] = revs
+		default:
+			return nil, fmt.Errorf("unexpected file %s", name)
+		}
+	}
+	if b.fleet == nil {
+		return nil, fmt.Errorf("missing %s", backupFleetFile)
+	}
+	return b, nil
+}
+
+// isTrue reports whether a query or form parameter is set, as by a checked
+// checkbox or a value such as "1" or "true".
+func isTrue(v string) bool {
+	switch strings.ToLower(v) {
+	case "", "0", "false", "off", "no":
+		return false
+	default:
+		return true
+	}
+}
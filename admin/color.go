@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"math"
+
+	pb "github.com/wallaceicy06/muni-sign/proto"
+)
+
+// cssColor formats c as a CSS hex color, such as "#ff0000".
+func cssColor(c *pb.Color) string {
+	return fmt.Sprintf("#%02x%02x%02x", colorByte(c.GetRed()), colorByte(c.GetGreen()), colorByte(c.GetBlue()))
+}
+
+func colorByte(v float64) int {
+	return int(math.Round(math.Max(0, math.Min(1, v)) * 255))
+}
+
+// parseCSSColor parses a CSS hex color of the form "#rrggbb", as submitted by
+// color inputs.
+func parseCSSColor(s string) (*pb.Color, error) {
+	var r, g, b uint8
+	if len(s) != 7 {
+		return nil, fmt.Errorf("invalid color %q", s)
+	}
+	if _, err := fmt.Sscanf(s, "#%02x%02x%02x", &r, &g, &b); err != nil {
+		return nil, fmt.Errorf("invalid color %q", s)
+	}
+	return &pb.Color{
+		Red:   float64(r) / 255,
+		Green: float64(g) / 255,
+		Blue:  float64(b) / 255,
+	}, nil
+}
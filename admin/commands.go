@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/wallaceicy06/muni-sign/admin/auth"
+	"github.com/wallaceicy06/muni-sign/admin/config"
+)
+
+const commandUsage = `Commands:
+  useradd <user>       create a user, or change its password, reading the
+                       password from standard input
+  newtoken <user>      print a new API token for an existing user
+  convert <src> <dst>  copy the configuration file src to the new file dst,
+                       translating between the formats given by their
+                       extensions (.pb.txt, .json or .yaml)`
+
+// runCommand runs one of the administrative commands that can be given on the
+// command line instead of starting the server.
+func runCommand(args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("no command given\n%s", commandUsage)
+	}
+	switch cmd := args[0]; cmd {
+	case "useradd", "newtoken":
+		if len(args) != 2 {
+			return fmt.Errorf("wrong number of arguments\n%s", commandUsage)
+		}
+		return runUserCommand(cmd, args[1], stdin, stdout)
+	case "convert":
+		if len(args) != 3 {
+			return fmt.Errorf("wrong number of arguments\n%s", commandUsage)
+		}
+		return config.ConvertFile(args[1], args[2])
+	default:
+		return fmt.Errorf("unknown command %q\n%s", cmd, commandUsage)
+	}
+}
+
+// runUserCommand runs a command that manages the users in the credentials
+// file.
+func runUserCommand(cmd, user string, stdin io.Reader, stdout io.Writer) error {
+	if *credentialsFilePath == "" {
+		return fmt.Errorf("a credentials file path is required")
+	}
+	users := auth.NewFileCredentialStore(*credentialsFilePath)
+
+	if cmd == "newtoken" {
+		token, err := users.NewToken(user)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(stdout, token)
+		return nil
+	}
+
+	fmt.Fprintf(stdout, "Password for %s: ", user)
+	password, err := bufio.NewReader(stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("error reading password: %v", err)
+	}
+	return users.SetPassword(user, strings.TrimRight(password, "\r\n"))
+}
@@ -0,0 +1,149 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/wallaceicy06/muni-sign/proto"
+	"github.com/wallaceicy06/muni-sign/schedule"
+)
+
+// HistoryRestorer is implemented by SignConfigs that keep the revision history
+// of each sign and can have it restored from a backup.
+type HistoryRestorer interface {
+	// RestoreRevisions replaces the revision history of a sign with revs,
+	// given newest first as returned by Revisions.
+	RestoreRevisions(id string, revs []*pb.ConfigurationRevision) error
+}
+
+// ValidateBackup checks that a fleet and the revision history of its signs can
+// be restored with Restore. The configuration of every sign in fleet is
+// upgraded to CurrentSchemaVersion, as Put would store it.
+func ValidateBackup(fleet *pb.Fleet, history map[string][]*pb.ConfigurationRevision) error {
+	ids := make(map[string]bool)
+	for _, s := range fleet.GetSigns() {
+		if !ValidSignID(s.GetId()) {
+			return fmt.Errorf("invalid sign ID %q", s.GetId())
+		}
+		if ids[s.GetId()] {
+			return fmt.Errorf("duplicate sign ID %q", s.GetId())
+		}
+		ids[s.GetId()] = true
+
+		cfg, err := Migrate(signConfiguration(s))
+		if err != nil {
+			return fmt.Errorf("sign %q: %v", s.GetId(), err)
+		}
+		if err := validateConfiguration(cfg); err != nil {
+			return fmt.Errorf("sign %q: %v", s.GetId(), err)
+		}
+		s.Configuration = cfg
+	}
+	for id, revs := range history {
+		if !ids[id] {
+			return fmt.Errorf("revision history for unknown sign %q", id)
+		}
+		for _, r := range revs {
+			if want := Revision(r.GetConfiguration()); r.GetRevision() != want {
+				return fmt.Errorf("revision %q of sign %q does not match its configuration", r.GetRevision(), id)
+			}
+		}
+	}
+	return nil
+}
+
+// validateConfiguration checks a configuration the way the admin server does
+// before storing it. Signs that have never been configured have no agency, so
+// an empty configuration is valid too.
+func validateConfiguration(cfg *pb.Configuration) error {
+	if proto.Equal(cfg, emptyConfiguration()) {
+		return nil
+	}
+	if cfg.GetAgency() == "" {
+		return errors.New("agency must be provided")
+	}
+	return schedule.Validate(cfg)
+}
+
+// Restore makes dst hold exactly the signs in fleet, deleting any others. If
+// dst implements HistoryRestorer, the revision history of each sign found in
+// history is restored too. The backup should first be checked with
+// ValidateBackup. If restoring fails, the signs are put back as they were, so
+// that dst is left unchanged unless undoing the restore fails as well.
+func Restore(dst SignConfig, fleet *pb.Fleet, history map[string][]*pb.ConfigurationRevision) error {
+	signs, err := dst.List()
+	if err != nil {
+		return err
+	}
+	// Kept apart from the signs in dst, which restoring may change in place.
+	current := proto.Clone(&pb.Fleet{Signs: signs}).(*pb.Fleet)
+	var currentHistory map[string][]*pb.ConfigurationRevision
+	if _, ok := dst.(HistoryRestorer); ok {
+		currentHistory = make(map[string][]*pb.ConfigurationRevision)
+		for _, s := range current.GetSigns() {
+			if currentHistory[s.GetId()], err = dst.Revisions(s.GetId()); err != nil {
+				return fmt.Errorf("error reading history of sign %q: %v", s.GetId(), err)
+			}
+		}
+	}
+
+	err = restore(dst, fleet, history)
+	if err == nil {
+		return nil
+	}
+	if undoErr := restore(dst, current, currentHistory); undoErr != nil {
+		return fmt.Errorf("%v, and error undoing the restore: %v", err, undoErr)
+	}
+	return err
+}
+
+func restore(dst SignConfig, fleet *pb.Fleet, history map[string][]*pb.ConfigurationRevision) error {
+	current, err := dst.List()
+	if err != nil {
+		return err
+	}
+	for _, s := range fleet.GetSigns() {
+		if err := restoreSign(dst, current, s); err != nil {
+			return fmt.Errorf("error restoring sign %q: %v", s.GetId(), err)
+		}
+	}
+	if hr, ok := dst.(HistoryRestorer); ok {
+		for id, revs := range history {
+			if err := hr.RestoreRevisions(id, revs); err != nil {
+				return fmt.Errorf("error restoring history of sign %q: %v", id, err)
+			}
+		}
+	}
+
+	// Signs are deleted last, so that they are still there to be put back if
+	// restoring another sign fails.
+	for _, s := range current {
+		if findSign(fleet, s.GetId()) < 0 {
+			if err := dst.Delete(s.GetId()); err != nil {
+				return fmt.Errorf("error deleting sign %q: %v", s.GetId(), err)
+			}
+		}
+	}
+	return nil
+}
+
+func restoreSign(dst SignConfig, current []*pb.Sign, s *pb.Sign) error {
+	config := signConfiguration(s)
+	i := findSign(&pb.Fleet{Signs: current}, s.GetId())
+	if i < 0 {
+		if err := dst.Create(s.GetId(), s.GetName()); err != nil {
+			return err
+		}
+	} else if current[i].GetName() != s.GetName() {
+		if err := dst.Rename(s.GetId(), s.GetName()); err != nil {
+			return err
+		}
+	}
+	if i >= 0 && Revision(signConfiguration(current[i])) == Revision(config) {
+		return nil
+	}
+	_, err := dst.Put(s.GetId(), config, "")
+	return err
+}
@@ -0,0 +1,207 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/afero"
+
+	pb "github.com/wallaceicy06/muni-sign/proto"
+)
+
+func TestValidateBackup(t *testing.T) {
+	cfg := &pb.Configuration{SchemaVersion: CurrentSchemaVersion, Agency: "sf-muni", Stops: []*pb.Stop{{Id: "1234"}}}
+	fleet := &pb.Fleet{Signs: []*pb.Sign{{Id: "lobby", Configuration: cfg}}}
+
+	tests := []struct {
+		name    string
+		fleet   *pb.Fleet
+		history map[string][]*pb.ConfigurationRevision
+		wantErr bool
+	}{
+		{
+			name:    "Good",
+			fleet:   fleet,
+			history: map[string][]*pb.ConfigurationRevision{"lobby": {{Revision: Revision(cfg), Configuration: cfg}}},
+		},
+		{
+			name:    "Empty",
+			fleet:   &pb.Fleet{},
+			history: nil,
+		},
+		{
+			name:  "Unconfigured",
+			fleet: &pb.Fleet{Signs: []*pb.Sign{{Id: "lobby"}}},
+		},
+		{
+			name:    "UnsupportedSchemaVersion",
+			fleet:   &pb.Fleet{Signs: []*pb.Sign{{Id: "lobby", Configuration: &pb.Configuration{SchemaVersion: 99, Agency: "sf-muni"}}}},
+			wantErr: true,
+		},
+		{
+			name:    "NoAgency",
+			fleet:   &pb.Fleet{Signs: []*pb.Sign{{Id: "lobby", Configuration: &pb.Configuration{Stops: []*pb.Stop{{Id: "1234"}}}}}},
+			wantErr: true,
+		},
+		{
+			name: "UnknownProfile",
+			fleet: &pb.Fleet{Signs: []*pb.Sign{{Id: "lobby", Configuration: &pb.Configuration{
+				Agency:   "sf-muni",
+				Schedule: &pb.Schedule{DefaultProfile: "Weekdays"},
+			}}}},
+			wantErr: true,
+		},
+		{
+			name:    "InvalidID",
+			fleet:   &pb.Fleet{Signs: []*pb.Sign{{Id: "Lobby!"}}},
+			wantErr: true,
+		},
+		{
+			name:    "DuplicateID",
+			fleet:   &pb.Fleet{Signs: []*pb.Sign{{Id: "lobby"}, {Id: "lobby"}}},
+			wantErr: true,
+		},
+		{
+			name:    "HistoryOfUnknownSign",
+			fleet:   fleet,
+			history: map[string][]*pb.ConfigurationRevision{"garage": {{Revision: Revision(cfg), Configuration: cfg}}},
+			wantErr: true,
+		},
+		{
+			name:    "WrongRevision",
+			fleet:   fleet,
+			history: map[string][]*pb.ConfigurationRevision{"lobby": {{Revision: "abcd", Configuration: cfg}}},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ValidateBackup(test.fleet, test.history)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Errorf("ValidateBackup() = %v want error %t", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateBackupMigrates(t *testing.T) {
+	fleet := &pb.Fleet{Signs: []*pb.Sign{{Id: "lobby", Configuration: &pb.Configuration{SchemaVersion: 1, Agency: "sf-muni", StopIds: []string{"1234"}}}}}
+	if err := ValidateBackup(fleet, nil); err != nil {
+		t.Fatalf("ValidateBackup() = %v want <nil>", err)
+	}
+	want := &pb.Configuration{SchemaVersion: CurrentSchemaVersion, Agency: "sf-muni", Stops: []*pb.Stop{{Id: "1234"}}}
+	if got := fleet.Signs[0].GetConfiguration(); !proto.Equal(got, want) {
+		t.Errorf("configuration after ValidateBackup() = %v want %v", got, want)
+	}
+}
+
+// failingPut is a SignConfig that fails to store the configuration of one
+// sign.
+type failingPut struct {
+	SignConfig
+	id string
+}
+
+func (f *failingPut) Put(id string, cfg *pb.Configuration, rev string) (string, error) {
+	if id == f.id {
+		return "", errors.New("disk is full")
+	}
+	return f.SignConfig.Put(id, cfg, rev)
+}
+
+func TestRestoreFailure(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	sc := NewFileSignConfig("/path/to/file")
+	for _, id := range []string{"kitchen", "lobby"} {
+		if err := sc.Create(id, id); err != nil {
+			t.Fatalf("sc.Create() = %v want <nil>", err)
+		}
+	}
+	if _, err := sc.Put("lobby", &pb.Configuration{Agency: "sf-muni", Stops: []*pb.Stop{{Id: "1234"}}}, ""); err != nil {
+		t.Fatalf("sc.Put() = _, %v want _, <nil>", err)
+	}
+	want, err := sc.List()
+	if err != nil {
+		t.Fatalf("sc.List() = _, %v want _, <nil>", err)
+	}
+
+	// The kitchen sign would be deleted, the lobby renamed and updated, and
+	// the hallway created, but storing the hallway fails.
+	fleet := &pb.Fleet{Signs: []*pb.Sign{
+		{Id: "lobby", Name: "Front Lobby", Configuration: &pb.Configuration{SchemaVersion: CurrentSchemaVersion, Agency: "sf-muni", Stops: []*pb.Stop{{Id: "5678"}}}},
+		{Id: "hallway", Name: "Hallway", Configuration: &pb.Configuration{SchemaVersion: CurrentSchemaVersion, Agency: "sf-muni", Stops: []*pb.Stop{{Id: "9012"}}}},
+	}}
+	if err := Restore(&failingPut{sc, "hallway"}, fleet, nil); err == nil {
+		t.Fatalf("Restore() = <nil> want error")
+	}
+
+	got, err := sc.List()
+	if err != nil {
+		t.Fatalf("sc.List() = _, %v want _, <nil>", err)
+	}
+	if !proto.Equal(&pb.Fleet{Signs: got}, &pb.Fleet{Signs: want}) {
+		t.Errorf("sc.List() after failed Restore() = %v want %v", got, want)
+	}
+}
+
+func TestRestore(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	sc := NewFileSignConfig("/path/to/file")
+	for _, id := range []string{"kitchen", "lobby"} {
+		if err := sc.Create(id, id); err != nil {
+			t.Fatalf("sc.Create() = %v want <nil>", err)
+		}
+	}
+
+	want := &pb.Fleet{Signs: []*pb.Sign{
+		{Id: "lobby", Name: "Front Lobby", Configuration: &pb.Configuration{SchemaVersion: CurrentSchemaVersion, Agency: "sf-muni", Stops: []*pb.Stop{{Id: "1234"}}}},
+		{Id: "hallway", Name: "Hallway", Configuration: &pb.Configuration{SchemaVersion: CurrentSchemaVersion, Agency: "sf-muni", Stops: []*pb.Stop{{Id: "5678"}}}},
+	}}
+	if err := Restore(sc, want, nil); err != nil {
+		t.Fatalf("Restore() = %v want <nil>", err)
+	}
+
+	got, err := sc.List()
+	if err != nil {
+		t.Fatalf("sc.List() = _, %v want _, <nil>", err)
+	}
+	if !proto.Equal(&pb.Fleet{Signs: got}, want) {
+		t.Errorf("sc.List() after Restore() = %v want %v", got, want.Signs)
+	}
+}
+
+func TestRestoreHistory(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	sc := newTestBoltSignConfig(t, filepath.Join(dir, "config.db"))
+	defer sc.(*boltSignConfig).Close()
+
+	old := &pb.Configuration{SchemaVersion: CurrentSchemaVersion, Agency: "sf-muni", Stops: []*pb.Stop{{Id: "1234"}}}
+	cur := &pb.Configuration{SchemaVersion: CurrentSchemaVersion, Agency: "sf-muni", Stops: []*pb.Stop{{Id: "5678"}}}
+	fleet := &pb.Fleet{Signs: []*pb.Sign{{Id: "lobby", Name: "Lobby", Configuration: cur}}}
+	history := map[string][]*pb.ConfigurationRevision{"lobby": {
+		{Revision: Revision(cur), CreateTime: 2000, Configuration: cur},
+		{Revision: Revision(old), CreateTime: 1000, Configuration: old},
+	}}
+	if err := Restore(sc, fleet, history); err != nil {
+		t.Fatalf("Restore() = %v want <nil>", err)
+	}
+
+	got, err := sc.Revisions("lobby")
+	if err != nil {
+		t.Fatalf("sc.Revisions() = _, %v want _, <nil>", err)
+	}
+	want := history["lobby"]
+	if len(got) != len(want) {
+		t.Fatalf("sc.Revisions() = %v, _ want %v, _", got, want)
+	}
+	for i := range want {
+		if !proto.Equal(got[i], want[i]) {
+			t.Errorf("sc.Revisions()[%d] = %v want %v", i, got[i], want[i])
+		}
+	}
+}
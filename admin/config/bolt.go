@@ -0,0 +1,304 @@
+package config
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	bolt "go.etcd.io/bbolt"
+
+	pb "github.com/wallaceicy06/muni-sign/proto"
+)
+
+// Alias for time.Now to facilitate testing.
+var timeNow = time.Now
+
+// The database holds one top-level bucket, containing a bucket for each sign.
+// Each sign's bucket holds the Sign proto with its current configuration, the
+// order in which the sign was created, and a bucket with every configuration
+// the sign has ever had, keyed by an increasing sequence number.
+var (
+	signsBucket     = []byte("signs")
+	signKey         = []byte("sign")
+	createOrderKey  = []byte("create_order")
+	revisionsBucket = []byte("revisions")
+)
+
+type boltSignConfig struct {
+	broadcaster
+	db *bolt.DB
+}
+
+// NewBoltSignConfig returns a SignConfig backed by a BoltDB database at path,
+// which is created if it does not exist. Unlike the file-based SignConfig, it
+// keeps every revision of each sign's configuration. The returned SignConfig
+// also implements io.Closer.
+func NewBoltSignConfig(path string) (SignConfig, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("error opening configuration database: %v", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(signsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error initializing configuration database: %v", err)
+	}
+	return &boltSignConfig{db: db}, nil
+}
+
+func (sc *boltSignConfig) Close() error {
+	return sc.db.Close()
+}
+
+func (sc *boltSignConfig) List() ([]*pb.Sign, error) {
+	type orderedSign struct {
+		order uint64
+		sign  *pb.Sign
+	}
+	var ordered []orderedSign
+
+	err := sc.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(signsBucket).ForEach(func(id, _ []byte) error {
+			b := tx.Bucket(signsBucket).Bucket(id)
+			sign, err := readSign(b)
+			if err != nil {
+				return err
+			}
+			ordered = append(ordered, orderedSign{binary.BigEndian.Uint64(b.Get(createOrderKey)), sign})
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing signs: %v", err)
+	}
+
+	sort.Slice(ordered, func(i, j int) bool { return ordered[i].order < ordered[j].order })
+	signs := make([]*pb.Sign, len(ordered))
+	for i, o := range ordered {
+		signs[i] = o.sign
+	}
+	return signs, nil
+}
+
+func (sc *boltSignConfig) Create(id, name string) error {
+	if !ValidSignID(id) {
+		return fmt.Errorf("invalid sign ID %q", id)
+	}
+	return sc.db.Update(func(tx *bolt.Tx) error {
+		signs := tx.Bucket(signsBucket)
+		if signs.Bucket([]byte(id)) != nil {
+			return ErrExists
+		}
+		b, err := signs.CreateBucket([]byte(id))
+		if err != nil {
+			return fmt.Errorf("error creating sign: %v", err)
+		}
+		order, err := signs.NextSequence()
+		if err != nil {
+			return fmt.Errorf("error creating sign: %v", err)
+		}
+		if err := b.Put(createOrderKey, itob(order)); err != nil {
+			return fmt.Errorf("error creating sign: %v", err)
+		}
+		if _, err := b.CreateBucket(revisionsBucket); err != nil {
+			return fmt.Errorf("error creating sign: %v", err)
+		}
+		return writeSign(b, &pb.Sign{Id: id, Name: name, Configuration: emptyConfiguration()}, true)
+	})
+}
+
+func (sc *boltSignConfig) Rename(id, name string) error {
+	return sc.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(signsBucket).Bucket([]byte(id))
+		if b == nil {
+			return ErrNotFound
+		}
+		sign, err := readSign(b)
+		if err != nil {
+			return err
+		}
+		sign.Name = name
+		return writeSign(b, sign, false)
+	})
+}
+
+func (sc *boltSignConfig) Delete(id string) error {
+	var seq uint64
+	err := sc.db.Update(func(tx *bolt.Tx) error {
+		err := tx.Bucket(signsBucket).DeleteBucket([]byte(id))
+		if err == bolt.ErrBucketNotFound {
+			return ErrNotFound
+		}
+		// Write transactions run one at a time, so sequence numbers taken here
+		// follow the order of the commits.
+		seq = sc.next()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	sc.close(id, seq)
+	return nil
+}
+
+func (sc *boltSignConfig) Get(id string) (*pb.Configuration, string, error) {
+	var config *pb.Configuration
+	err := sc.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(signsBucket).Bucket([]byte(id))
+		if b == nil {
+			return ErrNotFound
+		}
+		sign, err := readSign(b)
+		if err != nil {
+			return err
+		}
+		config = signConfiguration(sign)
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return config, Revision(config), nil
+}
+
+func (sc *boltSignConfig) Put(id string, newConfig *pb.Configuration, rev string) (string, error) {
+	newConfig, err := Migrate(newConfig)
+	if err != nil {
+		return "", err
+	}
+	var seq uint64
+	err = sc.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(signsBucket).Bucket([]byte(id))
+		if b == nil {
+			return ErrNotFound
+		}
+		sign, err := readSign(b)
+		if err != nil {
+			return err
+		}
+		if rev != "" && Revision(signConfiguration(sign)) != rev {
+			return ErrConflict
+		}
+		sign.Configuration = newConfig
+		seq = sc.next()
+		return writeSign(b, sign, true)
+	})
+	if err != nil {
+		return "", err
+	}
+	newRev := Revision(newConfig)
+	sc.publish(id, seq, Update{Config: newConfig, Revision: newRev})
+	return newRev, nil
+}
+
+func (sc *boltSignConfig) Revisions(id string) ([]*pb.ConfigurationRevision, error) {
+	var revs []*pb.ConfigurationRevision
+	err := sc.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(signsBucket).Bucket([]byte(id))
+		if b == nil {
+			return ErrNotFound
+		}
+		c := b.Bucket(revisionsBucket).Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			r := &pb.ConfigurationRevision{}
+			if err := proto.Unmarshal(v, r); err != nil {
+				return fmt.Errorf("error unmarshalling revision: %v", err)
+			}
+			revs = append(revs, r)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return revs, nil
+}
+
+func (sc *boltSignConfig) RestoreRevisions(id string, revs []*pb.ConfigurationRevision) error {
+	return sc.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(signsBucket).Bucket([]byte(id))
+		if b == nil {
+			return ErrNotFound
+		}
+		if err := b.DeleteBucket(revisionsBucket); err != nil {
+			return fmt.Errorf("error clearing revisions: %v", err)
+		}
+		rb, err := b.CreateBucket(revisionsBucket)
+		if err != nil {
+			return fmt.Errorf("error clearing revisions: %v", err)
+		}
+		for i := len(revs) - 1; i >= 0; i-- {
+			data, err := proto.Marshal(revs[i])
+			if err != nil {
+				return fmt.Errorf("error marshalling revision: %v", err)
+			}
+			seq, err := rb.NextSequence()
+			if err != nil {
+				return fmt.Errorf("error storing revision: %v", err)
+			}
+			if err := rb.Put(itob(seq), data); err != nil {
+				return fmt.Errorf("error storing revision: %v", err)
+			}
+		}
+		return nil
+	})
+}
+
+func readSign(b *bolt.Bucket) (*pb.Sign, error) {
+	sign := &pb.Sign{}
+	if err := proto.Unmarshal(b.Get(signKey), sign); err != nil {
+		return nil, fmt.Errorf("error unmarshalling sign: %v", err)
+	}
+	config, err := Migrate(sign.GetConfiguration())
+	if err != nil {
+		return nil, err
+	}
+	sign.Configuration = config
+	return sign, nil
+}
+
+// writeSign stores a sign in its bucket. If newRevision is set, its
+// configuration is also appended to the sign's revision history.
+func writeSign(b *bolt.Bucket, sign *pb.Sign, newRevision bool) error {
+	data, err := proto.Marshal(sign)
+	if err != nil {
+		return fmt.Errorf("error marshalling sign: %v", err)
+	}
+	if err := b.Put(signKey, data); err != nil {
+		return fmt.Errorf("error storing sign: %v", err)
+	}
+	if !newRevision {
+		return nil
+	}
+
+	revs := b.Bucket(revisionsBucket)
+	seq, err := revs.NextSequence()
+	if err != nil {
+		return fmt.Errorf("error storing revision: %v", err)
+	}
+	config := signConfiguration(sign)
+	data, err = proto.Marshal(&pb.ConfigurationRevision{
+		Revision:      Revision(config),
+		CreateTime:    timeNow().Unix(),
+		Configuration: config,
+	})
+	if err != nil {
+		return fmt.Errorf("error marshalling revision: %v", err)
+	}
+	if err := revs.Put(itob(seq), data); err != nil {
+		return fmt.Errorf("error storing revision: %v", err)
+	}
+	return nil
+}
+
+// itob encodes v so that keys sort in numerical order.
+func itob(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
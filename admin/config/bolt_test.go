@@ -0,0 +1,97 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/wallaceicy06/muni-sign/proto"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	return dir
+}
+
+func newTestBoltSignConfig(t *testing.T, path string) SignConfig {
+	sc, err := NewBoltSignConfig(path)
+	if err != nil {
+		t.Fatalf("NewBoltSignConfig() = _, %v want _, <nil>", err)
+	}
+	return sc
+}
+
+func TestBoltSignConfig(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	var opened []SignConfig
+	defer func() {
+		for _, sc := range opened {
+			sc.(*boltSignConfig).Close()
+		}
+	}()
+
+	testSignConfig(t, func(t *testing.T) SignConfig {
+		sc := newTestBoltSignConfig(t, filepath.Join(dir, fmt.Sprintf("config%d.db", len(opened))))
+		opened = append(opened, sc)
+		return sc
+	})
+}
+
+func TestBoltRevisions(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	defer func() { timeNow = time.Now }()
+
+	path := filepath.Join(dir, "config.db")
+	sc := newTestBoltSignConfig(t, path)
+	if err := sc.Create("lobby", "Lobby"); err != nil {
+		t.Fatalf("sc.Create() = %v want <nil>", err)
+	}
+
+	cfgs := []*pb.Configuration{
+		{SchemaVersion: CurrentSchemaVersion, Agency: "sf-muni", Stops: []*pb.Stop{{Id: "1234"}}},
+		{SchemaVersion: CurrentSchemaVersion, Agency: "sf-muni", Stops: []*pb.Stop{{Id: "5678"}}},
+	}
+	for i, cfg := range cfgs {
+		timeNow = func() time.Time { return time.Unix(int64(1000*(i+1)), 0) }
+		if _, err := sc.Put("lobby", cfg, ""); err != nil {
+			t.Fatalf("sc.Put() = _, %v want _, <nil>", err)
+		}
+	}
+
+	// History must survive reopening the database.
+	sc.(*boltSignConfig).Close()
+	sc = newTestBoltSignConfig(t, path)
+	defer sc.(*boltSignConfig).Close()
+
+	got, err := sc.Revisions("lobby")
+	if err != nil {
+		t.Fatalf("sc.Revisions() = _, %v want _, <nil>", err)
+	}
+	want := []*pb.ConfigurationRevision{
+		{Revision: Revision(cfgs[1]), CreateTime: 2000, Configuration: cfgs[1]},
+		{Revision: Revision(cfgs[0]), CreateTime: 1000, Configuration: cfgs[0]},
+	}
+	// The first revision is the empty configuration the sign was created with.
+	if len(got) != len(want)+1 {
+		t.Fatalf("sc.Revisions() = %v, _ want %v followed by the initial revision, _", got, want)
+	}
+	for i := range want {
+		if !proto.Equal(got[i], want[i]) {
+			t.Errorf("sc.Revisions()[%d] = %v want %v", i, got[i], want[i])
+		}
+	}
+	if !proto.Equal(got[2].GetConfiguration(), &pb.Configuration{SchemaVersion: CurrentSchemaVersion}) {
+		t.Errorf("sc.Revisions()[2] = %v want empty configuration", got[2])
+	}
+}
@@ -1,10 +1,127 @@
 package config
 
 import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/golang/protobuf/proto"
+
 	pb "github.com/wallaceicy06/muni-sign/proto"
 )
 
+// DefaultSignID is the ID given to the sign whose configuration was stored
+// before the admin server could manage more than one sign.
+const DefaultSignID = "default"
+
+var (
+	// ErrConflict is returned by Put when the revision supplied by the caller
+	// does not match the revision of the stored configuration.
+	ErrConflict = errors.New("configuration was modified by someone else")
+
+	// ErrNotFound is returned when there is no sign with the requested ID.
+	ErrNotFound = errors.New("no such sign")
+
+	// ErrExists is returned by Create when a sign with the ID already exists.
+	ErrExists = errors.New("sign already exists")
+)
+
+var signIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// SignConfig stores the configurations of a fleet of signs, each identified by
+// a sign ID.
 type SignConfig interface {
-	Get() (*pb.Configuration, error)
-	Put(*pb.Configuration) error
+	// List returns every sign, in the order they were created.
+	List() ([]*pb.Sign, error)
+
+	// Create adds a sign with an empty configuration. The ID must satisfy
+	// ValidSignID.
+	Create(id, name string) error
+
+	// Rename changes the human-friendly name of a sign.
+	Rename(id, name string) error
+
+	// Delete removes a sign and its configuration.
+	Delete(id string) error
+
+	// Get returns the current configuration of a sign and its revision. The
+	// configuration is always upgraded to CurrentSchemaVersion.
+	Get(id string) (*pb.Configuration, string, error)
+
+	// Put replaces the current configuration of a sign and returns the new
+	// revision. If rev is non-empty and does not match the current revision,
+	// as computed by Revision, the configuration is left untouched and
+	// ErrConflict is returned. Older
+	// configurations are upgraded with Migrate before they are stored.
+	Put(id string, cfg *pb.Configuration, rev string) (string, error)
+
+	// Revisions returns the configurations a sign has had, newest first.
+	// Backends that do not keep history return only the current one.
+	Revisions(id string) ([]*pb.ConfigurationRevision, error)
+
+	// Watch subscribes to configuration changes of a sign. Every configuration
+	// stored after Watch is called is delivered on the returned channel,
+	// although a watcher that falls behind only receives the most recent one.
+	// Calling the returned function ends the subscription and closes the
+	// channel.
+	Watch(id string) (<-chan Update, func())
+}
+
+// ValidSignID reports whether id may be used to identify a sign. IDs appear in
+// URLs and command lines, so they are limited to lowercase letters, digits,
+// dashes and underscores.
+func ValidSignID(id string) bool {
+	return signIDPattern.MatchString(id)
+}
+
+// Revision computes an opaque revision string for a configuration. Equal
+// configurations always have equal revisions.
+//
+// Revisions identify content, not history: a configuration that is changed and
+// then changed back has its old revision again, so a Put made with that
+// revision succeeds. This is intended. Such a Put replaces exactly the
+// configuration that its caller read, so no change made in between is lost,
+// the same way as a strong HTTP ETag.
+func Revision(cfg *pb.Configuration) string {
+	sum := sha256.Sum256([]byte(proto.MarshalTextString(cfg)))
+	return fmt.Sprintf("%x", sum[:8])
+}
+
+// Copy stores every sign in src into dst, which should be empty. It is used to
+// move a fleet from one backend to another.
+func Copy(dst, src SignConfig) error {
+	signs, err := src.List()
+	if err != nil {
+		return err
+	}
+	for _, s := range signs {
+		if err := dst.Create(s.GetId(), s.GetName()); err != nil {
+			return fmt.Errorf("error copying sign %q: %v", s.GetId(), err)
+		}
+		if _, err := dst.Put(s.GetId(), signConfiguration(s), ""); err != nil {
+			return fmt.Errorf("error copying sign %q: %v", s.GetId(), err)
+		}
+	}
+	return nil
+}
+
+// findSign returns the index of the sign with the given ID in the fleet, or -1
+// if there is none.
+func findSign(fleet *pb.Fleet, id string) int {
+	for i, s := range fleet.GetSigns() {
+		if s.GetId() == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// signConfiguration returns the configuration of a sign, which is empty rather
+// than nil if the sign has never been configured.
+func signConfiguration(s *pb.Sign) *pb.Configuration {
+	if s.GetConfiguration() == nil {
+		return &pb.Configuration{}
+	}
+	return s.GetConfiguration()
 }
@@ -0,0 +1,346 @@
+package config
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/wallaceicy06/muni-sign/proto"
+)
+
+// testSignConfig checks the behavior that every SignConfig implementation must
+// share. newSignConfig returns an empty SignConfig for each subtest.
+func testSignConfig(t *testing.T, newSignConfig func(t *testing.T) SignConfig) {
+	t.Run("PutGet", func(t *testing.T) { testPutGet(t, newSignConfig(t)) })
+	t.Run("PutRevision", func(t *testing.T) { testPutRevision(t, newSignConfig) })
+	t.Run("ManageSigns", func(t *testing.T) { testManageSigns(t, newSignConfig(t)) })
+	t.Run("Revisions", func(t *testing.T) { testRevisions(t, newSignConfig(t)) })
+	t.Run("Watch", func(t *testing.T) { testWatch(t, newSignConfig(t)) })
+	t.Run("WatchSlowWatcher", func(t *testing.T) { testWatchSlowWatcher(t, newSignConfig(t)) })
+	t.Run("WatchConcurrentPuts", func(t *testing.T) { testWatchConcurrentPuts(t, newSignConfig(t)) })
+	t.Run("WatchDelete", func(t *testing.T) { testWatchDelete(t, newSignConfig(t)) })
+	t.Run("Copy", func(t *testing.T) { testCopy(t, newSignConfig(t), newSignConfig(t)) })
+}
+
+func testPutGet(t *testing.T, sc SignConfig) {
+	if err := sc.Create("default", "Default"); err != nil {
+		t.Fatalf("sc.Create() = %v want <nil>", err)
+	}
+
+	if got, _, err := sc.Get("default"); err != nil || !proto.Equal(got, &pb.Configuration{SchemaVersion: CurrentSchemaVersion}) {
+		t.Errorf("sc.Get(new sign) = %v, _, %v want {}, _, <nil>", got, err)
+	}
+
+	for _, cfg := range []*pb.Configuration{
+		{SchemaVersion: CurrentSchemaVersion, Agency: "sf-muni", Stops: []*pb.Stop{{Id: "1234"}}},
+		{SchemaVersion: CurrentSchemaVersion, Agency: "sf-muni", Stops: []*pb.Stop{{Id: "1234"}, {Id: "5678"}}},
+	} {
+		gotRev, err := sc.Put("default", cfg, "")
+		if err != nil {
+			t.Fatalf("sc.Put() = _, %v want _, <nil>", err)
+		}
+		if wantRev := Revision(cfg); gotRev != wantRev {
+			t.Errorf("sc.Put() = %q, _ want %q, _", gotRev, wantRev)
+		}
+
+		got, gotRev, err := sc.Get("default")
+		if err != nil {
+			t.Fatalf("sc.Get() = _, _, %v want _, _, <nil>", err)
+		}
+		if !proto.Equal(got, cfg) {
+			t.Errorf("sc.Get() = %v, _, _ want %v, _, _", got, cfg)
+		}
+		if wantRev := Revision(cfg); gotRev != wantRev {
+			t.Errorf("sc.Get() = _, %q, _ want _, %q, _", gotRev, wantRev)
+		}
+	}
+
+	if _, err := sc.Put("lobby", &pb.Configuration{SchemaVersion: CurrentSchemaVersion}, ""); err != ErrNotFound {
+		t.Errorf("sc.Put(unknown) = _, %v want _, %v", err, ErrNotFound)
+	}
+	if _, _, err := sc.Get("lobby"); err != ErrNotFound {
+		t.Errorf("sc.Get(unknown) = _, _, %v want _, _, %v", err, ErrNotFound)
+	}
+}
+
+func testPutRevision(t *testing.T, newSignConfig func(t *testing.T) SignConfig) {
+	oldCfg := &pb.Configuration{
+		SchemaVersion: CurrentSchemaVersion,
+		Agency:        "sf-muni",
+		Stops:         []*pb.Stop{{Id: "1234"}},
+	}
+	newCfg := &pb.Configuration{
+		SchemaVersion: CurrentSchemaVersion,
+		Agency:        "sf-muni",
+		Stops:         []*pb.Stop{{Id: "5678"}},
+	}
+
+	tests := []struct {
+		name string
+		// Configurations stored after oldCfg, before the Put with rev.
+		changes []*pb.Configuration
+		rev     string
+		wantCfg *pb.Configuration
+		wantErr error
+	}{
+		{
+			name:    "NoRevision",
+			rev:     "",
+			wantCfg: newCfg,
+		},
+		{
+			name:    "MatchingRevision",
+			rev:     Revision(oldCfg),
+			wantCfg: newCfg,
+		},
+		{
+			name:    "StaleRevision",
+			rev:     Revision(newCfg),
+			wantCfg: oldCfg,
+			wantErr: ErrConflict,
+		},
+		{
+			// Revisions identify content, so a configuration that was
+			// changed and then changed back matches its old revision.
+			name:    "ChangedBack",
+			changes: []*pb.Configuration{newCfg, oldCfg},
+			rev:     Revision(oldCfg),
+			wantCfg: newCfg,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sc := newSignConfig(t)
+			if err := sc.Create(DefaultSignID, "Default"); err != nil {
+				t.Fatalf("sc.Create() = %v want <nil>", err)
+			}
+			for _, c := range append([]*pb.Configuration{oldCfg}, test.changes...) {
+				if _, err := sc.Put(DefaultSignID, c, ""); err != nil {
+					t.Fatalf("sc.Put() = _, %v want _, <nil>", err)
+				}
+			}
+
+			if _, err := sc.Put(DefaultSignID, newCfg, test.rev); err != test.wantErr {
+				t.Errorf("sc.Put() = _, %v want _, %v", err, test.wantErr)
+			}
+
+			got, _, err := sc.Get(DefaultSignID)
+			if err != nil {
+				t.Fatalf("sc.Get() = _, _, %v want _, _, <nil>", err)
+			}
+			if !proto.Equal(got, test.wantCfg) {
+				t.Errorf("sc.Get() = %v, _, _ want %v, _, _", got, test.wantCfg)
+			}
+		})
+	}
+}
+
+func testManageSigns(t *testing.T, sc SignConfig) {
+	if signs, err := sc.List(); err != nil || len(signs) != 0 {
+		t.Fatalf("sc.List() on empty store = %v, %v want [], <nil>", signs, err)
+	}
+
+	for _, id := range []string{"kitchen", "lobby", "hallway"} {
+		if err := sc.Create(id, id); err != nil {
+			t.Fatalf("sc.Create(%q) = %v want <nil>", id, err)
+		}
+	}
+	if err := sc.Create("lobby", "Lobby"); err != ErrExists {
+		t.Errorf("sc.Create(duplicate) = %v want %v", err, ErrExists)
+	}
+	if err := sc.Create("Not Valid!", "Invalid"); err == nil {
+		t.Errorf("sc.Create(invalid) = <nil> want <non-nil>")
+	}
+
+	if err := sc.Rename("lobby", "Front Lobby"); err != nil {
+		t.Errorf("sc.Rename() = %v want <nil>", err)
+	}
+	if err := sc.Rename("garage", "Garage"); err != ErrNotFound {
+		t.Errorf("sc.Rename(unknown) = %v want %v", err, ErrNotFound)
+	}
+
+	if err := sc.Delete("kitchen"); err != nil {
+		t.Errorf("sc.Delete() = %v want <nil>", err)
+	}
+	if err := sc.Delete("kitchen"); err != ErrNotFound {
+		t.Errorf("sc.Delete(deleted) = %v want %v", err, ErrNotFound)
+	}
+
+	got, err := sc.List()
+	if err != nil {
+		t.Fatalf("sc.List() = _, %v want _, <nil>", err)
+	}
+	want := []*pb.Sign{
+		{Id: "lobby", Name: "Front Lobby", Configuration: &pb.Configuration{SchemaVersion: CurrentSchemaVersion}},
+		{Id: "hallway", Name: "hallway", Configuration: &pb.Configuration{SchemaVersion: CurrentSchemaVersion}},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("sc.List() = %v, _ want %v, _", got, want)
+	}
+	for i := range want {
+		if !proto.Equal(got[i], want[i]) {
+			t.Errorf("sc.List()[%d] = %v want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func testRevisions(t *testing.T, sc SignConfig) {
+	if err := sc.Create("lobby", "Lobby"); err != nil {
+		t.Fatalf("sc.Create() = %v want <nil>", err)
+	}
+	cfg := &pb.Configuration{SchemaVersion: CurrentSchemaVersion, Agency: "sf-muni", Stops: []*pb.Stop{{Id: "1234"}}}
+	if _, err := sc.Put("lobby", cfg, ""); err != nil {
+		t.Fatalf("sc.Put() = _, %v want _, <nil>", err)
+	}
+
+	revs, err := sc.Revisions("lobby")
+	if err != nil {
+		t.Fatalf("sc.Revisions() = _, %v want _, <nil>", err)
+	}
+	if len(revs) == 0 {
+		t.Fatalf("sc.Revisions() = [], _ want at least one revision")
+	}
+	if got := revs[0]; !proto.Equal(got.GetConfiguration(), cfg) || got.GetRevision() != Revision(cfg) {
+		t.Errorf("sc.Revisions()[0] = %v want current configuration %v", got, cfg)
+	}
+
+	if _, err := sc.Revisions("garage"); err != ErrNotFound {
+		t.Errorf("sc.Revisions(unknown) = _, %v want _, %v", err, ErrNotFound)
+	}
+}
+
+func testWatch(t *testing.T, sc SignConfig) {
+	for _, id := range []string{"kitchen", "lobby"} {
+		if err := sc.Create(id, id); err != nil {
+			t.Fatalf("sc.Create() = %v want <nil>", err)
+		}
+	}
+
+	updates, cancel := sc.Watch("lobby")
+
+	if _, err := sc.Put("kitchen", &pb.Configuration{SchemaVersion: CurrentSchemaVersion, Agency: "sf-muni"}, ""); err != nil {
+		t.Fatalf("sc.Put() = _, %v want _, <nil>", err)
+	}
+	cfg := &pb.Configuration{SchemaVersion: CurrentSchemaVersion, Agency: "sf-muni", Stops: []*pb.Stop{{Id: "1234"}}}
+	rev, err := sc.Put("lobby", cfg, "")
+	if err != nil {
+		t.Fatalf("sc.Put() = _, %v want _, <nil>", err)
+	}
+
+	got := <-updates
+	if !proto.Equal(got.Config, cfg) || got.Revision != rev {
+		t.Errorf("<-updates = %v want {%v %s}", got, cfg, rev)
+	}
+
+	cancel()
+	if _, ok := <-updates; ok {
+		t.Errorf("updates channel still open after cancel")
+	}
+}
+
+func testWatchSlowWatcher(t *testing.T, sc SignConfig) {
+	if err := sc.Create("lobby", "Lobby"); err != nil {
+		t.Fatalf("sc.Create() = %v want <nil>", err)
+	}
+
+	updates, cancel := sc.Watch("lobby")
+	defer cancel()
+
+	var last *pb.Configuration
+	for _, stop := range []string{"1234", "5678", "9012"} {
+		last = &pb.Configuration{SchemaVersion: CurrentSchemaVersion, Agency: "sf-muni", Stops: []*pb.Stop{{Id: stop}}}
+		if _, err := sc.Put("lobby", last, ""); err != nil {
+			t.Fatalf("sc.Put() = _, %v want _, <nil>", err)
+		}
+	}
+
+	if got := <-updates; !proto.Equal(got.Config, last) {
+		t.Errorf("<-updates = %v want %v", got.Config, last)
+	}
+	select {
+	case u := <-updates:
+		t.Errorf("got unexpected extra update %v", u)
+	default:
+	}
+}
+
+func testWatchConcurrentPuts(t *testing.T, sc SignConfig) {
+	if err := sc.Create("lobby", "Lobby"); err != nil {
+		t.Fatalf("sc.Create() = %v want <nil>", err)
+	}
+
+	updates, cancel := sc.Watch("lobby")
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			cfg := &pb.Configuration{SchemaVersion: CurrentSchemaVersion, Agency: "sf-muni", Stops: []*pb.Stop{{Id: fmt.Sprint(i)}}}
+			if _, err := sc.Put("lobby", cfg, ""); err != nil {
+				t.Errorf("sc.Put() = _, %v want _, <nil>", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	_, rev, err := sc.Get("lobby")
+	if err != nil {
+		t.Fatalf("sc.Get() = _, _, %v want _, _, <nil>", err)
+	}
+	if got := <-updates; got.Revision != rev {
+		t.Errorf("last update has revision %s want stored revision %s", got.Revision, rev)
+	}
+}
+
+func testWatchDelete(t *testing.T, sc SignConfig) {
+	if err := sc.Create("lobby", "Lobby"); err != nil {
+		t.Fatalf("sc.Create() = %v want <nil>", err)
+	}
+
+	updates, cancel := sc.Watch("lobby")
+	defer cancel()
+
+	if err := sc.Delete("lobby"); err != nil {
+		t.Fatalf("sc.Delete() = %v want <nil>", err)
+	}
+	if u, ok := <-updates; ok {
+		t.Errorf("got update %v after delete want closed channel", u)
+	}
+}
+
+func testCopy(t *testing.T, dst, src SignConfig) {
+	want := []*pb.Sign{
+		{Id: "kitchen", Name: "Kitchen", Configuration: &pb.Configuration{SchemaVersion: CurrentSchemaVersion, Agency: "sf-muni", Stops: []*pb.Stop{{Id: "1234"}}}},
+		{Id: "lobby", Name: "Lobby", Configuration: &pb.Configuration{SchemaVersion: CurrentSchemaVersion}},
+	}
+	for _, s := range want {
+		if err := src.Create(s.Id, s.Name); err != nil {
+			t.Fatalf("src.Create() = %v want <nil>", err)
+		}
+		if _, err := src.Put(s.Id, s.Configuration, ""); err != nil {
+			t.Fatalf("src.Put() = _, %v want _, <nil>", err)
+		}
+	}
+
+	if err := Copy(dst, src); err != nil {
+		t.Fatalf("Copy() = %v want <nil>", err)
+	}
+
+	got, err := dst.List()
+	if err != nil {
+		t.Fatalf("dst.List() = _, %v want _, <nil>", err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("dst.List() = %v, _ want %v, _", got, want)
+	}
+	for i := range want {
+		if !proto.Equal(got[i], want[i]) {
+			t.Errorf("dst.List()[%d] = %v want %v", i, got[i], want[i])
+		}
+	}
+}
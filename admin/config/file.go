@@ -1,9 +1,12 @@
 package config
 
 import (
+	"crypto/sha256"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"os"
+	"sync"
 
 	"github.com/golang/protobuf/proto"
 	"github.com/spf13/afero"
@@ -12,56 +15,295 @@ import (
 )
 
 type fileSignConfig struct {
-	path string
+	broadcaster
+	path   string
+	format fileFormat
+
+	// Serializes updates, so that concurrent requests cannot interleave their
+	// reads and writes of the file. Also guards the fields below.
+	mu sync.Mutex
+
+	// The last fleet successfully read from or written to the file, which is
+	// served in place of the file's contents while they are invalid.
+	good *pb.Fleet
+
+	// A hash of the file contents last read or written, used to tell when
+	// someone else has edited the file.
+	seen [sha256.Size]byte
 }
 
+// NewFileSignConfig returns a SignConfig that stores the whole fleet as a
+// Fleet proto in the file at path, in the format given by the file's
+// extension. A file holding a single Configuration, as written before fleets
+// were supported, is read as a fleet containing only the default sign.
 func NewFileSignConfig(path string) SignConfig {
-	return &fileSignConfig{path: path}
+	return &fileSignConfig{path: path, format: formatOf(path)}
 }
 
 var fs afero.Fs = afero.NewOsFs()
 
-func (sc *fileSignConfig) Get() (*pb.Configuration, error) {
-	config, err := readConfigFile(sc.path)
+func (sc *fileSignConfig) List() ([]*pb.Sign, error) {
+	sc.mu.Lock()
+	fleet, err := sc.load()
+	sc.mu.Unlock()
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error listing signs: %v", err)
+	}
+	return fleet.GetSigns(), nil
+}
+
+func (sc *fileSignConfig) Create(id, name string) error {
+	if !ValidSignID(id) {
+		return fmt.Errorf("invalid sign ID %q", id)
+	}
+	return sc.update(func(fleet *pb.Fleet) error {
+		if findSign(fleet, id) >= 0 {
+			return ErrExists
+		}
+		fleet.Signs = append(fleet.Signs, &pb.Sign{
+			Id:            id,
+			Name:          name,
+			Configuration: emptyConfiguration(),
+		})
+		return nil
+	})
+}
+
+func (sc *fileSignConfig) Rename(id, name string) error {
+	return sc.update(func(fleet *pb.Fleet) error {
+		i := findSign(fleet, id)
+		if i < 0 {
+			return ErrNotFound
+		}
+		fleet.Signs[i].Name = name
+		return nil
+	})
+}
+
+func (sc *fileSignConfig) Delete(id string) error {
+	var seq uint64
+	err := sc.update(func(fleet *pb.Fleet) error {
+		i := findSign(fleet, id)
+		if i < 0 {
+			return ErrNotFound
+		}
+		fleet.Signs = append(fleet.Signs[:i], fleet.Signs[i+1:]...)
+		seq = sc.next()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sc.close(id, seq)
+	return nil
+}
+
+func (sc *fileSignConfig) Get(id string) (*pb.Configuration, string, error) {
+	sc.mu.Lock()
+	fleet, err := sc.load()
+	sc.mu.Unlock()
 	if err != nil {
-		return nil, fmt.Errorf("error getting configuration: %v", err)
+		return nil, "", fmt.Errorf("error getting configuration: %v", err)
+	}
+	i := findSign(fleet, id)
+	if i < 0 {
+		return nil, "", ErrNotFound
 	}
-	return config, nil
+	config := signConfiguration(fleet.Signs[i])
+	return config, Revision(config), nil
 }
 
-func (sc *fileSignConfig) Put(newConfig *pb.Configuration) error {
-	if err := writeConfigFile(sc.path, newConfig); err != nil {
+func (sc *fileSignConfig) Put(id string, newConfig *pb.Configuration, rev string) (string, error) {
+	newConfig, err := Migrate(newConfig)
+	if err != nil {
+		return "", err
+	}
+	var seq uint64
+	err = sc.update(func(fleet *pb.Fleet) error {
+		i := findSign(fleet, id)
+		if i < 0 {
+			return ErrNotFound
+		}
+		if rev != "" && Revision(signConfiguration(fleet.Signs[i])) != rev {
+			return ErrConflict
+		}
+		fleet.Signs[i].Configuration = newConfig
+		seq = sc.next()
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	newRev := Revision(newConfig)
+	sc.publish(id, seq, Update{Config: newConfig, Revision: newRev})
+	return newRev, nil
+}
+
+func (sc *fileSignConfig) Revisions(id string) ([]*pb.ConfigurationRevision, error) {
+	config, rev, err := sc.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	info, err := fs.Stat(sc.path)
+	if err != nil {
+		return nil, fmt.Errorf("error getting revisions: %v", err)
+	}
+	return []*pb.ConfigurationRevision{{
+		Revision:      rev,
+		CreateTime:    info.ModTime().Unix(),
+		Configuration: config,
+	}}, nil
+}
+
+// update applies fn to the stored fleet and writes the result back. A missing
+// file is treated as an empty fleet. Errors returned by fn are passed through
+// unchanged so that callers can compare them against ErrNotFound and friends.
+func (sc *fileSignConfig) update(fn func(*pb.Fleet) error) error {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	unlock, err := lockFile(sc.path)
+	if err != nil {
 		return fmt.Errorf("error updating configuration: %v", err)
 	}
+	defer unlock()
+
+	fleet, err := sc.load()
+	if os.IsNotExist(err) {
+		fleet, err = &pb.Fleet{}, nil
+	}
+	if err != nil {
+		return fmt.Errorf("error updating configuration: %v", err)
+	}
+	if err := fn(fleet); err != nil {
+		return err
+	}
+	data, err := sc.format.marshal(fleet)
+	if err != nil {
+		return fmt.Errorf("error marshalling config proto: %v", err)
+	}
+	if err := writeConfigFile(sc.path, data); err != nil {
+		return fmt.Errorf("error updating configuration: %v", err)
+	}
+	sc.good = proto.Clone(fleet).(*pb.Fleet)
+	sc.seen = sha256.Sum256(data)
 	return nil
 }
 
-func readConfigFile(path string) (*pb.Configuration, error) {
+// load reads the fleet from the file. The caller must hold sc.mu.
+//
+// If the file was changed by someone else since it was last read, the signs
+// whose configuration changed are published to watchers. If the file no longer
+// parses, the error is logged and the last good fleet is returned instead.
+// The returned fleet belongs to the caller.
+func (sc *fileSignConfig) load() (*pb.Fleet, error) {
+	data, err := readConfigFile(sc.path)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	if sum == sc.seen && sc.good != nil {
+		return proto.Clone(sc.good).(*pb.Fleet), nil
+	}
+
+	fleet, err := parseConfig(sc.format, data)
+	if err != nil {
+		if sc.good == nil {
+			return nil, err
+		}
+		if sum != sc.seen {
+			log.Printf("Ignoring invalid edit to %s, keeping the last good configuration: %v", sc.path, err)
+			sc.seen = sum
+		}
+		return proto.Clone(sc.good).(*pb.Fleet), nil
+	}
+
+	if sc.good != nil {
+		sc.publishChanges(sc.good, fleet)
+	}
+	sc.good = fleet
+	sc.seen = sum
+	return proto.Clone(fleet).(*pb.Fleet), nil
+}
+
+// publishChanges notifies watchers of every sign whose configuration differs
+// between the old and new fleets.
+func (sc *fileSignConfig) publishChanges(old, new *pb.Fleet) {
+	for _, s := range new.GetSigns() {
+		config := signConfiguration(s)
+		rev := Revision(config)
+		if i := findSign(old, s.GetId()); i >= 0 && Revision(signConfiguration(old.Signs[i])) == rev {
+			continue
+		}
+		sc.publish(s.GetId(), sc.next(), Update{Config: config, Revision: rev})
+	}
+}
+
+// readConfigFile reads the raw contents of the file at path. If the file does
+// not exist, the returned error satisfies os.IsNotExist.
+func readConfigFile(path string) ([]byte, error) {
 	f, err := fs.Open(path)
 	if err != nil {
-		return nil, fmt.Errorf("error opening configuration file: %v", err)
+		return nil, err
 	}
+	defer f.Close()
 	data, err := ioutil.ReadAll(f)
 	if err != nil {
 		return nil, fmt.Errorf("error reading configuration: %v", err)
 	}
-	parsedConfig := &pb.Configuration{}
-	if err := proto.UnmarshalText(string(data), parsedConfig); err != nil {
-		return nil, fmt.Errorf("error unmarshalling config proto: %v", err)
+	return data, nil
+}
+
+// parseConfig parses the contents of a configuration file in the given format.
+func parseConfig(format fileFormat, data []byte) (*pb.Fleet, error) {
+	fleet := &pb.Fleet{}
+	fleetErr := format.unmarshal(data, fleet)
+	if fleetErr != nil {
+		// Fall back to the format used before fleets were supported.
+		parsedConfig := &pb.Configuration{}
+		if err := format.unmarshal(data, parsedConfig); err != nil {
+			return nil, fmt.Errorf("error unmarshalling config proto: %v", fleetErr)
+		}
+		fleet = &pb.Fleet{
+			Signs: []*pb.Sign{{
+				Id:            DefaultSignID,
+				Name:          "Default",
+				Configuration: parsedConfig,
+			}},
+		}
+	}
+
+	if err := migrateFleet(fleet); err != nil {
+		return nil, err
 	}
-	return parsedConfig, nil
+	return fleet, nil
 }
 
-func writeConfigFile(path string, newConfig *pb.Configuration) error {
-	f, err := fs.Create(path)
+// writeConfigFile replaces the contents of the file at path. They are written
+// to a temporary file that is renamed over the old one once it is safely on
+// disk, so a crash leaves either the old or the new contents behind, never a
+// mix of the two.
+func writeConfigFile(path string, data []byte) error {
+	tmpPath := path + ".tmp"
+	f, err := fs.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
 	if err != nil {
 		return fmt.Errorf("error opening configuration file: %v", err)
 	}
-	defer func() {
-		if err := f.Close(); err != nil {
-			log.Fatalf("Error closing config file: %v", err)
-		}
-	}()
-	proto.MarshalText(f, newConfig)
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = fs.Rename(tmpPath, path)
+	}
+	if err != nil {
+		fs.Remove(tmpPath)
+		return fmt.Errorf("error writing configuration file: %v", err)
+	}
 	return nil
 }
@@ -1,6 +1,12 @@
 package config
 
 import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
 
 	"github.com/golang/protobuf/proto"
@@ -13,13 +19,19 @@ func TestGet(t *testing.T) {
 	goodFilePath := "/path/to/file"
 	badFilePath := "/this/file/is/bad"
 
-	goodCfg := `agency: "sf-muni"
-			   stop_ids: "1234"`
+	goodCfg := `signs {
+				  id: "default"
+				  configuration {
+				    agency: "sf-muni"
+				    stop_ids: "1234"
+				  }
+				}`
 
 	tests := []struct {
 		name     string
 		filePath string
 		fileData string
+		signID   string
 		wantCfg  *pb.Configuration
 		wantErr  bool
 	}{
@@ -27,26 +39,80 @@ func TestGet(t *testing.T) {
 			name:     "Simple",
 			filePath: goodFilePath,
 			fileData: goodCfg,
+			signID:   "default",
 			wantCfg: &pb.Configuration{
-				Agency:  "sf-muni",
-				StopIds: []string{"1234"},
+				SchemaVersion: CurrentSchemaVersion,
+				Agency:        "sf-muni",
+				Stops:         []*pb.Stop{{Id: "1234"}},
 			},
 		},
 		{
 			name:     "MultipleStops",
 			filePath: goodFilePath,
+			fileData: `signs {
+						 id: "default"
+						 configuration {
+						   agency: "sf-muni"
+						   stop_ids: "1234",
+						   stop_ids: "5678"
+						 }
+					   }`,
+			signID: "default",
+			wantCfg: &pb.Configuration{
+				SchemaVersion: CurrentSchemaVersion,
+				Agency:        "sf-muni",
+				Stops:         []*pb.Stop{{Id: "1234"}, {Id: "5678"}},
+			},
+		},
+		{
+			name:     "MultipleSigns",
+			filePath: goodFilePath,
+			fileData: `signs {
+						 id: "kitchen"
+						 configuration { agency: "sf-muni" stop_ids: "1234" }
+					   }
+					   signs {
+						 id: "lobby"
+						 configuration { agency: "actransit" stop_ids: "5678" }
+					   }`,
+			signID: "lobby",
+			wantCfg: &pb.Configuration{
+				SchemaVersion: CurrentSchemaVersion,
+				Agency:        "actransit",
+				Stops:         []*pb.Stop{{Id: "5678"}},
+			},
+		},
+		{
+			name:     "UnconfiguredSign",
+			filePath: goodFilePath,
+			fileData: `signs { id: "default" }`,
+			signID:   "default",
+			wantCfg:  &pb.Configuration{SchemaVersion: CurrentSchemaVersion},
+		},
+		{
+			name:     "LegacyConfig",
+			filePath: goodFilePath,
 			fileData: `agency: "sf-muni"
-					   stop_ids: "1234",
-					   stop_ids: "5678"`,
+					   stop_ids: "1234"`,
+			signID: DefaultSignID,
 			wantCfg: &pb.Configuration{
-				Agency:  "sf-muni",
-				StopIds: []string{"1234", "5678"},
+				SchemaVersion: CurrentSchemaVersion,
+				Agency:        "sf-muni",
+				Stops:         []*pb.Stop{{Id: "1234"}},
 			},
 		},
+		{
+			name:     "UnknownSign",
+			filePath: goodFilePath,
+			fileData: goodCfg,
+			signID:   "lobby",
+			wantErr:  true,
+		},
 		{
 			name:     "InvalidPath",
 			filePath: badFilePath,
 			fileData: goodCfg,
+			signID:   "default",
 			wantErr:  true,
 		},
 
@@ -54,6 +120,7 @@ func TestGet(t *testing.T) {
 			name:     "InvalidConfig",
 			filePath: goodFilePath,
 			fileData: `agency: 1234`,
+			signID:   "default",
 			wantErr:  true,
 		},
 	}
@@ -64,20 +131,23 @@ func TestGet(t *testing.T) {
 			afero.WriteFile(fs, goodFilePath, []byte(test.fileData), 0644)
 
 			sc := NewFileSignConfig(test.filePath)
-			got, err := sc.Get()
+			got, gotRev, err := sc.Get(test.signID)
 
 			if test.wantErr {
 				if err == nil {
-					t.Errorf("sc.Get() = _, <nil> want _, <non-nil>")
+					t.Errorf("sc.Get() = _, _, <nil> want _, _, <non-nil>")
 				}
 				return
 			}
 
 			if err != nil {
-				t.Errorf("sc.Get() = _, %v want _, <nil>", err)
+				t.Errorf("sc.Get() = _, _, %v want _, _, <nil>", err)
 			}
 			if !proto.Equal(got, test.wantCfg) {
-				t.Errorf("sc.Get() = %v, _ want %v, _", got, test.wantCfg)
+				t.Errorf("sc.Get() = %v, _, _ want %v, _, _", got, test.wantCfg)
+			}
+			if wantRev := Revision(test.wantCfg); gotRev != wantRev {
+				t.Errorf("sc.Get() = _, %q, _ want _, %q, _", gotRev, wantRev)
 			}
 		})
 	}
@@ -87,29 +157,40 @@ func TestPut(t *testing.T) {
 	goodFilePath := "/path/to/file"
 
 	goodCfg := &pb.Configuration{
-		Agency:  "sf-muni",
-		StopIds: []string{"1234"},
+		SchemaVersion: CurrentSchemaVersion,
+		Agency:        "sf-muni",
+		Stops:         []*pb.Stop{{Id: "1234"}},
 	}
 
 	tests := []struct {
-		name         string
-		cfg          *pb.Configuration
-		filePath     string
-		wantFileData string
-		wantErr      bool
+		name     string
+		cfg      *pb.Configuration
+		signID   string
+		filePath string
+		wantErr  error
 	}{
 		{
 			name:     "Simple",
 			cfg:      goodCfg,
+			signID:   "default",
 			filePath: goodFilePath,
 		},
 		{
 			name: "MultipleStops",
 			cfg: &pb.Configuration{
-				Agency:  "sf-muni",
-				StopIds: []string{"1234", "5678"},
+				SchemaVersion: CurrentSchemaVersion,
+				Agency:        "sf-muni",
+				Stops:         []*pb.Stop{{Id: "1234"}, {Id: "5678"}},
 			},
+			signID:   "default",
+			filePath: goodFilePath,
+		},
+		{
+			name:     "UnknownSign",
+			cfg:      goodCfg,
+			signID:   "lobby",
 			filePath: goodFilePath,
+			wantErr:  ErrNotFound,
 		},
 	}
 
@@ -118,24 +199,32 @@ func TestPut(t *testing.T) {
 			fs = afero.NewMemMapFs()
 
 			sc := NewFileSignConfig(test.filePath)
-			err := sc.Put(test.cfg)
+			if err := sc.Create("default", "Default"); err != nil {
+				t.Fatalf("sc.Create() = %v want <nil>", err)
+			}
+			gotRev, err := sc.Put(test.signID, test.cfg, "")
 
-			if test.wantErr {
-				if err == nil {
-					t.Errorf("sc.Put() = <nil> want <non-nil>")
+			if test.wantErr != nil {
+				if err != test.wantErr {
+					t.Errorf("sc.Put() = _, %v want _, %v", err, test.wantErr)
 				}
 				return
 			}
 
 			if err != nil {
-				t.Errorf("sc.Put() = %v want <nil>", err)
+				t.Errorf("sc.Put() = _, %v want _, <nil>", err)
+			}
+			if wantRev := Revision(test.cfg); gotRev != wantRev {
+				t.Errorf("sc.Put() = %q, _ want %q, _", gotRev, wantRev)
 			}
 
 			gotBytes, err := afero.ReadFile(fs, goodFilePath)
 			if err != nil {
 				t.Errorf("error reading config file: %v", err)
 			}
-			want := proto.MarshalTextString(test.cfg)
+			want := proto.MarshalTextString(&pb.Fleet{
+				Signs: []*pb.Sign{{Id: "default", Name: "Default", Configuration: test.cfg}},
+			})
 			got := string(gotBytes)
 			if got != want {
 				t.Errorf("config files differ: got %v want %v", got, want)
@@ -143,3 +232,223 @@ func TestPut(t *testing.T) {
 		})
 	}
 }
+
+func TestFileSignConfig(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	n := 0
+	testSignConfig(t, func(t *testing.T) SignConfig {
+		n++
+		return NewFileSignConfig(fmt.Sprintf("/path/to/file%d", n))
+	})
+}
+
+func TestFileSignConfigLegacyPut(t *testing.T) {
+	filePath := "/path/to/file"
+	oldCfg := &pb.Configuration{SchemaVersion: CurrentSchemaVersion, Agency: "sf-muni", Stops: []*pb.Stop{{Id: "1234"}}}
+	newCfg := &pb.Configuration{SchemaVersion: CurrentSchemaVersion, Agency: "sf-muni", Stops: []*pb.Stop{{Id: "5678"}}}
+
+	fs = afero.NewMemMapFs()
+	afero.WriteFile(fs, filePath, []byte(proto.MarshalTextString(oldCfg)), 0644)
+
+	sc := NewFileSignConfig(filePath)
+	if _, err := sc.Put(DefaultSignID, newCfg, Revision(oldCfg)); err != nil {
+		t.Fatalf("sc.Put() = _, %v want _, <nil>", err)
+	}
+
+	got, _, err := sc.Get(DefaultSignID)
+	if err != nil {
+		t.Fatalf("sc.Get() = _, _, %v want _, _, <nil>", err)
+	}
+	if !proto.Equal(got, newCfg) {
+		t.Errorf("sc.Get() = %v, _, _ want %v, _, _", got, newCfg)
+	}
+}
+
+func TestValidSignID(t *testing.T) {
+	tests := []struct {
+		id   string
+		want bool
+	}{
+		{"default", true},
+		{"lobby-2", true},
+		{"front_door", true},
+		{"", false},
+		{"Lobby", false},
+		{"-lobby", false},
+		{"lobby/2", false},
+		{"lobby 2", false},
+	}
+
+	for _, test := range tests {
+		if got := ValidSignID(test.id); got != test.want {
+			t.Errorf("ValidSignID(%q) = %t want %t", test.id, got, test.want)
+		}
+	}
+}
+
+// faultyFs is a filesystem whose writes fail in the ways set by its fields.
+type faultyFs struct {
+	afero.Fs
+	writeErr  error
+	syncErr   error
+	closeErr  error
+	renameErr error
+}
+
+type faultyFile struct {
+	afero.File
+	fs *faultyFs
+}
+
+func (ffs *faultyFs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	f, err := ffs.Fs.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &faultyFile{f, ffs}, nil
+}
+
+func (ffs *faultyFs) Rename(oldname, newname string) error {
+	if ffs.renameErr != nil {
+		return ffs.renameErr
+	}
+	return ffs.Fs.Rename(oldname, newname)
+}
+
+func (ff *faultyFile) Write(p []byte) (int, error) {
+	if ff.fs.writeErr != nil {
+		// Simulate a short write before the failure.
+		n, _ := ff.File.Write(p[:len(p)/2])
+		return n, ff.fs.writeErr
+	}
+	return ff.File.Write(p)
+}
+
+func (ff *faultyFile) Sync() error {
+	if ff.fs.syncErr != nil {
+		return ff.fs.syncErr
+	}
+	return ff.File.Sync()
+}
+
+func (ff *faultyFile) Close() error {
+	err := ff.File.Close()
+	if ff.fs.closeErr != nil {
+		return ff.fs.closeErr
+	}
+	return err
+}
+
+func TestPutWriteFailure(t *testing.T) {
+	filePath := "/path/to/file"
+	oldCfg := &pb.Configuration{SchemaVersion: CurrentSchemaVersion, Agency: "sf-muni", Stops: []*pb.Stop{{Id: "1234"}}}
+	newCfg := &pb.Configuration{SchemaVersion: CurrentSchemaVersion, Agency: "sf-muni", Stops: []*pb.Stop{{Id: "5678"}}}
+	fault := errors.New("disk on fire")
+
+	tests := []struct {
+		name string
+		fs   *faultyFs
+	}{
+		{name: "Write", fs: &faultyFs{writeErr: fault}},
+		{name: "Sync", fs: &faultyFs{syncErr: fault}},
+		{name: "Close", fs: &faultyFs{closeErr: fault}},
+		{name: "Rename", fs: &faultyFs{renameErr: fault}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.fs.Fs = afero.NewMemMapFs()
+			fs = test.fs
+			oldData := proto.MarshalTextString(&pb.Fleet{
+				Signs: []*pb.Sign{{Id: DefaultSignID, Name: "Default", Configuration: oldCfg}},
+			})
+			afero.WriteFile(test.fs.Fs, filePath, []byte(oldData), 0644)
+
+			sc := NewFileSignConfig(filePath)
+			updates, cancel := sc.Watch(DefaultSignID)
+			defer cancel()
+
+			if _, err := sc.Put(DefaultSignID, newCfg, ""); err == nil {
+				t.Errorf("sc.Put() = _, <nil> want _, <non-nil>")
+			}
+
+			got, err := afero.ReadFile(test.fs.Fs, filePath)
+			if err != nil {
+				t.Fatalf("error reading config file: %v", err)
+			}
+			if string(got) != oldData {
+				t.Errorf("config file = %q after failed write want %q", got, oldData)
+			}
+			if exists, _ := afero.Exists(test.fs.Fs, filePath+".tmp"); exists {
+				t.Errorf("temporary file left behind after failed write")
+			}
+			select {
+			case u := <-updates:
+				t.Errorf("failed write published update %v", u)
+			default:
+			}
+		})
+	}
+}
+
+func TestConcurrentUpdates(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	sc := NewFileSignConfig("/path/to/file")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			id := fmt.Sprintf("sign%d", i)
+			if err := sc.Create(id, id); err != nil {
+				t.Errorf("sc.Create(%q) = %v want <nil>", id, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	signs, err := sc.List()
+	if err != nil {
+		t.Fatalf("sc.List() = _, %v want _, <nil>", err)
+	}
+	if len(signs) != 20 {
+		t.Errorf("sc.List() returned %d signs after concurrent creates want 20", len(signs))
+	}
+}
+
+func TestConcurrentUpdatesOsFs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	fs = afero.NewOsFs()
+	defer func() { fs = afero.NewMemMapFs() }()
+
+	// Two SignConfigs on the same file stand in for two processes, which only
+	// the file lock keeps apart.
+	path := filepath.Join(dir, "config.pb.txt")
+	scs := []SignConfig{NewFileSignConfig(path), NewFileSignConfig(path)}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			id := fmt.Sprintf("sign%d", i)
+			if err := scs[i%2].Create(id, id); err != nil {
+				t.Errorf("sc.Create(%q) = %v want <nil>", id, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	signs, err := scs[0].List()
+	if err != nil {
+		t.Fatalf("sc.List() = _, %v want _, <nil>", err)
+	}
+	if len(signs) != 20 {
+		t.Errorf("sc.List() returned %d signs after concurrent creates want 20", len(signs))
+	}
+}
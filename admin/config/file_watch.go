@@ -0,0 +1,70 @@
+package config
+
+import (
+	"log"
+	"os"
+	"time"
+)
+
+type watchedFileSignConfig struct {
+	*fileSignConfig
+	done    chan struct{}
+	stopped chan struct{}
+
+	// The error from the last check, so that a file that cannot be read is
+	// only reported once. Guarded by mu.
+	lastErr string
+}
+
+// NewWatchedFileSignConfig returns a file-based SignConfig that also notices
+// when someone else edits the file, for example over SSH. The file is checked
+// every interval, and configurations changed by a valid edit are published to
+// watchers. Invalid edits are logged and otherwise ignored, and the last good
+// configuration is served until the file is fixed. Closing the returned
+// SignConfig, which implements io.Closer, stops the checks.
+func NewWatchedFileSignConfig(path string, interval time.Duration) SignConfig {
+	sc := &watchedFileSignConfig{
+		fileSignConfig: NewFileSignConfig(path).(*fileSignConfig),
+		done:           make(chan struct{}),
+		stopped:        make(chan struct{}),
+	}
+	sc.check()
+	go sc.poll(interval)
+	return sc
+}
+
+func (sc *watchedFileSignConfig) Close() error {
+	close(sc.done)
+	<-sc.stopped
+	return nil
+}
+
+func (sc *watchedFileSignConfig) poll(interval time.Duration) {
+	defer close(sc.stopped)
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			sc.check()
+		case <-sc.done:
+			return
+		}
+	}
+}
+
+// check reloads the file, which publishes any changes made since it was last
+// read.
+func (sc *watchedFileSignConfig) check() {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	_, err := sc.load()
+	if err == nil || os.IsNotExist(err) {
+		sc.lastErr = ""
+		return
+	}
+	if err.Error() != sc.lastErr {
+		log.Printf("Error checking %s for changes: %v", sc.path, err)
+		sc.lastErr = err.Error()
+	}
+}
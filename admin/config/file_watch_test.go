@@ -0,0 +1,135 @@
+package config
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/afero"
+
+	pb "github.com/wallaceicy06/muni-sign/proto"
+)
+
+const testPollInterval = 10 * time.Millisecond
+
+func writeTestFleet(t *testing.T, path string, signs ...*pb.Sign) {
+	data := proto.MarshalTextString(&pb.Fleet{Signs: signs})
+	if err := afero.WriteFile(fs, path, []byte(data), 0644); err != nil {
+		t.Fatalf("error writing config file: %v", err)
+	}
+}
+
+func receiveUpdate(t *testing.T, updates <-chan Update) Update {
+	select {
+	case u := <-updates:
+		return u
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for update")
+	}
+	return Update{}
+}
+
+func TestWatchedFileSignConfig(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	var opened []SignConfig
+	defer func() {
+		for _, sc := range opened {
+			sc.(*watchedFileSignConfig).Close()
+		}
+	}()
+
+	testSignConfig(t, func(t *testing.T) SignConfig {
+		sc := NewWatchedFileSignConfig(fmt.Sprintf("/path/to/file%d", len(opened)), testPollInterval)
+		opened = append(opened, sc)
+		return sc
+	})
+}
+
+func TestExternalEdit(t *testing.T) {
+	path := "/path/to/file"
+	fs = afero.NewMemMapFs()
+	kitchen := &pb.Configuration{SchemaVersion: CurrentSchemaVersion, Agency: "sf-muni", Stops: []*pb.Stop{{Id: "1234"}}}
+	writeTestFleet(t, path,
+		&pb.Sign{Id: "kitchen", Configuration: kitchen},
+		&pb.Sign{Id: "lobby", Configuration: &pb.Configuration{SchemaVersion: CurrentSchemaVersion, Agency: "sf-muni"}})
+
+	sc := NewWatchedFileSignConfig(path, testPollInterval)
+	defer sc.(*watchedFileSignConfig).Close()
+	kitchenUpdates, cancelKitchen := sc.Watch("kitchen")
+	defer cancelKitchen()
+	lobbyUpdates, cancelLobby := sc.Watch("lobby")
+	defer cancelLobby()
+
+	lobby := &pb.Configuration{SchemaVersion: CurrentSchemaVersion, Agency: "sf-muni", Stops: []*pb.Stop{{Id: "5678"}}}
+	writeTestFleet(t, path,
+		&pb.Sign{Id: "kitchen", Configuration: kitchen},
+		&pb.Sign{Id: "lobby", Configuration: lobby})
+
+	got := receiveUpdate(t, lobbyUpdates)
+	if !proto.Equal(got.Config, lobby) || got.Revision != Revision(lobby) {
+		t.Errorf("<-updates = %v want {%v %s}", got, lobby, Revision(lobby))
+	}
+	select {
+	case u := <-kitchenUpdates:
+		t.Errorf("unchanged sign got update %v", u)
+	case <-time.After(5 * testPollInterval):
+	}
+}
+
+func TestInvalidExternalEdit(t *testing.T) {
+	path := "/path/to/file"
+	fs = afero.NewMemMapFs()
+	good := &pb.Configuration{SchemaVersion: CurrentSchemaVersion, Agency: "sf-muni", Stops: []*pb.Stop{{Id: "1234"}}}
+	writeTestFleet(t, path, &pb.Sign{Id: "lobby", Configuration: good})
+
+	sc := NewWatchedFileSignConfig(path, testPollInterval)
+	defer sc.(*watchedFileSignConfig).Close()
+	updates, cancel := sc.Watch("lobby")
+	defer cancel()
+
+	afero.WriteFile(fs, path, []byte(`signs { id: "lobby" configuration { agency: 1234 } }`), 0644)
+	select {
+	case u := <-updates:
+		t.Errorf("invalid edit published update %v", u)
+	case <-time.After(5 * testPollInterval):
+	}
+
+	got, _, err := sc.Get("lobby")
+	if err != nil {
+		t.Fatalf("sc.Get() = _, _, %v want _, _, <nil>", err)
+	}
+	if !proto.Equal(got, good) {
+		t.Errorf("sc.Get() = %v, _, _ want last good configuration %v, _, _", got, good)
+	}
+
+	// Fixing the file publishes the fixed configuration.
+	fixed := &pb.Configuration{SchemaVersion: CurrentSchemaVersion, Agency: "sf-muni", Stops: []*pb.Stop{{Id: "5678"}}}
+	writeTestFleet(t, path, &pb.Sign{Id: "lobby", Configuration: fixed})
+	if u := receiveUpdate(t, updates); !proto.Equal(u.Config, fixed) {
+		t.Errorf("<-updates = %v want %v", u.Config, fixed)
+	}
+}
+
+func TestOwnWriteNotRepublished(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	sc := NewWatchedFileSignConfig("/path/to/file", testPollInterval)
+	defer sc.(*watchedFileSignConfig).Close()
+	if err := sc.Create("lobby", "Lobby"); err != nil {
+		t.Fatalf("sc.Create() = %v want <nil>", err)
+	}
+
+	updates, cancel := sc.Watch("lobby")
+	defer cancel()
+
+	cfg := &pb.Configuration{SchemaVersion: CurrentSchemaVersion, Agency: "sf-muni", Stops: []*pb.Stop{{Id: "1234"}}}
+	if _, err := sc.Put("lobby", cfg, ""); err != nil {
+		t.Fatalf("sc.Put() = _, %v want _, <nil>", err)
+	}
+	receiveUpdate(t, updates)
+	select {
+	case u := <-updates:
+		t.Errorf("write published twice, got extra update %v", u)
+	case <-time.After(5 * testPollInterval):
+	}
+}
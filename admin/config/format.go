@@ -0,0 +1,107 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/golang/protobuf/proto"
+)
+
+// fileFormat is a syntax in which configuration files can be written.
+type fileFormat struct {
+	marshal   func(proto.Message) ([]byte, error)
+	unmarshal func([]byte, proto.Message) error
+}
+
+var (
+	textFormat = fileFormat{marshalText, unmarshalText}
+	jsonFormat = fileFormat{marshalJSON, unmarshalJSON}
+	yamlFormat = fileFormat{marshalYAML, unmarshalYAML}
+)
+
+// formatOf picks the format of a configuration file from its extension.
+// Files ending in .json and .yaml (or .yml) hold JSON and YAML, using the same
+// field names as the admin API. Anything else, including .pb.txt, holds text
+// format protos.
+func formatOf(path string) fileFormat {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return jsonFormat
+	case ".yaml", ".yml":
+		return yamlFormat
+	default:
+		return textFormat
+	}
+}
+
+func marshalText(m proto.Message) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := proto.MarshalText(&buf, m); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func unmarshalText(data []byte, m proto.Message) error {
+	return proto.UnmarshalText(string(data), m)
+}
+
+func marshalJSON(m proto.Message) ([]byte, error) {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// unmarshalJSON rejects unknown fields, so that a misspelled field in a
+// hand-written file is reported instead of silently dropped.
+func unmarshalJSON(data []byte, m proto.Message) error {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.DisallowUnknownFields()
+	return d.Decode(m)
+}
+
+func marshalYAML(m proto.Message) ([]byte, error) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return yaml.JSONToYAML(data)
+}
+
+func unmarshalYAML(data []byte, m proto.Message) error {
+	data, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return err
+	}
+	return unmarshalJSON(data, m)
+}
+
+// ConvertFile rewrites the configuration file at src in the format of dst,
+// each format being chosen by the file's extension.
+func ConvertFile(src, dst string) error {
+	data, err := readConfigFile(src)
+	if err != nil {
+		return err
+	}
+	fleet, err := parseConfig(formatOf(src), data)
+	if err != nil {
+		return err
+	}
+	data, err = formatOf(dst).marshal(fleet)
+	if err != nil {
+		return fmt.Errorf("error marshalling configuration: %v", err)
+	}
+	if _, err := fs.Stat(dst); err == nil {
+		return fmt.Errorf("%s already exists", dst)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	return writeConfigFile(dst, data)
+}
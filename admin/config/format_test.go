@@ -0,0 +1,140 @@
+package config
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/afero"
+
+	pb "github.com/wallaceicy06/muni-sign/proto"
+)
+
+func TestFileFormats(t *testing.T) {
+	for _, ext := range []string{".pb.txt", ".json", ".yaml"} {
+		t.Run(ext, func(t *testing.T) {
+			fs = afero.NewMemMapFs()
+			n := 0
+			testSignConfig(t, func(t *testing.T) SignConfig {
+				n++
+				return NewFileSignConfig(fmt.Sprintf("/path/to/file%d%s", n, ext))
+			})
+		})
+	}
+}
+
+func TestReadFormats(t *testing.T) {
+	want := &pb.Configuration{
+		SchemaVersion: CurrentSchemaVersion,
+		Agency:        "sf-muni",
+		Stops:         []*pb.Stop{{Id: "1234"}, {Id: "5678"}},
+	}
+
+	tests := []struct {
+		name     string
+		filePath string
+		fileData string
+		wantErr  bool
+	}{
+		{
+			name:     "Text",
+			filePath: "/path/to/config.pb.txt",
+			fileData: `signs { id: "lobby" configuration { agency: "sf-muni" stop_ids: "1234" stop_ids: "5678" } }`,
+		},
+		{
+			name:     "JSON",
+			filePath: "/path/to/config.json",
+			fileData: `{"signs": [{"id": "lobby", "configuration": {"agency": "sf-muni", "stop_ids": ["1234", "5678"]}}]}`,
+		},
+		{
+			name:     "YAML",
+			filePath: "/path/to/config.yaml",
+			fileData: `signs:
+- id: lobby
+  configuration:
+    agency: sf-muni
+    stop_ids: ["1234", "5678"]
+`,
+		},
+		{
+			name:     "YMLExtension",
+			filePath: "/path/to/config.yml",
+			fileData: `{signs: [{id: lobby, configuration: {agency: sf-muni, stop_ids: ["1234", "5678"]}}]}`,
+		},
+		{
+			name:     "WrongSyntax",
+			filePath: "/path/to/config.json",
+			fileData: `signs { id: "lobby" configuration { agency: "sf-muni" } }`,
+			wantErr:  true,
+		},
+		{
+			name:     "UnknownField",
+			filePath: "/path/to/config.yaml",
+			fileData: `signs: [{id: lobby, configuration: {agency: sf-muni, stops: ["1234"]}}]`,
+			wantErr:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fs = afero.NewMemMapFs()
+			afero.WriteFile(fs, test.filePath, []byte(test.fileData), 0644)
+
+			got, _, err := NewFileSignConfig(test.filePath).Get("lobby")
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("sc.Get() = %v, _, <nil> want _, _, <non-nil>", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("sc.Get() = _, _, %v want _, _, <nil>", err)
+			}
+			if !proto.Equal(got, want) {
+				t.Errorf("sc.Get() = %v, _, _ want %v, _, _", got, want)
+			}
+		})
+	}
+}
+
+func TestReadLegacyJSON(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	afero.WriteFile(fs, "/path/to/config.json", []byte(`{"agency": "sf-muni", "stop_ids": ["1234"]}`), 0644)
+
+	got, _, err := NewFileSignConfig("/path/to/config.json").Get(DefaultSignID)
+	if err != nil {
+		t.Fatalf("sc.Get() = _, _, %v want _, _, <nil>", err)
+	}
+	if want := (&pb.Configuration{SchemaVersion: CurrentSchemaVersion, Agency: "sf-muni", Stops: []*pb.Stop{{Id: "1234"}}}); !proto.Equal(got, want) {
+		t.Errorf("sc.Get() = %v, _, _ want %v, _, _", got, want)
+	}
+}
+
+func TestConvertFile(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	src := "/path/to/config.pb.txt"
+	want := &pb.Fleet{Signs: []*pb.Sign{
+		{Id: "lobby", Name: "Lobby", Configuration: &pb.Configuration{SchemaVersion: CurrentSchemaVersion, Agency: "sf-muni", Stops: []*pb.Stop{{Id: "1234"}}}},
+	}}
+	afero.WriteFile(fs, src, []byte(proto.MarshalTextString(want)), 0644)
+
+	for _, dst := range []string{"/path/to/config.json", "/path/to/config.yaml", "/path/to/copy.pb.txt"} {
+		if err := ConvertFile(src, dst); err != nil {
+			t.Fatalf("ConvertFile(%q, %q) = %v want <nil>", src, dst, err)
+		}
+		got, err := NewFileSignConfig(dst).List()
+		if err != nil {
+			t.Fatalf("sc.List() on %s = _, %v want _, <nil>", dst, err)
+		}
+		if !proto.Equal(&pb.Fleet{Signs: got}, want) {
+			t.Errorf("converted %s = %v want %v", dst, got, want.Signs)
+		}
+	}
+
+	if err := ConvertFile(src, "/path/to/config.json"); err == nil {
+		t.Errorf("ConvertFile() onto existing file = <nil> want <non-nil>")
+	}
+	if err := ConvertFile("/path/to/missing.json", "/path/to/new.yaml"); err == nil {
+		t.Errorf("ConvertFile() from missing file = <nil> want <non-nil>")
+	}
+}
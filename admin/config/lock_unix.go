@@ -0,0 +1,34 @@
+//go:build !windows
+// +build !windows
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+
+	"github.com/spf13/afero"
+)
+
+// lockFile takes an advisory lock that keeps other processes, such as a second
+// admin server pointed at the same file, from updating the file at path at the
+// same time. Filesystems other than the OS filesystem are not shared with
+// other processes, so they are not locked.
+func lockFile(path string) (unlock func(), err error) {
+	if _, ok := fs.(*afero.OsFs); !ok {
+		return func() {}, nil
+	}
+	f, err := os.OpenFile(path+".lock", os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening lock file: %v", err)
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("error locking configuration file: %v", err)
+	}
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
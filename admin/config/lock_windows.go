@@ -0,0 +1,7 @@
+package config
+
+// lockFile is a no-op on Windows, where updates are only protected from
+// concurrent requests within the same process.
+func lockFile(path string) (unlock func(), err error) {
+	return func() {}, nil
+}
@@ -0,0 +1,71 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/wallaceicy06/muni-sign/proto"
+)
+
+// CurrentSchemaVersion is the schema version of the configurations stored by
+// this version of the admin server. When a change to pb.Configuration means
+// that existing configurations must be rewritten to keep working, increment it
+// and add a migration from the previous version to migrations.
+const CurrentSchemaVersion = 2
+
+// migrations[v] upgrades a configuration in place from schema version v to
+// version v+1. Configurations are upgraded one version at a time, so each
+// migration only needs to know about the shape of the version before it.
+var migrations = []func(*pb.Configuration) error{
+	// Version 0 configurations predate schema versions, but otherwise have the
+	// same shape as version 1.
+	0: func(*pb.Configuration) error { return nil },
+	// Version 2 replaces the stop ids with stops that have their own display
+	// settings.
+	1: func(cfg *pb.Configuration) error {
+		for _, id := range cfg.GetStopIds() {
+			cfg.Stops = append(cfg.Stops, &pb.Stop{Id: id})
+		}
+		cfg.StopIds = nil
+		return nil
+	},
+}
+
+// Migrate returns a copy of cfg upgraded to CurrentSchemaVersion. It fails if
+// cfg was written by a newer version of the admin server.
+func Migrate(cfg *pb.Configuration) (*pb.Configuration, error) {
+	if cfg == nil {
+		cfg = &pb.Configuration{}
+	}
+	v := cfg.GetSchemaVersion()
+	if v < 0 || v > CurrentSchemaVersion {
+		return nil, fmt.Errorf("unsupported configuration schema version %d, want at most %d", v, CurrentSchemaVersion)
+	}
+	cfg = proto.Clone(cfg).(*pb.Configuration)
+	for ; v < CurrentSchemaVersion; v++ {
+		if err := migrations[v](cfg); err != nil {
+			return nil, fmt.Errorf("error upgrading configuration from schema version %d: %v", v, err)
+		}
+		cfg.SchemaVersion = v + 1
+	}
+	return cfg, nil
+}
+
+// migrateFleet upgrades the configuration of every sign in fleet in place.
+func migrateFleet(fleet *pb.Fleet) error {
+	for _, s := range fleet.GetSigns() {
+		cfg, err := Migrate(signConfiguration(s))
+		if err != nil {
+			return fmt.Errorf("sign %q: %v", s.GetId(), err)
+		}
+		s.Configuration = cfg
+	}
+	return nil
+}
+
+// emptyConfiguration returns the configuration of a sign that has not been
+// configured yet.
+func emptyConfiguration() *pb.Configuration {
+	return &pb.Configuration{SchemaVersion: CurrentSchemaVersion}
+}
@@ -0,0 +1,129 @@
+package config
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/wallaceicy06/muni-sign/proto"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// TestMigrateGolden reads a configuration file in each of the shapes that
+// older versions of the admin server wrote, from testdata/*.pb.txt, and checks
+// that it upgrades to the fleet in the matching .golden file.
+func TestMigrateGolden(t *testing.T) {
+	inputs, err := filepath.Glob("testdata/*.pb.txt")
+	if err != nil {
+		t.Fatalf("error listing test data: %v", err)
+	}
+	if len(inputs) == 0 {
+		t.Fatalf("no test data found")
+	}
+
+	for _, input := range inputs {
+		name := strings.TrimSuffix(filepath.Base(input), ".pb.txt")
+		t.Run(name, func(t *testing.T) {
+			data, err := ioutil.ReadFile(input)
+			if err != nil {
+				t.Fatalf("error reading %s: %v", input, err)
+			}
+			fleet, err := parseConfig(textFormat, data)
+			if err != nil {
+				t.Fatalf("parseConfig(%s) = _, %v want _, <nil>", input, err)
+			}
+
+			golden := strings.TrimSuffix(input, ".pb.txt") + ".golden"
+			if *updateGolden {
+				if err := ioutil.WriteFile(golden, []byte(proto.MarshalTextString(fleet)), 0644); err != nil {
+					t.Fatalf("error writing %s: %v", golden, err)
+				}
+			}
+			data, err = ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("error reading %s: %v", golden, err)
+			}
+			want := &pb.Fleet{}
+			if err := proto.UnmarshalText(string(data), want); err != nil {
+				t.Fatalf("error parsing %s: %v", golden, err)
+			}
+			if !proto.Equal(fleet, want) {
+				t.Errorf("parseConfig(%s) =\n%s\nwant\n%s", input, proto.MarshalTextString(fleet), data)
+			}
+		})
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     *pb.Configuration
+		want    *pb.Configuration
+		wantErr bool
+	}{
+		{
+			name: "Nil",
+			cfg:  nil,
+			want: &pb.Configuration{SchemaVersion: CurrentSchemaVersion},
+		},
+		{
+			name: "Unversioned",
+			cfg:  &pb.Configuration{Agency: "sf-muni"},
+			want: &pb.Configuration{SchemaVersion: CurrentSchemaVersion, Agency: "sf-muni"},
+		},
+		{
+			name: "StopIDs",
+			cfg:  &pb.Configuration{SchemaVersion: 1, Agency: "sf-muni", StopIds: []string{"1234", "5678"}},
+			want: &pb.Configuration{SchemaVersion: CurrentSchemaVersion, Agency: "sf-muni", Stops: []*pb.Stop{{Id: "1234"}, {Id: "5678"}}},
+		},
+		{
+			name: "StopIDsAndStops",
+			cfg:  &pb.Configuration{SchemaVersion: 1, StopIds: []string{"5678"}, Stops: []*pb.Stop{{Id: "1234", Nickname: "Home"}}},
+			want: &pb.Configuration{SchemaVersion: CurrentSchemaVersion, Stops: []*pb.Stop{{Id: "1234", Nickname: "Home"}, {Id: "5678"}}},
+		},
+		{
+			name: "Current",
+			cfg:  &pb.Configuration{SchemaVersion: CurrentSchemaVersion, Agency: "sf-muni"},
+			want: &pb.Configuration{SchemaVersion: CurrentSchemaVersion, Agency: "sf-muni"},
+		},
+		{
+			name:    "FromTheFuture",
+			cfg:     &pb.Configuration{SchemaVersion: CurrentSchemaVersion + 1},
+			wantErr: true,
+		},
+		{
+			name:    "Negative",
+			cfg:     &pb.Configuration{SchemaVersion: -1},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := Migrate(test.cfg)
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("Migrate() = %v, <nil> want _, <non-nil>", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Migrate() = _, %v want _, <nil>", err)
+			}
+			if !proto.Equal(got, test.want) {
+				t.Errorf("Migrate() = %v, _ want %v, _", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMigrationsCoverEveryVersion(t *testing.T) {
+	if len(migrations) != CurrentSchemaVersion {
+		t.Errorf("len(migrations) = %d want one migration to each version up to %d", len(migrations), CurrentSchemaVersion)
+	}
+}
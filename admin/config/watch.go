@@ -0,0 +1,114 @@
+package config
+
+import (
+	"sync"
+
+	pb "github.com/wallaceicy06/muni-sign/proto"
+)
+
+// Update is a configuration delivered to watchers along with its revision.
+type Update struct {
+	Config   *pb.Configuration
+	Revision string
+}
+
+// broadcaster fans configuration updates out to any number of watchers of each
+// sign. It is meant to be embedded in SignConfig implementations to provide
+// Watch.
+//
+// Writes are numbered with next while they are still serialized, and publish
+// drops any update older than the last one published for the sign, so watchers
+// see writes in the order they were stored even if they are published out of
+// order.
+type broadcaster struct {
+	mu   sync.Mutex
+	subs map[string]map[chan Update]bool
+	seq  uint64
+	last map[string]uint64
+}
+
+func (b *broadcaster) Watch(id string) (<-chan Update, func()) {
+	// A buffer of one lets publish run without blocking on slow watchers. If a
+	// watcher falls behind, the stale update is replaced by the newest one.
+	ch := make(chan Update, 1)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.subs == nil {
+		b.subs = make(map[string]map[chan Update]bool)
+	}
+	if b.subs[id] == nil {
+		b.subs[id] = make(map[chan Update]bool)
+	}
+	b.subs[id][ch] = true
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			// The channel was already closed if the sign was deleted.
+			if !b.subs[id][ch] {
+				return
+			}
+			delete(b.subs[id], ch)
+			if len(b.subs[id]) == 0 {
+				delete(b.subs, id)
+			}
+			close(ch)
+		})
+	}
+}
+
+// next returns the sequence number of a write. It must be called while the
+// write is serialized with every other write.
+func (b *broadcaster) next() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.seq++
+	return b.seq
+}
+
+// publish sends u to the watchers of sign id, unless a write numbered after seq
+// was already published.
+func (b *broadcaster) publish(id string, seq uint64, u Update) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.advance(id, seq) {
+		return
+	}
+	for ch := range b.subs[id] {
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- u
+	}
+}
+
+// close closes the channels of every watcher of sign id after it was deleted by
+// the write numbered seq.
+func (b *broadcaster) close(id string, seq uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.advance(id, seq) {
+		return
+	}
+	for ch := range b.subs[id] {
+		close(ch)
+	}
+	delete(b.subs, id)
+}
+
+// advance records seq as the last write published for sign id, and reports
+// whether it is newer than the previous one. The caller must hold b.mu.
+func (b *broadcaster) advance(id string, seq uint64) bool {
+	if seq <= b.last[id] {
+		return false
+	}
+	if b.last == nil {
+		b.last = make(map[string]uint64)
+	}
+	b.last[id] = seq
+	return true
+}
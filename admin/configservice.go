@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+
+	"github.com/wallaceicy06/muni-sign/admin/config"
+	"github.com/wallaceicy06/muni-sign/display"
+	pb "github.com/wallaceicy06/muni-sign/proto"
+	"github.com/wallaceicy06/muni-sign/schedule"
+)
+
+// configService serves the configurations of the signs over gRPC, the same
+// way as the HTTP API.
+type configService struct {
+	s *server
+}
+
+// newGRPCServer returns a gRPC server for the SignConfigService and the
+// emulated DisplayDriver, which also supports reflection so that tools such as
+// grpc_cli can discover them. Every call must be authenticated with an API
+// token.
+func (s *server) newGRPCServer() *grpc.Server {
+	grpcSrv := grpc.NewServer(
+		grpc.UnaryInterceptor(s.authUnaryInterceptor),
+		grpc.StreamInterceptor(s.authStreamInterceptor),
+	)
+	pb.RegisterSignConfigServiceServer(grpcSrv, &configService{s})
+	pb.RegisterDisplayDriverServer(grpcSrv, display.NewServer(s.emulator))
+	reflection.Register(grpcSrv)
+	return grpcSrv
+}
+
+// authenticateCall checks the API token sent with a gRPC call in the
+// authorization metadata, as "Bearer <token>", and returns the context of the
+// call with the token's user.
+func (s *server) authenticateCall(ctx context.Context) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	var token string
+	for _, h := range md["authorization"] {
+		if strings.HasPrefix(h, "Bearer ") {
+			token = strings.TrimPrefix(h, "Bearer ")
+		}
+	}
+	if token == "" {
+		return nil, grpc.Errorf(codes.Unauthenticated, "An API token is required.")
+	}
+	user, err := s.users.AuthenticateToken(token)
+	if err != nil {
+		return nil, grpc.Errorf(codes.Unauthenticated, "Invalid API token.")
+	}
+	return context.WithValue(ctx, userKey, user), nil
+}
+
+func (s *server) authUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := s.authenticateCall(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (s *server) authStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := s.authenticateCall(ss.Context())
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authenticatedStream{ss, ctx})
+}
+
+// authenticatedStream is a server stream whose context carries the user that
+// made the call.
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (as *authenticatedStream) Context() context.Context {
+	return as.ctx
+}
+
+// configFor returns the configuration of the signs, recording changes to it in
+// the audit log as the user that made the call.
+func (cs *configService) configFor(ctx context.Context) config.SignConfig {
+	user, _ := ctx.Value(userKey).(string)
+	var addr string
+	if p, ok := peer.FromContext(ctx); ok {
+		addr = p.Addr.String()
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			addr = host
+		}
+	}
+	return &auditedConfig{cs.s.cfg, cs.s.audit, user, addr}
+}
+
+func (cs *configService) Get(ctx context.Context, req *pb.GetSignConfigRequest) (*pb.ConfigurationRevision, error) {
+	cfg := cs.configFor(ctx)
+	c, rev, err := cfg.Get(req.GetSignId())
+	if err != nil {
+		return nil, configStatus(err)
+	}
+	return &pb.ConfigurationRevision{Revision: rev, Configuration: c}, nil
+}
+
+func (cs *configService) Update(ctx context.Context, req *pb.UpdateSignConfigRequest) (*pb.ConfigurationRevision, error) {
+	cfg := cs.configFor(ctx)
+	c := req.GetConfiguration()
+	if c.GetAgency() == "" {
+		return nil, grpc.Errorf(codes.InvalidArgument, "Agency must be provided.")
+	}
+	// Validate and return the configuration as it is stored, upgraded to the
+	// current schema.
+	c, err := config.Migrate(c)
+	if err != nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "Invalid configuration: %v.", err)
+	}
+	if err := schedule.Validate(c); err != nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "Invalid configuration: %v.", err)
+	}
+	rev, err := cfg.Put(req.GetSignId(), c, req.GetRevision())
+	if err != nil {
+		return nil, configStatus(err)
+	}
+	return &pb.ConfigurationRevision{Revision: rev, CreateTime: timeNow().Unix(), Configuration: c}, nil
+}
+
+// Watch sends the current configuration, unless the client already has it,
+// followed by every change, like apiConfigWatchHandler. If the sign is deleted,
+// the stream ends with a NotFound error.
+func (cs *configService) Watch(req *pb.WatchSignConfigRequest, stream pb.SignConfigService_WatchServer) error {
+	cfg := cs.configFor(stream.Context())
+
+	// Subscribe before reading the current configuration so that no change can
+	// slip in between the two.
+	updates, cancel := cfg.Watch(req.GetSignId())
+	defer cancel()
+
+	c, rev, err := cfg.Get(req.GetSignId())
+	if err != nil {
+		return configStatus(err)
+	}
+	// Send the headers right away, so that a client that already has the
+	// current configuration knows that it is subscribed.
+	if err := stream.SendHeader(metadata.MD{}); err != nil {
+		return err
+	}
+	if rev != req.GetRevision() {
+		if err := stream.Send(&pb.ConfigurationRevision{Revision: rev, Configuration: c}); err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case u, ok := <-updates:
+			if !ok {
+				// The sign was deleted.
+				return configStatus(config.ErrNotFound)
+			}
+			if err := stream.Send(&pb.ConfigurationRevision{Revision: u.Revision, Configuration: u.Config}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (cs *configService) ListRevisions(ctx context.Context, req *pb.ListRevisionsRequest) (*pb.ListRevisionsResponse, error) {
+	cfg := cs.configFor(ctx)
+	revs, err := cfg.Revisions(req.GetSignId())
+	if err != nil {
+		return nil, configStatus(err)
+	}
+	return &pb.ListRevisionsResponse{Revisions: revs}, nil
+}
+
+// configStatus returns the gRPC error that corresponds to an error returned by
+// config.SignConfig, like configError does for HTTP.
+func configStatus(err error) error {
+	switch err {
+	case config.ErrNotFound:
+		return grpc.Errorf(codes.NotFound, "No such sign.")
+	case config.ErrConflict:
+		return grpc.Errorf(codes.Aborted, "Configuration was modified by someone else.")
+	default:
+		return grpc.Errorf(codes.Internal, "Internal error: %v", err)
+	}
+}
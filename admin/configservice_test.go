@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/wallaceicy06/muni-sign/admin/config"
+	pb "github.com/wallaceicy06/muni-sign/proto"
+)
+
+// startGRPCServer serves the gRPC services of srv on a local port and returns
+// a connection to it, and a function that stops serving.
+func startGRPCServer(t *testing.T, srv *server) (*grpc.ClientConn, func()) {
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("error listening: %v", err)
+	}
+	grpcSrv := srv.newGRPCServer()
+	go grpcSrv.Serve(lis)
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		grpcSrv.Stop()
+		t.Fatalf("error dialing: %v", err)
+	}
+	return conn, func() {
+		conn.Close()
+		grpcSrv.Stop()
+	}
+}
+
+// startConfigService serves the SignConfigService of srv on a local port and
+// returns a client for it, and a function that stops serving.
+func startConfigService(t *testing.T, srv *server) (pb.SignConfigServiceClient, func()) {
+	conn, stop := startGRPCServer(t, srv)
+	return pb.NewSignConfigServiceClient(conn), stop
+}
+
+func withToken(token string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+}
+
+func TestConfigServiceAuth(t *testing.T) {
+	client, stop := startConfigService(t, newServer(testPort, goodFakeNb, newFakeConfig(testConfig, "rev1"), testUsers))
+	defer stop()
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		wantCode codes.Code
+	}{
+		{name: "NoToken", ctx: context.Background(), wantCode: codes.Unauthenticated},
+		{name: "BadToken", ctx: withToken("wrong-token"), wantCode: codes.Unauthenticated},
+		{name: "GoodToken", ctx: withToken("driver-token"), wantCode: codes.OK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := client.Get(test.ctx, &pb.GetSignConfigRequest{SignId: "default"})
+			if got := grpc.Code(err); got != test.wantCode {
+				t.Errorf("Get() got code %v want %v", got, test.wantCode)
+			}
+		})
+	}
+}
+
+func TestDisplayDriverAuth(t *testing.T) {
+	conn, stop := startGRPCServer(t, newServer(testPort, goodFakeNb, newFakeConfig(testConfig, "rev1"), testUsers))
+	defer stop()
+	client := pb.NewDisplayDriverClient(conn)
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		wantCode codes.Code
+	}{
+		{name: "NoToken", ctx: context.Background(), wantCode: codes.Unauthenticated},
+		{name: "BadToken", ctx: withToken("wrong-token"), wantCode: codes.Unauthenticated},
+		{name: "GoodToken", ctx: withToken("driver-token"), wantCode: codes.OK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := client.Write(test.ctx, &pb.WriteRequest{Message: "Hello"})
+			if got := grpc.Code(err); got != test.wantCode {
+				t.Errorf("Write() got code %v want %v", got, test.wantCode)
+			}
+		})
+	}
+}
+
+func TestConfigServiceGetUpdate(t *testing.T) {
+	newConfig := &pb.Configuration{Agency: "sf-muni", Stops: []*pb.Stop{{Id: "9012"}}}
+	// The configuration is stored, and returned, as upgraded to the current
+	// schema.
+	storedConfig := proto.Clone(newConfig).(*pb.Configuration)
+	storedConfig.SchemaVersion = config.CurrentSchemaVersion
+
+	tests := []struct {
+		name     string
+		req      *pb.UpdateSignConfigRequest
+		wantCode codes.Code
+		wantCfg  *pb.Configuration
+	}{
+		{
+			name:     "Update",
+			req:      &pb.UpdateSignConfigRequest{SignId: "default", Configuration: newConfig},
+			wantCode: codes.OK,
+			wantCfg:  storedConfig,
+		},
+		{
+			name:     "MatchingRevision",
+			req:      &pb.UpdateSignConfigRequest{SignId: "default", Configuration: newConfig, Revision: "rev1"},
+			wantCode: codes.OK,
+			wantCfg:  storedConfig,
+		},
+		{
+			name: "OldSchema",
+			req: &pb.UpdateSignConfigRequest{SignId: "default", Configuration: &pb.Configuration{
+				Agency:  "sf-muni",
+				StopIds: []string{"9012"},
+			}},
+			wantCode: codes.OK,
+			wantCfg:  storedConfig,
+		},
+		{
+			name:     "UnsupportedSchemaVersion",
+			req:      &pb.UpdateSignConfigRequest{SignId: "default", Configuration: &pb.Configuration{SchemaVersion: 99, Agency: "sf-muni"}},
+			wantCode: codes.InvalidArgument,
+			wantCfg:  testConfig,
+		},
+		{
+			name:     "StaleRevision",
+			req:      &pb.UpdateSignConfigRequest{SignId: "default", Configuration: newConfig, Revision: "rev0"},
+			wantCode: codes.Aborted,
+			wantCfg:  testConfig,
+		},
+		{
+			name:     "NoAgency",
+			req:      &pb.UpdateSignConfigRequest{SignId: "default", Configuration: &pb.Configuration{}},
+			wantCode: codes.InvalidArgument,
+			wantCfg:  testConfig,
+		},
+		{
+			name: "InvalidSchedule",
+			req: &pb.UpdateSignConfigRequest{SignId: "default", Configuration: &pb.Configuration{
+				Agency:   "sf-muni",
+				Schedule: &pb.Schedule{DefaultProfile: "weekend"},
+			}},
+			wantCode: codes.InvalidArgument,
+			wantCfg:  testConfig,
+		},
+		{
+			name:     "UnknownSign",
+			req:      &pb.UpdateSignConfigRequest{SignId: "lobby", Configuration: newConfig},
+			wantCode: codes.NotFound,
+			wantCfg:  testConfig,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srv := newServer(testPort, goodFakeNb, newFakeConfig(testConfig, "rev1"), testUsers)
+			client, stop := startConfigService(t, srv)
+			defer stop()
+			ctx := withToken("driver-token")
+
+			res, err := client.Update(ctx, test.req)
+			if got := grpc.Code(err); got != test.wantCode {
+				t.Fatalf("Update() got code %v want %v", got, test.wantCode)
+			}
+			got, err := client.Get(ctx, &pb.GetSignConfigRequest{SignId: "default"})
+			if err != nil {
+				t.Fatalf("Get() = %v want <nil>", err)
+			}
+			if !proto.Equal(got.GetConfiguration(), test.wantCfg) {
+				t.Errorf("Get() got configuration %v want %v", got.GetConfiguration(), test.wantCfg)
+			}
+			if res != nil && res.GetRevision() != got.GetRevision() {
+				t.Errorf("Update() returned revision %q but Get() returned %q", res.GetRevision(), got.GetRevision())
+			}
+			if res != nil && !proto.Equal(res.GetConfiguration(), got.GetConfiguration()) {
+				t.Errorf("Update() returned configuration %v but Get() returned %v", res.GetConfiguration(), got.GetConfiguration())
+			}
+		})
+	}
+}
+
+func TestConfigServiceUpdateAudited(t *testing.T) {
+	srv := newServer(testPort, goodFakeNb, newFakeConfig(testConfig, "rev1"), testUsers)
+	client, stop := startConfigService(t, srv)
+	defer stop()
+
+	req := &pb.UpdateSignConfigRequest{SignId: "default", Configuration: &pb.Configuration{Agency: "actransit"}}
+	if _, err := client.Update(withToken("driver-token"), req); err != nil {
+		t.Fatalf("Update() = %v want <nil>", err)
+	}
+	entries, _ := srv.audit.page(0, defaultAuditPageSize, "")
+	if len(entries) != 1 {
+		t.Fatalf("got %d audit entries want 1", len(entries))
+	}
+	if e := entries[0]; e.User != "sean" || e.RemoteAddr != "127.0.0.1" || e.Action != auditUpdate || e.Sign != "default" {
+		t.Errorf("got entry %+v want an update of default by sean from 127.0.0.1", e)
+	}
+}
+
+func TestConfigServiceWatch(t *testing.T) {
+	newConfig := &pb.Configuration{SchemaVersion: config.CurrentSchemaVersion, Agency: "sf-muni", Stops: []*pb.Stop{{Id: "9012"}}}
+
+	tests := []struct {
+		name     string
+		revision string
+		wantCfgs []*pb.Configuration
+	}{
+		{
+			name:     "FromScratch",
+			wantCfgs: []*pb.Configuration{testConfig, newConfig},
+		},
+		{
+			name:     "ResumeFromCurrent",
+			revision: "rev1",
+			wantCfgs: []*pb.Configuration{newConfig},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srv := newServer(testPort, goodFakeNb, newFakeConfig(testConfig, "rev1"), testUsers)
+			client, stop := startConfigService(t, srv)
+			defer stop()
+
+			ctx, cancel := context.WithCancel(withToken("driver-token"))
+			defer cancel()
+			stream, err := client.Watch(ctx, &pb.WatchSignConfigRequest{SignId: "default", Revision: test.revision})
+			if err != nil {
+				t.Fatalf("Watch() = %v want <nil>", err)
+			}
+			// Headers are only sent once the server has subscribed.
+			if _, err := stream.Header(); err != nil {
+				t.Fatalf("error reading headers: %v", err)
+			}
+
+			for i, want := range test.wantCfgs {
+				if want == newConfig {
+					if _, err := client.Update(ctx, &pb.UpdateSignConfigRequest{SignId: "default", Configuration: newConfig}); err != nil {
+						t.Fatalf("Update() = %v want <nil>", err)
+					}
+				}
+				got, err := stream.Recv()
+				if err != nil {
+					t.Fatalf("stream.Recv() %d = %v want <nil>", i, err)
+				}
+				if !proto.Equal(got.GetConfiguration(), want) {
+					t.Errorf("configuration %d does not match: got %v want %v", i, got.GetConfiguration(), want)
+				}
+			}
+		})
+	}
+}
+
+func TestConfigServiceWatchDeletedSign(t *testing.T) {
+	cfg := newFakeConfig(testConfig, "rev1")
+	client, stop := startConfigService(t, newServer(testPort, goodFakeNb, cfg, testUsers))
+	defer stop()
+
+	stream, err := client.Watch(withToken("driver-token"), &pb.WatchSignConfigRequest{SignId: "default", Revision: "rev1"})
+	if err != nil {
+		t.Fatalf("Watch() = %v want <nil>", err)
+	}
+	if _, err := stream.Header(); err != nil {
+		t.Fatalf("error reading headers: %v", err)
+	}
+
+	if err := cfg.Delete("default"); err != nil {
+		t.Fatalf("error deleting sign: %v", err)
+	}
+	_, err = stream.Recv()
+	if got, want := grpc.Code(err), codes.NotFound; got != want {
+		t.Errorf("stream.Recv() after deleting sign got code %v want %v", got, want)
+	}
+}
+
+func TestConfigServiceListRevisions(t *testing.T) {
+	client, stop := startConfigService(t, newServer(testPort, goodFakeNb, newFakeConfig(testConfig, "rev1"), testUsers))
+	defer stop()
+
+	res, err := client.ListRevisions(withToken("driver-token"), &pb.ListRevisionsRequest{SignId: "default"})
+	if err != nil {
+		t.Fatalf("ListRevisions() = %v want <nil>", err)
+	}
+	if len(res.GetRevisions()) != 1 || res.GetRevisions()[0].GetRevision() != "rev1" {
+		t.Errorf("ListRevisions() = %v want the current revision rev1", res)
+	}
+
+	_, err = client.ListRevisions(withToken("driver-token"), &pb.ListRevisionsRequest{SignId: "lobby"})
+	if got, want := grpc.Code(err), codes.NotFound; got != want {
+		t.Errorf("ListRevisions() of unknown sign got code %v want %v", got, want)
+	}
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+type emulatorTemplate struct {
+	accountTemplate
+}
+
+// emulatorHandler serves the emulator page, which draws the emulated display
+// as a 16x2 character LCD. The script that draws it and the changes to the
+// display are served by the display's web sink under /emulator/.
+func (s *server) emulatorHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, fmt.Sprintf("Unsupported method: %s.", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+	s.renderPage("emulator", &emulatorTemplate{requestAccount(r)}, w)
+}
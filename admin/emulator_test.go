@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestEmulatorPage(t *testing.T) {
+	srv := newServer(testPort, goodFakeNb, newFakeConfig(testConfig, ""), testUsers)
+	rec := httptest.NewRecorder()
+	srv.emulatorHandler(rec, httptest.NewRequest(http.MethodGet, "/emulator", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got code %d want %d", rec.Code, http.StatusOK)
+	}
+	for _, want := range []string{`<canvas id="lcd">`, `/emulator/lcd.js`, `/emulator/events`} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("emulator page does not contain %q", want)
+		}
+	}
+}
+
+func TestEmulatorScript(t *testing.T) {
+	srv := newServer(testPort, goodFakeNb, newFakeConfig(testConfig, ""), testUsers)
+	req := httptest.NewRequest(http.MethodGet, "/emulator/lcd.js", nil)
+	req.Header.Set("Authorization", "Bearer driver-token")
+	rec := httptest.NewRecorder()
+	srv.handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got code %d want %d", rec.Code, http.StatusOK)
+	}
+	if got, want := rec.Header().Get("Content-Type"), "application/javascript"; got != want {
+		t.Errorf("got Content-Type %s want %s", got, want)
+	}
+	if !strings.Contains(rec.Body.String(), "LCD.connect") {
+		t.Errorf("emulator script does not define LCD.connect")
+	}
+}
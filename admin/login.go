@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/wallaceicy06/muni-sign/admin/auth"
+)
+
+// The name of the cookie that holds the session ID of a signed in user.
+const sessionCookie = "muni_sign_session"
+
+// The name of the cookie that holds the CSRF token of the login form, which is
+// submitted before there is a session to hold one.
+const loginCSRFCookie = "muni_sign_login_csrf"
+
+// The form field and header that carry the CSRF token of a browser session.
+const (
+	csrfField  = "csrf_token"
+	csrfHeader = "X-CSRF-Token"
+)
+
+type contextKey int
+
+const (
+	// The request context key for the name of the authenticated user.
+	userKey contextKey = iota
+	// The request context key for the *auth.Session of a signed in browser.
+	sessionKey
+)
+
+type route struct {
+	pattern string
+	handler http.Handler
+	// Whether the route may only be used by a signed in user or with an API
+	// token.
+	requireAuth bool
+}
+
+type loginTemplate struct {
+	Next  string
+	Error string
+	// Must be submitted with the form, matching the login CSRF cookie.
+	CSRFToken string
+}
+
+// requireAuth wraps h so that it is only run for authenticated requests. API
+// clients authenticate with an "Authorization: Bearer <token>" header, and
+// browsers with a session cookie. Unauthenticated browsers are sent to the
+// login page.
+//
+// Because browsers attach cookies to cross-site requests too, state-changing
+// requests made with a session must also carry the session's CSRF token,
+// either in a form field (for HTML forms) or in a header (for scripts).
+// Requests made with an API token are exempt since browsers never send the
+// Authorization header on their own.
+func (s *server) requireAuth(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, sess, ok := s.authenticate(r)
+		if !ok {
+			if strings.HasPrefix(r.URL.Path, "/api/") {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="muni-sign"`)
+				http.Error(w, "Authentication required.", http.StatusUnauthorized)
+				return
+			}
+			http.Redirect(w, r, "/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusSeeOther)
+			return
+		}
+		if sess != nil && !isSafeMethod(r.Method) && !validCSRFToken(r, sess) {
+			http.Error(w, "Missing or invalid CSRF token.", http.StatusForbidden)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), userKey, user)
+		if sess != nil {
+			ctx = context.WithValue(ctx, sessionKey, sess)
+		}
+		h.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// authenticate returns the user that made the request, if any, and the
+// browser session it was made with, if it was not made with an API token.
+func (s *server) authenticate(r *http.Request) (string, *auth.Session, bool) {
+	if h := r.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+		user, err := s.users.AuthenticateToken(strings.TrimPrefix(h, "Bearer "))
+		if err != nil {
+			return "", nil, false
+		}
+		return user, nil, true
+	}
+	c, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return "", nil, false
+	}
+	sess, ok := s.sessions.Get(c.Value)
+	if !ok {
+		return "", nil, false
+	}
+	return sess.User, sess, true
+}
+
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+func validCSRFToken(r *http.Request, sess *auth.Session) bool {
+	token := r.Header.Get(csrfHeader)
+	if token == "" {
+		token = r.PostFormValue(csrfField)
+	}
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(sess.CSRFToken)) == 1
+}
+
+// requestUser returns the authenticated user that made the request, or the
+// empty string if the request did not pass through requireAuth.
+func requestUser(r *http.Request) string {
+	user, _ := r.Context().Value(userKey).(string)
+	return user
+}
+
+// accountTemplate is embedded in the template data of every page that shows the
+// account section, which is rendered by the "account" template.
+type accountTemplate struct {
+	// The signed in user, if any.
+	User string
+	// Must be submitted with every form on the page.
+	CSRFToken string
+}
+
+// requestAccount returns the account section of pages rendered in response to
+// the request.
+func requestAccount(r *http.Request) accountTemplate {
+	return accountTemplate{requestUser(r), requestCSRFToken(r)}
+}
+
+// requestCSRFToken returns the CSRF token that forms rendered in response to
+// the request must include, or the empty string if there is no session.
+func requestCSRFToken(r *http.Request) string {
+	if sess, ok := r.Context().Value(sessionKey).(*auth.Session); ok {
+		return sess.CSRFToken
+	}
+	return ""
+}
+
+// loginHandler serves the login form and signs users in. So that another site
+// cannot sign a browser in to an account of its choosing, the form carries a
+// CSRF token that must match the one in the login CSRF cookie, which is set
+// along with the form.
+func (s *server) loginHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		token, err := loginCSRFToken(w, r)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Internal error: %v", err), http.StatusInternalServerError)
+			return
+		}
+		s.renderPage("login", &loginTemplate{Next: safeRedirect(r.URL.Query().Get("next")), CSRFToken: token}, w)
+	case http.MethodPost:
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, fmt.Sprintf("Internal error: %v", err), http.StatusInternalServerError)
+			return
+		}
+		c, err := r.Cookie(loginCSRFCookie)
+		token := r.PostFormValue(csrfField)
+		if err != nil || token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(c.Value)) != 1 {
+			http.Error(w, "Missing or invalid CSRF token.", http.StatusForbidden)
+			return
+		}
+		user := r.Form.Get("username")
+		next := safeRedirect(r.Form.Get("next"))
+		if err := s.users.Authenticate(user, r.Form.Get("password")); err != nil {
+			if err != auth.ErrInvalidCredentials {
+				log.Printf("Error authenticating %q: %v", user, err)
+			}
+			s.audit.record(&auditEntry{User: user, RemoteAddr: remoteHost(r), Action: auditLoginFailed})
+			w.WriteHeader(http.StatusUnauthorized)
+			s.renderPage("login", &loginTemplate{Next: next, Error: "Invalid username or password.", CSRFToken: token}, w)
+			return
+		}
+
+		sess, err := s.sessions.Create(user)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Internal error: %v", err), http.StatusInternalServerError)
+			return
+		}
+		s.audit.record(&auditEntry{User: user, RemoteAddr: remoteHost(r), Action: auditLogin})
+		http.SetCookie(w, &http.Cookie{
+			Name:     sessionCookie,
+			Value:    sess.ID,
+			Path:     "/",
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteLaxMode,
+		})
+		http.Redirect(w, r, next, http.StatusSeeOther)
+	default:
+		http.Error(w, fmt.Sprintf("Unsupported method: %s.", r.Method), http.StatusMethodNotAllowed)
+	}
+}
+
+// loginCSRFToken returns the CSRF token in the login CSRF cookie of the
+// request, or sets the cookie to a new token if there is none.
+func loginCSRFToken(w http.ResponseWriter, r *http.Request) (string, error) {
+	if c, err := r.Cookie(loginCSRFCookie); err == nil && c.Value != "" {
+		return c.Value, nil
+	}
+	token, err := auth.NewCSRFToken()
+	if err != nil {
+		return "", err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     loginCSRFCookie,
+		Value:    token,
+		Path:     "/login",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+	return token, nil
+}
+
+func (s *server) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, fmt.Sprintf("Unsupported method: %s.", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+	if c, err := r.Cookie(sessionCookie); err == nil {
+		s.sessions.Delete(c.Value)
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Path:     "/",
+		HttpOnly: true,
+		MaxAge:   -1,
+	})
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+// passwordHandler changes the password of the signed in user. Every session of
+// the user is ended, this one included, so that anyone who signed in with the
+// old password is signed out.
+func (s *server) passwordHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, fmt.Sprintf("Unsupported method: %s.", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+	user := requestUser(r)
+	if err := s.users.Authenticate(user, r.PostFormValue("current_password")); err != nil {
+		if err != auth.ErrInvalidCredentials {
+			log.Printf("Error authenticating %q: %v", user, err)
+		}
+		http.Error(w, "Current password is incorrect.", http.StatusForbidden)
+		return
+	}
+	password := r.PostFormValue("new_password")
+	if password == "" {
+		http.Error(w, "New password must be provided.", http.StatusBadRequest)
+		return
+	}
+	if err := s.users.SetPassword(user, password); err != nil {
+		http.Error(w, fmt.Sprintf("Internal error: %v", err), http.StatusInternalServerError)
+		return
+	}
+	s.sessions.DeleteUser(user)
+	s.audit.record(&auditEntry{User: user, RemoteAddr: remoteHost(r), Action: auditPassword})
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Path:     "/",
+		HttpOnly: true,
+		MaxAge:   -1,
+	})
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+// safeRedirect returns next if it is a path on this server, and "/" otherwise,
+// so that the login page cannot be used to send users to another site.
+func safeRedirect(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
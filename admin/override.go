@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/wallaceicy06/muni-sign/admin/config"
+	pb "github.com/wallaceicy06/muni-sign/proto"
+	"github.com/wallaceicy06/muni-sign/schedule"
+)
+
+// How many times to retry changing the override of a sign when someone else
+// changes its configuration at the same time.
+const overrideRetries = 3
+
+// durationOption is a choice of duration in a form.
+type durationOption struct {
+	Label string
+	// The duration in the format understood by time.ParseDuration.
+	Value string
+}
+
+// overrideDurations are the durations offered in the override form.
+var overrideDurations = []durationOption{
+	{"15 minutes", "15m"},
+	{"1 hour", "1h"},
+	{"4 hours", "4h"},
+	{"8 hours", "8h"},
+	{"1 day", "24h"},
+	{"1 week", "168h"},
+}
+
+// overrideView describes the active override of a sign on its page.
+type overrideView struct {
+	Text       string
+	Color      string
+	Until      string
+	Interleave bool
+}
+
+// Override returns the active override of the sign, or nil if there is none.
+func (t *signTemplate) Override() *overrideView {
+	o := schedule.ActiveOverride(t.Cfg, timeNow())
+	if o == nil {
+		return nil
+	}
+	return &overrideView{
+		Text:       o.GetText(),
+		Color:      cssColor(o.GetColor()),
+		Until:      time.Unix(o.GetExpireTime(), 0).Format("Mon Jan 2 15:04 MST"),
+		Interleave: o.GetInterleave(),
+	}
+}
+
+// OverrideDurations returns the durations offered in the override form.
+func (t *signTemplate) OverrideDurations() []durationOption {
+	return overrideDurations
+}
+
+// setOverride replaces the override of a sign, or removes it if o is nil,
+// leaving the rest of its configuration alone, on behalf of the user who made
+// the request.
+func (s *server) setOverride(r *http.Request, id string, o *pb.MessageOverride) error {
+	cfg := s.configFor(r)
+	for i := 0; ; i++ {
+		c, rev, err := cfg.Get(id)
+		if err != nil {
+			return err
+		}
+		c = proto.Clone(c).(*pb.Configuration)
+		c.Override = o
+		_, err = cfg.Put(id, c, rev)
+		if err != config.ErrConflict || i == overrideRetries {
+			return err
+		}
+	}
+}
+
+// validateOverride checks an override submitted by a user and fills in its
+// defaults.
+func validateOverride(o *pb.MessageOverride) error {
+	o.Text = strings.TrimSpace(o.GetText())
+	if o.GetText() == "" {
+		return errors.New("text must be provided")
+	}
+	if o.GetExpireTime() <= timeNow().Unix() {
+		return errors.New("expiry must be in the future")
+	}
+	if err := schedule.ValidateColor(o.GetColor()); err != nil {
+		return err
+	}
+	o.Color = proto.Clone(schedule.OverrideColor(o)).(*pb.Color)
+	return nil
+}
+
+// overrideHandler sets and clears the override of the sign named in the path,
+// /signs/<id>/override, from the form on the sign's page.
+func (s *server) overrideHandler(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, fmt.Sprintf("Unsupported method: %s.", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, fmt.Sprintf("Internal error: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	var o *pb.MessageOverride
+	switch action := r.Form.Get("action"); action {
+	case "set":
+		d, err := time.ParseDuration(r.Form.Get("duration"))
+		if err != nil || d <= 0 {
+			http.Error(w, "A duration must be selected.", http.StatusBadRequest)
+			return
+		}
+		color, err := parseCSSColor(r.Form.Get("color"))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid color: %v", err), http.StatusBadRequest)
+			return
+		}
+		o = &pb.MessageOverride{
+			Text:       r.Form.Get("text"),
+			Color:      color,
+			ExpireTime: timeNow().Add(d).Unix(),
+			Interleave: r.Form.Get("interleave") != "",
+		}
+		if err := validateOverride(o); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid override: %v.", err), http.StatusBadRequest)
+			return
+		}
+	case "clear":
+	default:
+		http.Error(w, fmt.Sprintf("Unsupported action: %q.", action), http.StatusBadRequest)
+		return
+	}
+
+	if err := s.setOverride(r, id, o); err != nil {
+		configError(w, err)
+		return
+	}
+	http.Redirect(w, r, "/signs/"+id, http.StatusSeeOther)
+}
+
+// apiOverrideHandler gets, sets and clears the override of a sign. GET fails
+// with a 404 if the sign has no active override.
+func (s *server) apiOverrideHandler(w http.ResponseWriter, r *http.Request, id string) {
+	switch r.Method {
+	case http.MethodGet:
+		c, _, err := s.cfg.Get(id)
+		if err != nil {
+			configError(w, err)
+			return
+		}
+		o := schedule.ActiveOverride(c, timeNow())
+		if o == nil {
+			http.Error(w, "No active override.", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, o)
+	case http.MethodPut:
+		o := &pb.MessageOverride{}
+		if err := json.NewDecoder(r.Body).Decode(o); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid override: %v", err), http.StatusBadRequest)
+			return
+		}
+		if err := validateOverride(o); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid override: %v.", err), http.StatusBadRequest)
+			return
+		}
+		if err := s.setOverride(r, id, o); err != nil {
+			configError(w, err)
+			return
+		}
+		writeJSON(w, o)
+	case http.MethodDelete:
+		if err := s.setOverride(r, id, nil); err != nil {
+			configError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, fmt.Sprintf("Unsupported method: %s.", r.Method), http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/wallaceicy06/muni-sign/proto"
+)
+
+func TestOverrideForm(t *testing.T) {
+	defer func() { timeNow = time.Now }()
+	now := time.Unix(1500000000, 0)
+	timeNow = func() time.Time { return now }
+
+	tests := []struct {
+		name         string
+		form         url.Values
+		wantCode     int
+		wantOverride *pb.MessageOverride
+	}{
+		{
+			name: "Set",
+			form: url.Values{
+				"action":     {"set"},
+				"text":       {" Happy Birthday Sam! "},
+				"color":      {"#ff0000"},
+				"duration":   {"1h"},
+				"interleave": {"on"},
+			},
+			wantCode: http.StatusSeeOther,
+			wantOverride: &pb.MessageOverride{
+				Text:       "Happy Birthday Sam!",
+				Color:      &pb.Color{Red: 1.0},
+				ExpireTime: now.Add(time.Hour).Unix(),
+				Interleave: true,
+			},
+		},
+		{
+			name:     "Clear",
+			form:     url.Values{"action": {"clear"}},
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:     "MissingText",
+			form:     url.Values{"action": {"set"}, "color": {"#ff0000"}, "duration": {"1h"}},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "InvalidColor",
+			form:     url.Values{"action": {"set"}, "text": {"Hi"}, "color": {"red"}, "duration": {"1h"}},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "InvalidDuration",
+			form:     url.Values{"action": {"set"}, "text": {"Hi"}, "color": {"#ff0000"}, "duration": {"-1h"}},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "InvalidAction",
+			form:     url.Values{"action": {"bogus"}},
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			existing := &pb.MessageOverride{Text: "Office closed", ExpireTime: now.Add(time.Hour).Unix()}
+			cfg := newFakeConfig(&pb.Configuration{Agency: "sf-muni", Stops: []*pb.Stop{{Id: "1234"}}, Override: existing}, "")
+			srv := newServer(testPort, goodFakeNb, cfg, testUsers)
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/signs/default/override", strings.NewReader(test.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			srv.signHandler(rec, req)
+
+			if rec.Code != test.wantCode {
+				t.Fatalf("got code %d want %d", rec.Code, test.wantCode)
+			}
+			got := cfg.config("default")
+			if test.wantCode != http.StatusSeeOther {
+				if !proto.Equal(got.GetOverride(), existing) {
+					t.Errorf("override changed by failed request: got %v want %v", got.GetOverride(), existing)
+				}
+				return
+			}
+			if !proto.Equal(got.GetOverride(), test.wantOverride) {
+				t.Errorf("got override %v want %v", got.GetOverride(), test.wantOverride)
+			}
+			if got.GetAgency() != "sf-muni" || len(got.GetStops()) != 1 {
+				t.Errorf("setting the override changed the rest of the configuration: %v", got)
+			}
+		})
+	}
+}
+
+func TestUpdateConfigKeepsOverride(t *testing.T) {
+	o := &pb.MessageOverride{Text: "Office closed", ExpireTime: time.Now().Add(time.Hour).Unix()}
+	cfg := newFakeConfig(&pb.Configuration{Agency: "sf-muni", Override: o}, "")
+	srv := newServer(testPort, goodFakeNb, cfg, testUsers)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/signs/default", bytes.NewBufferString("agency=sf-muni&stop_id=9012"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	srv.signHandler(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got code %d want %d", rec.Code, http.StatusOK)
+	}
+	if got := cfg.config("default").GetOverride(); !proto.Equal(got, o) {
+		t.Errorf("got override %v want %v", got, o)
+	}
+	if !strings.Contains(rec.Body.String(), "Office closed") {
+		t.Errorf("sign page does not show the override")
+	}
+}
+
+func TestApiOverride(t *testing.T) {
+	defer func() { timeNow = time.Now }()
+	now := time.Unix(1500000000, 0)
+	timeNow = func() time.Time { return now }
+
+	cfg := newFakeConfig(testConfig, "")
+	srv := newServer(testPort, goodFakeNb, cfg, testUsers)
+
+	rec := httptest.NewRecorder()
+	srv.apiSignHandler(rec, httptest.NewRequest(http.MethodGet, "/api/signs/default/override", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("get missing override got code %d want %d", rec.Code, http.StatusNotFound)
+	}
+
+	body := fmt.Sprintf(`{"text": "Office closed today", "expire_time": %d}`, now.Add(time.Hour).Unix())
+	rec = httptest.NewRecorder()
+	srv.apiSignHandler(rec, httptest.NewRequest(http.MethodPut, "/api/signs/default/override", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Errorf("put override got code %d want %d", rec.Code, http.StatusOK)
+	}
+	want := &pb.MessageOverride{Text: "Office closed today", Color: &pb.Color{Red: 1.0, Green: 1.0, Blue: 1.0}, ExpireTime: now.Add(time.Hour).Unix()}
+	if got := cfg.config("default").GetOverride(); !proto.Equal(got, want) {
+		t.Errorf("stored override got %v want %v", got, want)
+	}
+	if got := cfg.config("default").GetAgency(); got != testConfig.GetAgency() {
+		t.Errorf("put override changed the agency to %q want %q", got, testConfig.GetAgency())
+	}
+
+	rec = httptest.NewRecorder()
+	srv.apiSignHandler(rec, httptest.NewRequest(http.MethodGet, "/api/signs/default/override", nil))
+	got := &pb.MessageOverride{}
+	if err := json.NewDecoder(rec.Body).Decode(got); err != nil {
+		t.Fatalf("error unmarshaling JSON response: %v", err)
+	}
+	if !proto.Equal(got, want) {
+		t.Errorf("get override got %v want %v", got, want)
+	}
+
+	// An expired override is not shown.
+	timeNow = func() time.Time { return now.Add(2 * time.Hour) }
+	rec = httptest.NewRecorder()
+	srv.apiSignHandler(rec, httptest.NewRequest(http.MethodGet, "/api/signs/default/override", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("get expired override got code %d want %d", rec.Code, http.StatusNotFound)
+	}
+
+	rec = httptest.NewRecorder()
+	srv.apiSignHandler(rec, httptest.NewRequest(http.MethodPut, "/api/signs/default/override", strings.NewReader(body)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("put override in the past got code %d want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	timeNow = func() time.Time { return now }
+	badColor := fmt.Sprintf(`{"text": "Office closed today", "color": {"red": 2}, "expire_time": %d}`, now.Add(time.Hour).Unix())
+	rec = httptest.NewRecorder()
+	srv.apiSignHandler(rec, httptest.NewRequest(http.MethodPut, "/api/signs/default/override", strings.NewReader(badColor)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("put override with an invalid color got code %d want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	rec = httptest.NewRecorder()
+	srv.apiSignHandler(rec, httptest.NewRequest(http.MethodDelete, "/api/signs/default/override", nil))
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("delete override got code %d want %d", rec.Code, http.StatusNoContent)
+	}
+	if got := cfg.config("default").GetOverride(); got != nil {
+		t.Errorf("override after delete got %v want <nil>", got)
+	}
+
+	timeNow = func() time.Time { return now }
+	rec = httptest.NewRecorder()
+	srv.apiSignHandler(rec, httptest.NewRequest(http.MethodPut, "/api/signs/bogus/override", strings.NewReader(body)))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("put override of unknown sign got code %d want %d", rec.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wallaceicy06/muni-sign/admin/config"
+	pb "github.com/wallaceicy06/muni-sign/proto"
+	"github.com/wallaceicy06/muni-sign/schedule"
+)
+
+// How long predictions fetched from the nextbus server are reused, and how
+// long clients may cache responses built from them. Arrivals are predicted in
+// whole minutes, so fetching them more often gains little.
+const predictionMaxAge = 30 * time.Second
+
+// How long to wait for the nextbus server to list predictions.
+const predictionTimeout = 10 * time.Second
+
+type predictionKey struct {
+	agency, stop string
+}
+
+type fetchedPredictions struct {
+	predictions []*pb.Prediction
+	fetchTime   time.Time
+}
+
+// predictionCache keeps the predictions fetched from the nextbus server for a
+// short while, so that clients polling the same stops do not each cause a
+// request. It is safe for concurrent use.
+type predictionCache struct {
+	nbClient pb.NextbusClient
+
+	mu      sync.Mutex
+	entries map[predictionKey]*fetchedPredictions
+}
+
+func newPredictionCache(nbClient pb.NextbusClient) *predictionCache {
+	return &predictionCache{
+		nbClient: nbClient,
+		entries:  make(map[predictionKey]*fetchedPredictions),
+	}
+}
+
+// get returns the predictions for a stop, fetching them unless they were
+// fetched less than predictionMaxAge ago.
+func (c *predictionCache) get(agency, stop string) (*fetchedPredictions, error) {
+	key := predictionKey{agency, stop}
+	now := timeNow()
+	c.mu.Lock()
+	if f, ok := c.entries[key]; ok && now.Sub(f.fetchTime) < predictionMaxAge {
+		c.mu.Unlock()
+		return f, nil
+	}
+	c.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), predictionTimeout)
+	defer cancel()
+	res, err := c.nbClient.ListPredictions(ctx, &pb.ListPredictionsRequest{Agency: agency, StopId: stop})
+	if err != nil {
+		return nil, err
+	}
+	f := &fetchedPredictions{res.GetPredictions(), now}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Drop stale predictions so that stops nobody asks for anymore do not
+	// pile up.
+	for k, e := range c.entries {
+		if now.Sub(e.fetchTime) >= predictionMaxAge {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = f
+	return f, nil
+}
+
+// predictionJSON is a prediction as served to web and mobile clients.
+type predictionJSON struct {
+	Route        string  `json:"route"`
+	Destination  string  `json:"destination"`
+	NextArrivals []int32 `json:"next_arrivals"`
+	// The lines that the sign shows for the prediction, or empty if none of
+	// the arrivals can be caught by walking to the stop now.
+	Lines []string `json:"lines,omitempty"`
+}
+
+// stopPredictionsJSON lists the predictions for a stop, as served by
+// /api/predictions.
+type stopPredictionsJSON struct {
+	Agency   string `json:"agency"`
+	Stop     string `json:"stop"`
+	Nickname string `json:"nickname,omitempty"`
+	// When the predictions were fetched from the nextbus server.
+	FetchTime   time.Time         `json:"fetch_time"`
+	Predictions []*predictionJSON `json:"predictions"`
+}
+
+// messageJSON is a message that a sign shows, as served by /api/board.
+type messageJSON struct {
+	Lines []string `json:"lines"`
+	// The CSS color of the message, such as "#ff0000".
+	Color string `json:"color"`
+	// The stop and route that the message predicts, unless it is an
+	// override.
+	Stop  string `json:"stop,omitempty"`
+	Route string `json:"route,omitempty"`
+}
+
+// boardJSON describes what a sign is showing, as served by /api/board.
+type boardJSON struct {
+	Sign string `json:"sign"`
+	// The active profile, if any.
+	Profile string `json:"profile,omitempty"`
+	// "blank" or "dim" during quiet hours, and empty otherwise.
+	Quiet string `json:"quiet,omitempty"`
+	// The messages that the sign cycles through, in order. An active
+	// override comes first.
+	Messages []*messageJSON `json:"messages"`
+	// What kept the board from being complete, such as stops whose
+	// predictions could not be fetched.
+	Errors []string `json:"errors,omitempty"`
+}
+
+// signStop returns the stop of a sign's configuration with the given ID, or a
+// stop without any settings if the configuration does not list it.
+func signStop(c *pb.Configuration, id string) *pb.Stop {
+	for _, s := range c.GetStops() {
+		if s.GetId() == id {
+			return s
+		}
+	}
+	return &pb.Stop{Id: id}
+}
+
+// setCacheExpiry lets clients cache a response until it is expected to change.
+func setCacheExpiry(w http.ResponseWriter, expires time.Time) {
+	maxAge := int(expires.Sub(timeNow()) / time.Second)
+	if maxAge <= 0 {
+		w.Header().Set("Cache-Control", "no-cache")
+		return
+	}
+	// Responses depend on who is signed in, so shared caches must not keep
+	// them.
+	w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", maxAge))
+}
+
+// apiPredictionsHandler serves the predictions for the stop given by the stop
+// parameter, formatted like the sign would show them. The stop's settings and
+// the agency are taken from the configuration of the sign given by the sign
+// parameter, or of the default sign, unless an agency parameter is given.
+func (s *server) apiPredictionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, fmt.Sprintf("Unsupported method: %s.", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+	id := strings.TrimSpace(r.FormValue("stop"))
+	if id == "" {
+		http.Error(w, "Stop must be provided.", http.StatusBadRequest)
+		return
+	}
+	sign := r.FormValue("sign")
+	if sign == "" {
+		sign = config.DefaultSignID
+	}
+
+	agency := r.FormValue("agency")
+	stop := &pb.Stop{Id: id}
+	if c, _, err := s.cfg.Get(sign); err == nil {
+		stop = signStop(c, id)
+		if agency == "" {
+			agency = c.GetAgency()
+		}
+	} else if agency == "" || r.FormValue("sign") != "" {
+		// Without a sign, predictions can still be listed for a given
+		// agency.
+		configError(w, err)
+		return
+	}
+
+	f, err := s.predictions.get(agency, id)
+	if err != nil {
+		w.Header().Set("Cache-Control", "no-store")
+		http.Error(w, fmt.Sprintf("Error listing predictions: %v.", err), http.StatusBadGateway)
+		return
+	}
+	res := &stopPredictionsJSON{
+		Agency:      agency,
+		Stop:        id,
+		Nickname:    stop.GetNickname(),
+		FetchTime:   f.fetchTime,
+		Predictions: []*predictionJSON{},
+	}
+	for _, p := range f.predictions {
+		pj := &predictionJSON{
+			Route:        p.GetRoute(),
+			Destination:  p.GetDestination(),
+			NextArrivals: p.GetNextArrivals(),
+		}
+		if msg, ok := schedule.FormatPrediction(stop, p); ok {
+			pj.Lines = strings.Split(msg, "\n")
+		}
+		res.Predictions = append(res.Predictions, pj)
+	}
+	setCacheExpiry(w, f.fetchTime.Add(predictionMaxAge))
+	writeJSON(w, res)
+}
+
+// apiBoardHandler serves the messages that the sign given by the sign
+// parameter, or the default sign, is cycling through right now, as its driver
+// would show them.
+func (s *server) apiBoardHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, fmt.Sprintf("Unsupported method: %s.", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+	sign := r.FormValue("sign")
+	if sign == "" {
+		sign = config.DefaultSignID
+	}
+	c, _, err := s.cfg.Get(sign)
+	if err != nil {
+		configError(w, err)
+		return
+	}
+
+	now := timeNow()
+	expires := now.Add(predictionMaxAge)
+	board := &boardJSON{Sign: sign, Messages: []*messageJSON{}}
+
+	quiet, end, err := schedule.InQuietHours(c.GetQuietHours(), now)
+	if err != nil {
+		board.Errors = append(board.Errors, fmt.Sprintf("quiet hours: %v", err))
+	}
+	if quiet {
+		if c.GetQuietHours().GetMode() == pb.QuietHours_BLANK {
+			// Nothing is shown until the quiet hours end.
+			board.Quiet = "blank"
+			setCacheExpiry(w, end)
+			writeJSON(w, board)
+			return
+		}
+		board.Quiet = "dim"
+		if end.Before(expires) {
+			expires = end
+		}
+	}
+
+	o := schedule.ActiveOverride(c, now)
+	if o != nil {
+		board.Messages = append(board.Messages, &messageJSON{
+			Lines: strings.Split(o.GetText(), "\n"),
+			Color: cssColor(schedule.OverrideColor(o)),
+		})
+		if t := time.Unix(o.GetExpireTime(), 0); t.Before(expires) {
+			expires = t
+		}
+	}
+
+	if o == nil || o.GetInterleave() {
+		sel, err := schedule.Select(c, now)
+		if err != nil {
+			board.Errors = append(board.Errors, fmt.Sprintf("schedule: %v", err))
+		}
+		board.Profile = sel.Profile
+		for i, stop := range sel.Stops {
+			f, err := s.predictions.get(c.GetAgency(), stop.GetId())
+			if err != nil {
+				board.Errors = append(board.Errors, fmt.Sprintf("stop %s: %v", stop.GetId(), err))
+				continue
+			}
+			if t := f.fetchTime.Add(predictionMaxAge); t.Before(expires) {
+				expires = t
+			}
+			color := cssColor(schedule.StopColor(stop, i))
+			for _, p := range f.predictions {
+				if !sel.Shows(stop, p.GetRoute()) {
+					continue
+				}
+				if msg, ok := schedule.FormatPrediction(stop, p); ok {
+					board.Messages = append(board.Messages, &messageJSON{
+						Lines: strings.Split(msg, "\n"),
+						Color: color,
+						Stop:  stop.GetId(),
+						Route: p.GetRoute(),
+					})
+				}
+			}
+		}
+	}
+
+	if len(board.Errors) > 0 {
+		// Try again soon rather than keeping a partial board.
+		w.Header().Set("Cache-Control", "no-store")
+	} else {
+		setCacheExpiry(w, expires)
+	}
+	writeJSON(w, board)
+}
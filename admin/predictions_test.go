@@ -0,0 +1,284 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	pb "github.com/wallaceicy06/muni-sign/proto"
+)
+
+var predictionsNb = &fakeNbClient{
+	predictionsRes: map[string]*pb.ListPredictionsResponse{
+		"1234": {Predictions: []*pb.Prediction{
+			{Route: "N", Destination: "Caltrain", NextArrivals: []int32{2, 7}},
+			{Route: "J", Destination: "Balboa Park", NextArrivals: []int32{1}},
+		}},
+		"5678": {Predictions: []*pb.Prediction{
+			{Route: "22", Destination: "Dogpatch", NextArrivals: []int32{12}},
+		}},
+	},
+}
+
+func TestApiPredictions(t *testing.T) {
+	now := time.Date(2017, time.March, 20, 8, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	cfg := &pb.Configuration{
+		Agency: "sf-muni",
+		Stops:  []*pb.Stop{{Id: "1234", Nickname: "Work", WalkingMinutes: 2}},
+	}
+
+	tests := []struct {
+		name      string
+		nb        *fakeNbClient
+		path      string
+		wantCode  int
+		wantRes   *stopPredictionsJSON
+		wantCache string
+	}{
+		{
+			name:     "StopOfSign",
+			nb:       predictionsNb,
+			path:     "/api/predictions?stop=1234",
+			wantCode: http.StatusOK,
+			wantRes: &stopPredictionsJSON{
+				Agency:    "sf-muni",
+				Stop:      "1234",
+				Nickname:  "Work",
+				FetchTime: now,
+				Predictions: []*predictionJSON{
+					{Route: "N", Destination: "Caltrain", NextArrivals: []int32{2, 7}, Lines: []string{"N-Work", "2 & 7 mins"}},
+					{Route: "J", Destination: "Balboa Park", NextArrivals: []int32{1}},
+				},
+			},
+			wantCache: "private, max-age=30",
+		},
+		{
+			name:     "OtherStop",
+			nb:       predictionsNb,
+			path:     "/api/predictions?stop=5678&agency=actransit",
+			wantCode: http.StatusOK,
+			wantRes: &stopPredictionsJSON{
+				Agency:    "actransit",
+				Stop:      "5678",
+				FetchTime: now,
+				Predictions: []*predictionJSON{
+					{Route: "22", Destination: "Dogpatch", NextArrivals: []int32{12}, Lines: []string{"22-Dogpatch", "12 mins"}},
+				},
+			},
+			wantCache: "private, max-age=30",
+		},
+		{
+			name:     "NoStop",
+			nb:       predictionsNb,
+			path:     "/api/predictions",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "UnknownSign",
+			nb:       predictionsNb,
+			path:     "/api/predictions?stop=1234&sign=lobby",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:      "NextbusError",
+			nb:        &fakeNbClient{predictionsErr: errors.New("fake list predictions error")},
+			path:      "/api/predictions?stop=1234",
+			wantCode:  http.StatusBadGateway,
+			wantCache: "no-store",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srv := newServer(testPort, test.nb, newFakeConfig(cfg, ""), testUsers)
+			rec := httptest.NewRecorder()
+			srv.apiPredictionsHandler(rec, httptest.NewRequest(http.MethodGet, test.path, nil))
+
+			if rec.Code != test.wantCode {
+				t.Fatalf("got code %d want %d", rec.Code, test.wantCode)
+			}
+			if got := rec.Header().Get("Cache-Control"); got != test.wantCache {
+				t.Errorf("got Cache-Control %q want %q", got, test.wantCache)
+			}
+			if test.wantRes == nil {
+				return
+			}
+			got := &stopPredictionsJSON{}
+			if err := json.NewDecoder(rec.Body).Decode(got); err != nil {
+				t.Fatalf("error decoding response: %v", err)
+			}
+			if !reflect.DeepEqual(got, test.wantRes) {
+				t.Errorf("got predictions %+v want %+v", got, test.wantRes)
+			}
+		})
+	}
+}
+
+func TestPredictionCache(t *testing.T) {
+	now := time.Date(2017, time.March, 20, 8, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	nb := &fakeNbClient{predictionsRes: predictionsNb.predictionsRes}
+	srv := newServer(testPort, nb, newFakeConfig(testConfig, ""), testUsers)
+	get := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		srv.apiPredictionsHandler(rec, httptest.NewRequest(http.MethodGet, "/api/predictions?stop=1234", nil))
+		return rec
+	}
+
+	get()
+	now = now.Add(20 * time.Second)
+	if got, want := get().Header().Get("Cache-Control"), "private, max-age=10"; got != want {
+		t.Errorf("got Cache-Control %q for cached predictions want %q", got, want)
+	}
+	if nb.predictionsCalls != 1 {
+		t.Errorf("got %d calls to ListPredictions want 1", nb.predictionsCalls)
+	}
+
+	now = now.Add(10 * time.Second)
+	if got, want := get().Header().Get("Cache-Control"), "private, max-age=30"; got != want {
+		t.Errorf("got Cache-Control %q for refetched predictions want %q", got, want)
+	}
+	if nb.predictionsCalls != 2 {
+		t.Errorf("got %d calls to ListPredictions want 2", nb.predictionsCalls)
+	}
+}
+
+func TestApiBoard(t *testing.T) {
+	// A Monday.
+	now := time.Date(2017, time.March, 20, 8, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	stops := []*pb.Stop{{Id: "1234", Routes: []string{"N"}}, {Id: "5678", Color: &pb.Color{Green: 1.0}}}
+	nMessage := &messageJSON{Lines: []string{"N-Caltrain", "2 & 7 mins"}, Color: "#ff0000", Stop: "1234", Route: "N"}
+	message22 := &messageJSON{Lines: []string{"22-Dogpatch", "12 mins"}, Color: "#00ff00", Stop: "5678", Route: "22"}
+
+	tests := []struct {
+		name      string
+		cfg       *pb.Configuration
+		nb        *fakeNbClient
+		wantBoard *boardJSON
+		wantCache string
+	}{
+		{
+			name:      "Predictions",
+			cfg:       &pb.Configuration{Agency: "sf-muni", Stops: stops},
+			nb:        predictionsNb,
+			wantBoard: &boardJSON{Sign: "default", Messages: []*messageJSON{nMessage, message22}},
+			wantCache: "private, max-age=30",
+		},
+		{
+			name: "Profile",
+			cfg: &pb.Configuration{
+				Agency:   "sf-muni",
+				Stops:    stops,
+				Profiles: []*pb.Profile{{Name: "commute", StopIds: []string{"5678"}}},
+				Schedule: &pb.Schedule{DefaultProfile: "commute"},
+			},
+			nb:        predictionsNb,
+			wantBoard: &boardJSON{Sign: "default", Profile: "commute", Messages: []*messageJSON{message22}},
+			wantCache: "private, max-age=30",
+		},
+		{
+			name: "Override",
+			cfg: &pb.Configuration{
+				Agency:   "sf-muni",
+				Stops:    stops,
+				Override: &pb.MessageOverride{Text: "Office\nclosed", ExpireTime: now.Add(10 * time.Second).Unix()},
+			},
+			nb:        predictionsNb,
+			wantBoard: &boardJSON{Sign: "default", Messages: []*messageJSON{{Lines: []string{"Office", "closed"}, Color: "#ffffff"}}},
+			wantCache: "private, max-age=10",
+		},
+		{
+			name: "InterleavedOverride",
+			cfg: &pb.Configuration{
+				Agency:   "sf-muni",
+				Stops:    stops[1:],
+				Override: &pb.MessageOverride{Text: "Hi", Color: &pb.Color{Blue: 1.0}, ExpireTime: now.Add(time.Hour).Unix(), Interleave: true},
+			},
+			nb:        predictionsNb,
+			wantBoard: &boardJSON{Sign: "default", Messages: []*messageJSON{{Lines: []string{"Hi"}, Color: "#0000ff"}, message22}},
+			wantCache: "private, max-age=30",
+		},
+		{
+			name: "Blank",
+			cfg: &pb.Configuration{
+				Agency: "sf-muni",
+				Stops:  stops,
+				QuietHours: &pb.QuietHours{
+					Mode:  pb.QuietHours_BLANK,
+					Start: &pb.TimeOfDay{OffsetMinutes: 22 * 60},
+					End:   &pb.TimeOfDay{OffsetMinutes: 8*60 + 1},
+				},
+			},
+			nb:        predictionsNb,
+			wantBoard: &boardJSON{Sign: "default", Quiet: "blank", Messages: []*messageJSON{}},
+			wantCache: "private, max-age=60",
+		},
+		{
+			name: "Dim",
+			cfg: &pb.Configuration{
+				Agency: "sf-muni",
+				Stops:  stops[1:],
+				QuietHours: &pb.QuietHours{
+					Mode:  pb.QuietHours_DIM,
+					Start: &pb.TimeOfDay{OffsetMinutes: 22 * 60},
+					End:   &pb.TimeOfDay{OffsetMinutes: 9 * 60},
+				},
+			},
+			nb:        predictionsNb,
+			wantBoard: &boardJSON{Sign: "default", Quiet: "dim", Messages: []*messageJSON{message22}},
+			wantCache: "private, max-age=30",
+		},
+		{
+			name:      "NextbusError",
+			cfg:       &pb.Configuration{Agency: "sf-muni", Stops: stops[:1]},
+			nb:        &fakeNbClient{predictionsErr: errors.New("fake list predictions error")},
+			wantBoard: &boardJSON{Sign: "default", Messages: []*messageJSON{}, Errors: []string{"stop 1234: fake list predictions error"}},
+			wantCache: "no-store",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srv := newServer(testPort, test.nb, newFakeConfig(test.cfg, ""), testUsers)
+			rec := httptest.NewRecorder()
+			srv.apiBoardHandler(rec, httptest.NewRequest(http.MethodGet, "/api/board", nil))
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("got code %d want %d", rec.Code, http.StatusOK)
+			}
+			if got := rec.Header().Get("Cache-Control"); got != test.wantCache {
+				t.Errorf("got Cache-Control %q want %q", got, test.wantCache)
+			}
+			got := &boardJSON{}
+			if err := json.NewDecoder(rec.Body).Decode(got); err != nil {
+				t.Fatalf("error decoding response: %v", err)
+			}
+			if !reflect.DeepEqual(got, test.wantBoard) {
+				gotJSON, _ := json.Marshal(got)
+				wantJSON, _ := json.Marshal(test.wantBoard)
+				t.Errorf("got board %s want %s", gotJSON, wantJSON)
+			}
+		})
+	}
+}
+
+func TestApiBoardUnknownSign(t *testing.T) {
+	srv := newServer(testPort, predictionsNb, newFakeConfig(testConfig, ""), testUsers)
+	rec := httptest.NewRecorder()
+	srv.apiBoardHandler(rec, httptest.NewRequest(http.MethodGet, "/api/board?sign=lobby", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("got code %d want %d", rec.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/wallaceicy06/muni-sign/admin/config"
+	pb "github.com/wallaceicy06/muni-sign/proto"
+	"github.com/wallaceicy06/muni-sign/schedule"
+)
+
+// How many empty rows the schedule form offers for adding profiles and rules.
+const blankScheduleRows = 2
+
+// profileRow is a row of the profiles table in the schedule form.
+type profileRow struct {
+	Name   string
+	Stops  string
+	Routes string
+}
+
+// ruleRow is a row of the rules table in the schedule form.
+type ruleRow struct {
+	Profile string
+	Days    string
+	Start   string
+	End     string
+}
+
+// Selection returns what the sign shows right now and why.
+func (t *signTemplate) Selection() *schedule.Selection {
+	sel, err := schedule.Select(t.Cfg, timeNow())
+	if err != nil {
+		sel.Reason = fmt.Sprintf("%s (%v)", sel.Reason, err)
+	}
+	return sel
+}
+
+// ProfileRows returns the rows of the profiles table, with room for new
+// profiles at the end.
+func (t *signTemplate) ProfileRows() []profileRow {
+	var rows []profileRow
+	for _, p := range t.Cfg.GetProfiles() {
+		rows = append(rows, profileRow{
+			Name:   p.GetName(),
+			Stops:  strings.Join(p.GetStopIds(), " "),
+			Routes: strings.Join(p.GetRoutes(), " "),
+		})
+	}
+	return append(rows, make([]profileRow, blankScheduleRows)...)
+}
+
+// RuleRows returns the rows of the rules table, with room for new rules at
+// the end.
+func (t *signTemplate) RuleRows() []ruleRow {
+	var rows []ruleRow
+	for _, r := range t.Cfg.GetSchedule().GetRules() {
+		rows = append(rows, ruleRow{
+			Profile: r.GetProfile(),
+			Days:    schedule.FormatDays(r.GetDays()),
+			Start:   schedule.FormatMinute(r.GetStartMinute()),
+			End:     schedule.FormatMinute(r.GetEndMinute()),
+		})
+	}
+	return append(rows, make([]ruleRow, blankScheduleRows)...)
+}
+
+// parseScheduleForm reads the profiles and schedule submitted with the
+// schedule form. Rows whose name or profile is empty are left out.
+func parseScheduleForm(r *http.Request) ([]*pb.Profile, *pb.Schedule, error) {
+	var profiles []*pb.Profile
+	names, stops, routes := r.Form["profile_name"], r.Form["profile_stops"], r.Form["profile_routes"]
+	if len(stops) != len(names) || len(routes) != len(names) {
+		return nil, nil, errors.New("incomplete profiles")
+	}
+	for i, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		profiles = append(profiles, &pb.Profile{
+			Name:    name,
+			StopIds: strings.Fields(stops[i]),
+			Routes:  strings.Fields(routes[i]),
+		})
+	}
+
+	sched := &pb.Schedule{
+		TimeZone:       strings.TrimSpace(r.Form.Get("time_zone")),
+		DefaultProfile: r.Form.Get("default_profile"),
+	}
+	ruleProfiles, days, starts, ends := r.Form["rule_profile"], r.Form["rule_days"], r.Form["rule_start"], r.Form["rule_end"]
+	if len(days) != len(ruleProfiles) || len(starts) != len(ruleProfiles) || len(ends) != len(ruleProfiles) {
+		return nil, nil, errors.New("incomplete rules")
+	}
+	for i, profile := range ruleProfiles {
+		profile = strings.TrimSpace(profile)
+		if profile == "" {
+			continue
+		}
+		d, err := schedule.ParseDays(days[i])
+		if err != nil {
+			return nil, nil, fmt.Errorf("rule %d: %v", len(sched.Rules)+1, err)
+		}
+		// Rules without times last all day.
+		if starts[i] == "" {
+			starts[i] = "00:00"
+		}
+		if ends[i] == "" {
+			ends[i] = "24:00"
+		}
+		start, err := schedule.ParseMinute(starts[i])
+		if err != nil {
+			return nil, nil, fmt.Errorf("rule %d: %v", len(sched.Rules)+1, err)
+		}
+		end, err := schedule.ParseMinute(ends[i])
+		if err != nil {
+			return nil, nil, fmt.Errorf("rule %d: %v", len(sched.Rules)+1, err)
+		}
+		sched.Rules = append(sched.Rules, &pb.ScheduleRule{
+			Profile:     profile,
+			Days:        d,
+			StartMinute: start,
+			EndMinute:   end,
+		})
+	}
+	if proto.Equal(sched, &pb.Schedule{}) {
+		sched = nil
+	}
+	return profiles, sched, nil
+}
+
+// scheduleHandler replaces the profiles and schedule of the sign named in the
+// path, /signs/<id>/schedule, from the form on the sign's page.
+func (s *server) scheduleHandler(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, fmt.Sprintf("Unsupported method: %s.", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, fmt.Sprintf("Internal error: %v", err), http.StatusInternalServerError)
+		return
+	}
+	profiles, sched, err := parseScheduleForm(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid schedule: %v.", err), http.StatusBadRequest)
+		return
+	}
+
+	c, rev, err := s.cfg.Get(id)
+	if err != nil {
+		configError(w, err)
+		return
+	}
+	if formRev := r.Form.Get("revision"); formRev != "" && formRev != rev {
+		configError(w, config.ErrConflict)
+		return
+	}
+	c = proto.Clone(c).(*pb.Configuration)
+	c.Profiles = profiles
+	c.Schedule = sched
+	if err := schedule.Validate(c); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid schedule: %v.", err), http.StatusBadRequest)
+		return
+	}
+	if _, err := s.configFor(r).Put(id, c, rev); err != nil {
+		configError(w, err)
+		return
+	}
+	http.Redirect(w, r, "/signs/"+id, http.StatusSeeOther)
+}
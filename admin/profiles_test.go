@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/wallaceicy06/muni-sign/proto"
+)
+
+var testProfiles = []*pb.Profile{
+	{Name: "Inbound", StopIds: []string{"5678"}, Routes: []string{"N"}},
+	{Name: "Park", StopIds: []string{"3456"}},
+}
+
+var testSchedule = &pb.Schedule{
+	TimeZone: "America/Los_Angeles",
+	Rules: []*pb.ScheduleRule{
+		{Profile: "Inbound", Days: []int32{1, 2, 3, 4, 5}, StartMinute: 7 * 60, EndMinute: 10 * 60},
+		{Profile: "Park", Days: []int32{0, 6}, StartMinute: 0, EndMinute: 24 * 60},
+	},
+}
+
+func TestScheduleForm(t *testing.T) {
+	tests := []struct {
+		name         string
+		form         url.Values
+		wantCode     int
+		wantProfiles []*pb.Profile
+		wantSchedule *pb.Schedule
+	}{
+		{
+			name: "Set",
+			form: url.Values{
+				"profile_name":   {"Inbound", "Park", ""},
+				"profile_stops":  {"5678", " 3456 ", ""},
+				"profile_routes": {"N", "", ""},
+				"time_zone":      {"America/Los_Angeles"},
+				"rule_profile":   {"Inbound", "Park", ""},
+				"rule_days":      {"Mon-Fri", "Sat Sun", ""},
+				"rule_start":     {"07:00", "", ""},
+				"rule_end":       {"10:00", "", ""},
+			},
+			wantCode:     http.StatusSeeOther,
+			wantProfiles: testProfiles,
+			wantSchedule: testSchedule,
+		},
+		{
+			name: "Clear",
+			form: url.Values{
+				"profile_name":   {""},
+				"profile_stops":  {""},
+				"profile_routes": {""},
+				"rule_profile":   {""},
+				"rule_days":      {""},
+				"rule_start":     {""},
+				"rule_end":       {""},
+			},
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name: "StaleRevision",
+			form: url.Values{
+				"revision": {"rev0"},
+			},
+			wantCode: http.StatusConflict,
+		},
+		{
+			name: "InvalidDays",
+			form: url.Values{
+				"rule_profile": {"Inbound"},
+				"rule_days":    {"Someday"},
+				"rule_start":   {""},
+				"rule_end":     {""},
+			},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name: "UnknownProfile",
+			form: url.Values{
+				"rule_profile": {"Outbound"},
+				"rule_days":    {""},
+				"rule_start":   {""},
+				"rule_end":     {""},
+			},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name: "UnknownTimeZone",
+			form: url.Values{
+				"time_zone": {"Mars/Olympus_Mons"},
+			},
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := newFakeConfig(&pb.Configuration{Agency: "sf-muni", Stops: []*pb.Stop{{Id: "1234"}}}, "rev1")
+			srv := newServer(testPort, goodFakeNb, cfg, testUsers)
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/signs/default/schedule", strings.NewReader(test.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			srv.signHandler(rec, req)
+
+			if rec.Code != test.wantCode {
+				t.Fatalf("got code %d want %d", rec.Code, test.wantCode)
+			}
+			got := cfg.config("default")
+			want := &pb.Configuration{
+				Agency:   "sf-muni",
+				Stops:    []*pb.Stop{{Id: "1234"}},
+				Profiles: test.wantProfiles,
+				Schedule: test.wantSchedule,
+			}
+			if !proto.Equal(got, want) {
+				t.Errorf("got configuration %v want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestUpdateConfigKeepsSchedule(t *testing.T) {
+	cfg := newFakeConfig(&pb.Configuration{Agency: "sf-muni", Profiles: testProfiles, Schedule: testSchedule}, "")
+	srv := newServer(testPort, goodFakeNb, cfg, testUsers)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/signs/default", bytes.NewBufferString("agency=sf-muni&stop_id=9012"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	srv.signHandler(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got code %d want %d", rec.Code, http.StatusOK)
+	}
+	got := cfg.config("default")
+	if !proto.Equal(got.GetSchedule(), testSchedule) || len(got.GetProfiles()) != len(testProfiles) {
+		t.Errorf("got profiles %v and schedule %v want %v and %v", got.GetProfiles(), got.GetSchedule(), testProfiles, testSchedule)
+	}
+}
+
+func TestSignPageShowsActiveProfile(t *testing.T) {
+	defer func() { timeNow = time.Now }()
+	la, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Fatalf("time.LoadLocation() = _, %v want _, <nil>", err)
+	}
+	timeNow = func() time.Time { return time.Date(2017, 7, 11, 8, 0, 0, 0, la) }
+
+	cfg := newFakeConfig(&pb.Configuration{Agency: "sf-muni", Profiles: testProfiles, Schedule: testSchedule}, "")
+	srv := newServer(testPort, goodFakeNb, cfg, testUsers)
+
+	rec := httptest.NewRecorder()
+	srv.signHandler(rec, httptest.NewRequest(http.MethodGet, "/signs/default", nil))
+	body := rec.Body.String()
+	for _, s := range []string{"<strong>Inbound</strong> profile", "Mon-Fri 07:00-10:00", `value="Sun Sat"`} {
+		if !strings.Contains(body, s) {
+			t.Errorf("sign page does not contain %q", s)
+		}
+	}
+}
+
+func TestApiConfigPutInvalidSchedule(t *testing.T) {
+	cfg := newFakeConfig(testConfig, "")
+	srv := newServer(testPort, goodFakeNb, cfg, testUsers)
+
+	body := `{"agency": "sf-muni", "schedule": {"rules": [{"profile": "Inbound", "end_minute": 60}]}}`
+	rec := httptest.NewRecorder()
+	srv.apiSignHandler(rec, httptest.NewRequest(http.MethodPut, "/api/signs/default/config", strings.NewReader(body)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("got code %d want %d", rec.Code, http.StatusBadRequest)
+	}
+	if got := cfg.config("default"); !proto.Equal(got, testConfig) {
+		t.Errorf("configuration changed to %v want %v", got, testConfig)
+	}
+}
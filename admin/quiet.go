@@ -0,0 +1,159 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/wallaceicy06/muni-sign/admin/config"
+	pb "github.com/wallaceicy06/muni-sign/proto"
+	"github.com/wallaceicy06/muni-sign/schedule"
+)
+
+// The quiet hours offered by the form of a sign that has none.
+var defaultQuietHours = &pb.QuietHours{
+	Mode:     pb.QuietHours_DIM,
+	Start:    &pb.TimeOfDay{OffsetMinutes: 22 * 60},
+	End:      &pb.TimeOfDay{OffsetMinutes: 7 * 60},
+	DimColor: &pb.Color{Red: 1.0},
+}
+
+// quietView describes the quiet hours of a sign in the form on its page.
+type quietView struct {
+	Enabled   bool
+	Dim       bool
+	Start     string
+	End       string
+	TimeZone  string
+	Latitude  string
+	Longitude string
+	// The brightness of the dimmed display, in percent.
+	Brightness int
+	DimColor   string
+	// When the current quiet hours end, or empty if it is not quiet now.
+	Until string
+}
+
+// Quiet returns the quiet hours of the sign, or the ones offered by default
+// if it has none.
+func (t *signTemplate) Quiet() *quietView {
+	q := t.Cfg.GetQuietHours()
+	if q == nil {
+		q = proto.Clone(defaultQuietHours).(*pb.QuietHours)
+		q.TimeZone = t.Cfg.GetSchedule().GetTimeZone()
+	}
+	v := &quietView{
+		Enabled:    t.Cfg.GetQuietHours() != nil,
+		Dim:        q.GetMode() == pb.QuietHours_DIM,
+		Start:      schedule.FormatTimeOfDay(q.GetStart()),
+		End:        schedule.FormatTimeOfDay(q.GetEnd()),
+		TimeZone:   q.GetTimeZone(),
+		Brightness: int(math.Round(q.GetBrightness() * 100)),
+		DimColor:   cssColor(q.GetDimColor()),
+	}
+	if q.GetDimColor() == nil {
+		v.DimColor = cssColor(defaultQuietHours.GetDimColor())
+	}
+	if v.Brightness == 0 {
+		v.Brightness = int(schedule.DefaultDimBrightness * 100)
+	}
+	if q.GetLatitude() != 0 || q.GetLongitude() != 0 {
+		v.Latitude = strconv.FormatFloat(q.GetLatitude(), 'f', -1, 64)
+		v.Longitude = strconv.FormatFloat(q.GetLongitude(), 'f', -1, 64)
+	}
+	if quiet, end, err := schedule.InQuietHours(t.Cfg.GetQuietHours(), timeNow()); err == nil && quiet {
+		v.Until = end.Format("Mon 15:04 MST")
+	}
+	return v
+}
+
+// parseQuietForm reads the quiet hours submitted with the quiet hours form,
+// which are nil if they are not enabled.
+func parseQuietForm(r *http.Request) (*pb.QuietHours, error) {
+	if r.Form.Get("quiet_enabled") == "" {
+		return nil, nil
+	}
+	start, err := schedule.ParseTimeOfDay(r.Form.Get("quiet_start"))
+	if err != nil {
+		return nil, fmt.Errorf("start: %v", err)
+	}
+	end, err := schedule.ParseTimeOfDay(r.Form.Get("quiet_end"))
+	if err != nil {
+		return nil, fmt.Errorf("end: %v", err)
+	}
+	q := &pb.QuietHours{
+		Start:    start,
+		End:      end,
+		TimeZone: strings.TrimSpace(r.Form.Get("quiet_time_zone")),
+	}
+	if lat, lon := strings.TrimSpace(r.Form.Get("latitude")), strings.TrimSpace(r.Form.Get("longitude")); lat != "" || lon != "" {
+		if q.Latitude, err = strconv.ParseFloat(lat, 64); err != nil {
+			return nil, fmt.Errorf("invalid latitude %q", lat)
+		}
+		if q.Longitude, err = strconv.ParseFloat(lon, 64); err != nil {
+			return nil, fmt.Errorf("invalid longitude %q", lon)
+		}
+	}
+
+	switch mode := r.Form.Get("quiet_mode"); mode {
+	case "blank":
+		q.Mode = pb.QuietHours_BLANK
+	case "dim":
+		q.Mode = pb.QuietHours_DIM
+		percent, err := strconv.Atoi(r.Form.Get("quiet_brightness"))
+		if err != nil || percent < 1 || percent > 100 {
+			return nil, errors.New("brightness must be between 1 and 100 percent")
+		}
+		q.Brightness = float64(percent) / 100
+		if q.DimColor, err = parseCSSColor(r.Form.Get("quiet_color")); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported mode %q", mode)
+	}
+	return q, nil
+}
+
+// quietHandler replaces the quiet hours of the sign named in the path,
+// /signs/<id>/quiet, from the form on the sign's page.
+func (s *server) quietHandler(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, fmt.Sprintf("Unsupported method: %s.", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, fmt.Sprintf("Internal error: %v", err), http.StatusInternalServerError)
+		return
+	}
+	q, err := parseQuietForm(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid quiet hours: %v.", err), http.StatusBadRequest)
+		return
+	}
+
+	c, rev, err := s.cfg.Get(id)
+	if err != nil {
+		configError(w, err)
+		return
+	}
+	if formRev := r.Form.Get("revision"); formRev != "" && formRev != rev {
+		configError(w, config.ErrConflict)
+		return
+	}
+	c = proto.Clone(c).(*pb.Configuration)
+	c.QuietHours = q
+	if err := schedule.Validate(c); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid configuration: %v.", err), http.StatusBadRequest)
+		return
+	}
+	if _, err := s.configFor(r).Put(id, c, rev); err != nil {
+		configError(w, err)
+		return
+	}
+	http.Redirect(w, r, "/signs/"+id, http.StatusSeeOther)
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/wallaceicy06/muni-sign/proto"
+)
+
+var testQuietHours = &pb.QuietHours{
+	Mode:       pb.QuietHours_DIM,
+	Start:      &pb.TimeOfDay{Reference: pb.TimeOfDay_SUNSET, OffsetMinutes: 30},
+	End:        &pb.TimeOfDay{OffsetMinutes: 7 * 60},
+	TimeZone:   "America/Los_Angeles",
+	Latitude:   37.7749,
+	Longitude:  -122.4194,
+	Brightness: 0.1,
+	DimColor:   &pb.Color{Red: 1.0},
+}
+
+func TestQuietForm(t *testing.T) {
+	tests := []struct {
+		name     string
+		form     url.Values
+		wantCode int
+		want     *pb.QuietHours
+	}{
+		{
+			name: "Dim",
+			form: url.Values{
+				"quiet_enabled":    {"on"},
+				"quiet_start":      {"sunset+30m"},
+				"quiet_end":        {"07:00"},
+				"quiet_time_zone":  {"America/Los_Angeles"},
+				"latitude":         {"37.7749"},
+				"longitude":        {"-122.4194"},
+				"quiet_mode":       {"dim"},
+				"quiet_brightness": {"10"},
+				"quiet_color":      {"#ff0000"},
+			},
+			wantCode: http.StatusSeeOther,
+			want:     testQuietHours,
+		},
+		{
+			name: "Blank",
+			form: url.Values{
+				"quiet_enabled":    {"on"},
+				"quiet_start":      {"23:00"},
+				"quiet_end":        {"06:00"},
+				"quiet_mode":       {"blank"},
+				"quiet_brightness": {"20"},
+				"quiet_color":      {"#ff0000"},
+			},
+			wantCode: http.StatusSeeOther,
+			want: &pb.QuietHours{
+				Mode:  pb.QuietHours_BLANK,
+				Start: &pb.TimeOfDay{OffsetMinutes: 23 * 60},
+				End:   &pb.TimeOfDay{OffsetMinutes: 6 * 60},
+			},
+		},
+		{
+			name: "Disabled",
+			form: url.Values{
+				"quiet_start": {"23:00"},
+				"quiet_end":   {"06:00"},
+				"quiet_mode":  {"blank"},
+			},
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name: "StaleRevision",
+			form: url.Values{
+				"revision": {"rev0"},
+			},
+			wantCode: http.StatusConflict,
+		},
+		{
+			name: "InvalidTime",
+			form: url.Values{
+				"quiet_enabled": {"on"},
+				"quiet_start":   {"dusk"},
+				"quiet_end":     {"06:00"},
+				"quiet_mode":    {"blank"},
+			},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name: "SunsetWithoutLocation",
+			form: url.Values{
+				"quiet_enabled": {"on"},
+				"quiet_start":   {"sunset"},
+				"quiet_end":     {"06:00"},
+				"quiet_mode":    {"blank"},
+			},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name: "InvalidBrightness",
+			form: url.Values{
+				"quiet_enabled":    {"on"},
+				"quiet_start":      {"23:00"},
+				"quiet_end":        {"06:00"},
+				"quiet_mode":       {"dim"},
+				"quiet_brightness": {"0"},
+				"quiet_color":      {"#ff0000"},
+			},
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := newFakeConfig(&pb.Configuration{Agency: "sf-muni", Stops: []*pb.Stop{{Id: "1234"}}}, "rev1")
+			srv := newServer(testPort, goodFakeNb, cfg, testUsers)
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/signs/default/quiet", strings.NewReader(test.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			srv.signHandler(rec, req)
+
+			if rec.Code != test.wantCode {
+				t.Fatalf("got code %d want %d", rec.Code, test.wantCode)
+			}
+			if got := cfg.config("default").GetQuietHours(); !proto.Equal(got, test.want) {
+				t.Errorf("got quiet hours %v want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestUpdateConfigKeepsQuietHours(t *testing.T) {
+	cfg := newFakeConfig(&pb.Configuration{Agency: "sf-muni", QuietHours: testQuietHours}, "")
+	srv := newServer(testPort, goodFakeNb, cfg, testUsers)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/signs/default", bytes.NewBufferString("agency=sf-muni&stop_id=9012"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	srv.signHandler(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got code %d want %d", rec.Code, http.StatusOK)
+	}
+	if got := cfg.config("default").GetQuietHours(); !proto.Equal(got, testQuietHours) {
+		t.Errorf("got quiet hours %v want %v", got, testQuietHours)
+	}
+}
+
+func TestSignPageShowsQuietHours(t *testing.T) {
+	defer func() { timeNow = time.Now }()
+	la, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Fatalf("time.LoadLocation() = _, %v want _, <nil>", err)
+	}
+	timeNow = func() time.Time { return time.Date(2017, 7, 11, 23, 0, 0, 0, la) }
+
+	cfg := newFakeConfig(&pb.Configuration{Agency: "sf-muni", QuietHours: testQuietHours}, "")
+	srv := newServer(testPort, goodFakeNb, cfg, testUsers)
+
+	rec := httptest.NewRecorder()
+	srv.signHandler(rec, httptest.NewRequest(http.MethodGet, "/signs/default", nil))
+	body := rec.Body.String()
+	for _, s := range []string{"quiet hours until Wed 07:00 PDT", `value="sunset&#43;30m"`, `value="10"`, `value="#ff0000"`} {
+		if !strings.Contains(body, s) {
+			t.Errorf("sign page does not contain %q", s)
+		}
+	}
+}
@@ -5,54 +5,120 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
-	"html/template"
+	"io"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"time"
 
 	"google.golang.org/grpc"
 
+	"github.com/wallaceicy06/muni-sign/admin/auth"
 	"github.com/wallaceicy06/muni-sign/admin/config"
+	"github.com/wallaceicy06/muni-sign/display"
 	pb "github.com/wallaceicy06/muni-sign/proto"
+	"github.com/wallaceicy06/muni-sign/schedule"
 )
 
 const cacheTimeout = 24 * time.Hour
 
-var templates = template.Must(template.ParseFiles("admin/templates/index.html", "admin/templates/home.html"))
+// How long a signed in user may be idle before having to sign in again.
+const sessionTimeout = 12 * time.Hour
+
+// How often an idle configuration stream sends a comment to keep intermediate
+// proxies from closing the connection.
+const watchKeepAlive = 30 * time.Second
+
+// How often the configuration file is checked for edits made outside of the
+// admin server.
+const configPollInterval = 2 * time.Second
 
 var configFilePath = flag.String("config_file", "", "the path to the file that stores the configuration for the sign")
+var configBackend = flag.String("config_backend", "file", "where to store the configuration of the signs: \"file\" or \"bolt\"")
+var configDBPath = flag.String("config_db", "", "the path to the database that stores the configuration when -config_backend=bolt")
 var nbServerAddr = flag.String("nextbus_server", "", "the address of the nextbus server")
+var credentialsFilePath = flag.String("credentials_file", "", "the path to the file that stores the users allowed to configure the sign")
+var assetsDir = flag.String("assets_dir", "", "serve the templates and public directories from this directory, reloading templates on every request, instead of using the copies built into the binary (for development)")
+var auditLogPath = flag.String("audit_log", "", "the path to the file that records who changed the configuration and signed in, and when (optional)")
+var agencyCacheFilePath = flag.String("agency_cache_file", "", "the path to a file that saves the list of agencies across restarts (optional)")
 
 var port = flag.Int("port", 8080, "the port to serve this webserver")
+var grpcPort = flag.Int("grpc_port", 8082, "the port to serve the SignConfigService gRPC API and the emulated DisplayDriver on, or 0 to not serve them")
 
 // Alias for time.Now facilitate testing.
 var timeNow = time.Now
 
 type server struct {
-	cfg         config.SignConfig
-	port        int
-	nbClient    pb.NextbusClient
-	agencyCache *agencyCache
+	cfg      config.SignConfig
+	port     int
+	nbClient pb.NextbusClient
+	users    auth.CredentialStore
+	sessions *auth.SessionManager
+	agencies *agencyCache
+	// Predictions served by /api/predictions and /api/board.
+	predictions *predictionCache
+	statuses    *statusStore
+	audit       *auditLog
+	// Shows what drivers write to the DisplayDriver served over gRPC.
+	emulator *display.Web
+	assets   *assets
 }
 
-type agencyCache struct {
-	agencies    []*pb.Agency
-	lastRefresh time.Time
+type fleetTemplate struct {
+	Signs []*pb.Sign
+	accountTemplate
 }
 
-type rootTemplate struct {
+type signTemplate struct {
+	Sign     *pb.Sign
 	Cfg      *pb.Configuration
+	Revision string
 	Agencies []*pb.Agency
+	accountTemplate
+}
+
+type conflictTemplate struct {
+	// The configuration that is currently stored.
+	Current *pb.Configuration
+	// The configuration that the user tried to submit, along with the current
+	// revision so that it may be resubmitted.
+	Form *signTemplate
 }
 
 func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] [command args...]\n\n%s\n\nFlags:\n", os.Args[0], commandUsage)
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 
-	if *configFilePath == "" {
-		fmt.Fprintln(os.Stderr, "A config file path is required.")
+	if flag.NArg() > 0 {
+		if err := runCommand(flag.Args(), os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	switch *configBackend {
+	case "file":
+		if *configFilePath == "" {
+			fmt.Fprintln(os.Stderr, "A config file path is required.")
+			flag.Usage()
+			os.Exit(1)
+		}
+	case "bolt":
+		if *configDBPath == "" {
+			fmt.Fprintln(os.Stderr, "A config database path is required.")
+			flag.Usage()
+			os.Exit(1)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown config backend %q.\n", *configBackend)
 		flag.Usage()
 		os.Exit(1)
 	}
@@ -63,6 +129,12 @@ func main() {
 		os.Exit(1)
 	}
 
+	if *credentialsFilePath == "" {
+		fmt.Fprintln(os.Stderr, "A credentials file path is required.")
+		flag.Usage()
+		os.Exit(1)
+	}
+
 	conn, err := grpc.Dial(*nbServerAddr, grpc.WithInsecure())
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "Error communicatign with nextbus server.")
@@ -70,51 +142,272 @@ func main() {
 	}
 	nbClient := pb.NewNextbusClient(conn)
 
-	srv := newServer(*port, nbClient, config.NewFileSignConfig(*configFilePath)).serve()
+	cfg, err := openSignConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening configuration: %v\n", err)
+		os.Exit(1)
+	}
+
+	s := newServer(*port, nbClient, cfg, auth.NewFileCredentialStore(*credentialsFilePath))
+	if *agencyCacheFilePath != "" {
+		if err := s.agencies.persist(*agencyCacheFilePath); err != nil {
+			log.Printf("Error loading saved agencies: %v", err)
+		}
+	}
+	if *auditLogPath != "" {
+		if err := s.audit.persist(*auditLogPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening audit log: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *assetsDir != "" {
+		if s.assets, err = loadAssets(os.DirFS(*assetsDir), true); err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading assets: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	srv, err := s.serve()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error serving: %v\n", err)
+		os.Exit(1)
+	}
+	var grpcSrv *grpc.Server
+	if *grpcPort != 0 {
+		lis, err := net.Listen("tcp", fmt.Sprintf(":%d", *grpcPort))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error serving gRPC: %v\n", err)
+			os.Exit(1)
+		}
+		grpcSrv = s.newGRPCServer()
+		go func() {
+			if err := grpcSrv.Serve(lis); err != nil {
+				log.Printf("grpc server stopped: %v", err)
+			}
+		}()
+	}
 
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, os.Interrupt)
 	<-sigs
 	srv.Shutdown(context.Background())
+	if grpcSrv != nil {
+		// Watch calls never end on their own, so waiting for them would
+		// hang.
+		grpcSrv.Stop()
+	}
+	if c, ok := cfg.(io.Closer); ok {
+		c.Close()
+	}
+	s.audit.close()
 	os.Exit(0)
 }
 
-func newServer(port int, nbClient pb.NextbusClient, cfg config.SignConfig) *server {
+// openSignConfig opens the configuration backend selected by the flags. The
+// first time the bolt backend is used, the fleet in -config_file, if any, is
+// imported into the new database.
+func openSignConfig() (config.SignConfig, error) {
+	if *configBackend == "file" {
+		return config.NewWatchedFileSignConfig(*configFilePath, configPollInterval), nil
+	}
+
+	cfg, err := config.NewBoltSignConfig(*configDBPath)
+	if err != nil {
+		return nil, err
+	}
+	if *configFilePath == "" {
+		return cfg, nil
+	}
+	signs, err := cfg.List()
+	if err != nil || len(signs) > 0 {
+		return cfg, err
+	}
+	if _, err := os.Stat(*configFilePath); os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err := config.Copy(cfg, config.NewFileSignConfig(*configFilePath)); err != nil {
+		return nil, fmt.Errorf("error importing %s: %v", *configFilePath, err)
+	}
+	log.Printf("Imported configuration from %s into %s.", *configFilePath, *configDBPath)
+	return cfg, nil
+}
+
+func newServer(port int, nbClient pb.NextbusClient, cfg config.SignConfig, users auth.CredentialStore) *server {
 	return &server{
 		port:        port,
 		cfg:         cfg,
 		nbClient:    nbClient,
-		agencyCache: &agencyCache{},
+		users:       users,
+		sessions:    auth.NewSessionManager(sessionTimeout),
+		agencies:    newAgencyCache(nbClient),
+		predictions: newPredictionCache(nbClient),
+		statuses:    newStatusStore(),
+		audit:       newAuditLog(),
+		emulator:    display.NewWeb(),
+		assets:      builtinAssets(),
 	}
 }
 
-func (s *server) serve() *http.Server {
-	srv := &http.Server{
-		Addr: fmt.Sprintf(":%d", s.port),
+// routes lists every handler served by the admin server and whether it
+// requires authentication.
+func (s *server) routes() []route {
+	return []route{
+		{"/", http.HandlerFunc(s.rootHandler), true},
+		{"/signs/", http.HandlerFunc(s.signHandler), true},
+		{"/status", http.HandlerFunc(s.statusHandler), true},
+		{"/audit", http.HandlerFunc(s.auditHandler), true},
+		{"/emulator", http.HandlerFunc(s.emulatorHandler), true},
+		{"/emulator/", http.StripPrefix("/emulator", s.emulator), true},
+		{"/login", http.HandlerFunc(s.loginHandler), false},
+		{"/logout", http.HandlerFunc(s.logoutHandler), true},
+		{"/account/password", http.HandlerFunc(s.passwordHandler), true},
+		{"/api/signs", http.HandlerFunc(s.apiSignsHandler), true},
+		{"/api/signs/", http.HandlerFunc(s.apiSignHandler), true},
+		{"/api/agencies", http.HandlerFunc(s.apiAgenciesHandler), true},
+		{"/api/predictions", http.HandlerFunc(s.apiPredictionsHandler), true},
+		{"/api/board", http.HandlerFunc(s.apiBoardHandler), true},
+		{"/api/status", http.HandlerFunc(s.apiStatusHandler), true},
+		{"/api/audit", http.HandlerFunc(s.apiAuditHandler), true},
+		{"/api/export", http.HandlerFunc(s.apiExportHandler), true},
+		{"/api/import", http.HandlerFunc(s.apiImportHandler), true},
+		// The configuration of the default sign is also served at the paths
+		// used before fleets were supported, for older drivers.
+		{"/api/config", defaultSign(s.apiConfigHandler), true},
+		{"/api/config/watch", defaultSign(s.apiConfigWatchHandler), true},
+		{"/public/", http.StripPrefix("/public/", s.assets.static()), false},
 	}
+}
 
-	http.HandleFunc("/", s.rootHandler)
-	http.HandleFunc("/api/config", s.apiConfigHandler)
-	http.Handle("/public/", http.StripPrefix("/public/", http.FileServer(http.Dir("public"))))
+// handler returns the handler for every route of this server.
+func (s *server) handler() http.Handler {
+	mux := http.NewServeMux()
+	for _, rt := range s.routes() {
+		h := rt.handler
+		if rt.requireAuth {
+			h = s.requireAuth(h)
+		}
+		mux.Handle(rt.pattern, h)
+	}
+	return mux
+}
+
+// serve starts serving on the server's port, which is listening by the time
+// serve returns.
+func (s *server) serve() (*http.Server, error) {
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", s.port))
+	if err != nil {
+		return nil, err
+	}
+	srv := &http.Server{Handler: s.handler()}
+
+	done := make(chan struct{})
+	srv.RegisterOnShutdown(func() { close(done) })
+	go s.agencies.run(done)
 
 	go func() {
-		if err := srv.ListenAndServe(); err != nil {
+		if err := srv.Serve(lis); err != http.ErrServerClosed {
 			log.Printf("Error serving: %v", err)
 		}
 	}()
 
-	return srv
+	return srv, nil
 }
 
+// rootHandler serves the fleet page, which lists every sign and lets users
+// create, rename and delete them.
 func (s *server) rootHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
 	switch r.Method {
 	case http.MethodGet:
-		c, err := s.cfg.Get()
+		signs, err := s.cfg.List()
 		if err != nil {
 			http.Error(w, fmt.Sprintf("Internal error: %v", err), http.StatusInternalServerError)
 			return
 		}
-		renderRoot(&rootTemplate{c, s.getAgencies()}, w)
+		s.renderPage("home", &fleetTemplate{signs, requestAccount(r)}, w)
+	case http.MethodPost:
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, fmt.Sprintf("Internal error: %v", err), http.StatusInternalServerError)
+			return
+		}
+		id := r.Form.Get("id")
+		name := strings.TrimSpace(r.Form.Get("name"))
+
+		var err error
+		switch action := r.Form.Get("action"); action {
+		case "create":
+			if !config.ValidSignID(id) {
+				http.Error(w, "Sign IDs may only contain lowercase letters, digits, dashes and underscores.", http.StatusBadRequest)
+				return
+			}
+			if name == "" {
+				name = id
+			}
+			err = s.configFor(r).Create(id, name)
+		case "rename":
+			if name == "" {
+				http.Error(w, "Name must be provided.", http.StatusBadRequest)
+				return
+			}
+			err = s.configFor(r).Rename(id, name)
+		case "delete":
+			err = s.configFor(r).Delete(id)
+		default:
+			http.Error(w, fmt.Sprintf("Unsupported action: %q.", action), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			configError(w, err)
+			return
+		}
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+	default:
+		http.Error(w, fmt.Sprintf("Unsupported method: %s.", r.Method), http.StatusMethodNotAllowed)
+	}
+}
+
+// signHandler serves the configuration page of the sign named in the path,
+// /signs/<id>, and the forms on it that change its override
+// (/signs/<id>/override) and schedule (/signs/<id>/schedule).
+func (s *server) signHandler(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/signs/")
+	id, resource := path, ""
+	if i := strings.Index(path, "/"); i >= 0 {
+		id, resource = path[:i], path[i+1:]
+	}
+	switch resource {
+	case "":
+	case "override":
+		s.overrideHandler(w, r, id)
+		return
+	case "schedule":
+		s.scheduleHandler(w, r, id)
+		return
+	case "quiet":
+		s.quietHandler(w, r, id)
+		return
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	sign, err := s.findSign(id)
+	if err != nil {
+		configError(w, err)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		c, rev, err := s.cfg.Get(id)
+		if err != nil {
+			configError(w, err)
+			return
+		}
+		s.renderSign(&signTemplate{sign, c, rev, s.agencies.get(), requestAccount(r)}, w)
 	case http.MethodPost:
 		if err := r.ParseForm(); err != nil {
 			http.Error(w, fmt.Sprintf("Internal error: %v", err), http.StatusInternalServerError)
@@ -125,69 +418,257 @@ func (s *server) rootHandler(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "Agency must be provided.", http.StatusBadRequest)
 			return
 		}
-		stopIdStr := r.Form.Get("stopIds")
-		stopIds := strings.Fields(stopIdStr)
+		stops, err := parseStopsForm(r)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid stops: %v.", err), http.StatusBadRequest)
+			return
+		}
 
 		c := &pb.Configuration{
-			Agency:  agency,
-			StopIds: stopIds,
+			Agency: agency,
+			Stops:  stops,
 		}
-		if err := s.cfg.Put(c); err != nil {
-			http.Error(w, fmt.Sprintf("Internal error: %v", err), http.StatusInternalServerError)
+		// The form does not include the override, profiles, schedule or
+		// quiet hours, which are changed with their own forms, so keep the
+		// ones that are stored. If the stored configuration changed since
+		// the form was loaded, Put reports a conflict. A form without a
+		// revision is checked against the configuration read here instead,
+		// so that a change made in between is not overwritten.
+		current, currentRev, err := s.cfg.Get(id)
+		if err != nil {
+			configError(w, err)
+			return
+		}
+		baseRev := r.Form.Get("revision")
+		if baseRev == "" {
+			baseRev = currentRev
+		}
+		c.Override = current.GetOverride()
+		c.Profiles = current.GetProfiles()
+		c.Schedule = current.GetSchedule()
+		c.QuietHours = current.GetQuietHours()
+		if err := schedule.Validate(c); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid configuration: %v.", err), http.StatusBadRequest)
+			return
+		}
+		rev, err := s.configFor(r).Put(id, c, baseRev)
+		if err == config.ErrConflict {
+			current, currentRev, err := s.cfg.Get(id)
+			if err != nil {
+				configError(w, err)
+				return
+			}
+			s.renderConflict(&conflictTemplate{current, &signTemplate{sign, c, currentRev, s.agencies.get(), requestAccount(r)}}, w)
 			return
 		}
-		renderRoot(&rootTemplate{c, s.getAgencies()}, w)
+		if err != nil {
+			configError(w, err)
+			return
+		}
+		s.renderSign(&signTemplate{sign, c, rev, s.agencies.get(), requestAccount(r)}, w)
 	default:
 		http.Error(w, fmt.Sprintf("Unsupported method: %s.", r.Method), http.StatusMethodNotAllowed)
 	}
 
 }
 
-func (s *server) apiConfigHandler(w http.ResponseWriter, r *http.Request) {
+// findSign returns the sign with the given ID, without its configuration.
+func (s *server) findSign(id string) (*pb.Sign, error) {
+	signs, err := s.cfg.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, sign := range signs {
+		if sign.GetId() == id {
+			return &pb.Sign{Id: sign.GetId(), Name: sign.GetName()}, nil
+		}
+	}
+	return nil, config.ErrNotFound
+}
+
+func (s *server) apiConfigHandler(w http.ResponseWriter, r *http.Request, id string) {
 	switch r.Method {
 	case http.MethodGet:
-		c, err := s.cfg.Get()
+		c, rev, err := s.cfg.Get(id)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Internal error: %v", err), http.StatusInternalServerError)
+			configError(w, err)
+			return
+		}
+		writeConfigJSON(w, c, rev)
+	case http.MethodPut:
+		c := &pb.Configuration{}
+		if err := json.NewDecoder(r.Body).Decode(c); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid configuration: %v", err), http.StatusBadRequest)
+			return
+		}
+		if c.GetAgency() == "" {
+			http.Error(w, "Agency must be provided.", http.StatusBadRequest)
+			return
+		}
+		// Validate and respond with the configuration as it is stored,
+		// upgraded to the current schema.
+		c, err := config.Migrate(c)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid configuration: %v.", err), http.StatusBadRequest)
+			return
+		}
+		if err := schedule.Validate(c); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid configuration: %v.", err), http.StatusBadRequest)
 			return
 		}
 
-		w.Header().Set("Content-Type", "application/json")
-		if err := json.NewEncoder(w).Encode(c); err != nil {
-			log.Printf("Error writing config response: %v", err)
+		rev, err := s.configFor(r).Put(id, c, parseETag(r.Header.Get("If-Match")))
+		if err == config.ErrConflict {
+			http.Error(w, "Configuration was modified since it was last read.", http.StatusPreconditionFailed)
+			return
+		}
+		if err != nil {
+			configError(w, err)
+			return
 		}
+		writeConfigJSON(w, c, rev)
 	default:
 		http.Error(w, fmt.Sprintf("Unsupported method: %s.", r.Method), http.StatusMethodNotAllowed)
 	}
 }
 
-func (s *server) getAgencies() []*pb.Agency {
-	t := timeNow()
+// apiConfigWatchHandler streams configurations to the client as Server-Sent
+// Events. The current configuration is sent first, followed by every change.
+// Each event carries the revision as its ID, so a reconnecting client that
+// sends Last-Event-ID (or a revision query parameter) is not sent a
+// configuration it already has. If the sign is deleted, the stream ends with an
+// error event.
+func (s *server) apiConfigWatchHandler(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, fmt.Sprintf("Unsupported method: %s.", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Internal error: streaming is not supported.", http.StatusInternalServerError)
+		return
+	}
 
-	if d := t.Sub(s.agencyCache.lastRefresh); d > (cacheTimeout) {
-		log.Printf("Cache expired: pulling new agency list.")
-		res, err := s.nbClient.ListAgencies(context.Background(), &pb.ListAgenciesRequest{})
-		if err != nil {
-			log.Printf("Error refreshing default agencies: %v", err)
-			return s.agencyCache.agencies
+	// Subscribe before reading the current configuration so that no change can
+	// slip in between the two.
+	updates, cancel := s.cfg.Watch(id)
+	defer cancel()
+
+	c, rev, err := s.cfg.Get(id)
+	if err != nil {
+		configError(w, err)
+		return
+	}
+
+	lastRev := r.Header.Get("Last-Event-ID")
+	if lastRev == "" {
+		lastRev = r.URL.Query().Get("revision")
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	if rev != lastRev {
+		if err := writeConfigEvent(w, c, rev); err != nil {
+			log.Printf("Error writing config event: %v", err)
+			return
+		}
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(watchKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case u, ok := <-updates:
+			if !ok {
+				// The sign was deleted.
+				fmt.Fprint(w, "event: error\ndata: No such sign.\n\n")
+				flusher.Flush()
+				return
+			}
+			if err := writeConfigEvent(w, u.Config, u.Revision); err != nil {
+				log.Printf("Error writing config event: %v", err)
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
 		}
-		s.agencyCache.agencies = res.GetAgencies()
-		s.agencyCache.lastRefresh = timeNow()
-	} else {
-		log.Printf("Cache fresh: pulling agency list from cache.")
+		flusher.Flush()
 	}
+}
 
-	return s.agencyCache.agencies
+func writeConfigEvent(w http.ResponseWriter, c *pb.Configuration, rev string) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: config\ndata: %s\n\n", rev, data)
+	return err
 }
 
-func renderRoot(t *rootTemplate, w http.ResponseWriter) {
+func writeConfigJSON(w http.ResponseWriter, c *pb.Configuration, rev string) {
+	w.Header().Set("ETag", strconv.Quote(rev))
+	writeJSON(w, c)
+}
+
+// parseETag returns the revision named by an If-Match header value. A missing
+// header or a wildcard matches any revision, so the empty string is returned.
+func parseETag(h string) string {
+	h = strings.TrimPrefix(strings.TrimSpace(h), "W/")
+	if h == "*" {
+		return ""
+	}
+	if rev, err := strconv.Unquote(h); err == nil {
+		return rev
+	}
+	return h
+}
+
+// configError writes the HTTP error that corresponds to an error returned by
+// config.SignConfig.
+func configError(w http.ResponseWriter, err error) {
+	switch err {
+	case config.ErrNotFound:
+		http.Error(w, "No such sign.", http.StatusNotFound)
+	case config.ErrExists:
+		http.Error(w, "A sign with that ID already exists.", http.StatusConflict)
+	case config.ErrConflict:
+		http.Error(w, "Configuration was modified by someone else.", http.StatusConflict)
+	default:
+		http.Error(w, fmt.Sprintf("Internal error: %v", err), http.StatusInternalServerError)
+	}
+}
+
+func (s *server) renderSign(t *signTemplate, w http.ResponseWriter) {
 	// Make sure that the configuration is not nil so that the server can return
 	// an error before rendering the template.
 	if t.Cfg == nil {
 		http.Error(w, fmt.Sprintf("Internal error: configuration is nil."), http.StatusInternalServerError)
 		return
 	}
-	if err := templates.ExecuteTemplate(w, "index.html", t); err != nil {
+	s.renderPage("sign", t, w)
+}
+
+func (s *server) renderConflict(t *conflictTemplate, w http.ResponseWriter) {
+	if t.Current == nil || t.Form.Cfg == nil {
+		http.Error(w, fmt.Sprintf("Internal error: configuration is nil."), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusConflict)
+	s.renderPage("conflict", t, w)
+}
+
+func (s *server) renderPage(name string, data interface{}, w http.ResponseWriter) {
+	t, err := s.assets.page(name)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Internal error: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if err := t.ExecuteTemplate(w, "index.html", data); err != nil {
 		log.Printf("Problem rendering HTML template: %v", err)
 		return
 	}
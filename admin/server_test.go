@@ -1,52 +1,228 @@
 package main
 
 import (
+	"archive/tar"
+	"bufio"
 	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync/atomic"
 	"testing"
-	"time"
 
 	"github.com/golang/protobuf/proto"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 
+	"github.com/wallaceicy06/muni-sign/admin/auth"
+	"github.com/wallaceicy06/muni-sign/admin/config"
 	pb "github.com/wallaceicy06/muni-sign/proto"
 	grpcContext "golang.org/x/net/context"
 )
 
 type fakeConfig struct {
-	cfg    *pb.Configuration
-	getErr error
-	putErr error
+	signs    []*pb.Sign
+	revs     map[string]string
+	getErr   error
+	putErr   error
+	watchers map[string][]chan config.Update
 }
 
-func (fc *fakeConfig) Get() (*pb.Configuration, error) {
+// newFakeConfig returns a fakeConfig holding only the default sign.
+func newFakeConfig(cfg *pb.Configuration, rev string) *fakeConfig {
+	return &fakeConfig{
+		signs: defaultFleet(cfg),
+		revs:  map[string]string{config.DefaultSignID: rev},
+	}
+}
+
+func defaultFleet(cfg *pb.Configuration) []*pb.Sign {
+	return []*pb.Sign{{Id: config.DefaultSignID, Name: "Default", Configuration: cfg}}
+}
+
+func (fc *fakeConfig) find(id string) int {
+	for i, s := range fc.signs {
+		if s.GetId() == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// config returns the configuration of a sign, or nil if there is no such sign.
+func (fc *fakeConfig) config(id string) *pb.Configuration {
+	if i := fc.find(id); i >= 0 {
+		return fc.signs[i].GetConfiguration()
+	}
+	return nil
+}
+
+func (fc *fakeConfig) List() ([]*pb.Sign, error) {
 	if fc.getErr != nil {
 		return nil, fc.getErr
 	}
-	return fc.cfg, nil
+	return fc.signs, nil
+}
+
+func (fc *fakeConfig) Create(id, name string) error {
+	if fc.putErr != nil {
+		return fc.putErr
+	}
+	if fc.find(id) >= 0 {
+		return config.ErrExists
+	}
+	fc.signs = append(fc.signs, &pb.Sign{Id: id, Name: name, Configuration: &pb.Configuration{}})
+	return nil
+}
+
+func (fc *fakeConfig) Rename(id, name string) error {
+	if fc.putErr != nil {
+		return fc.putErr
+	}
+	i := fc.find(id)
+	if i < 0 {
+		return config.ErrNotFound
+	}
+	fc.signs[i].Name = name
+	return nil
 }
 
-func (fc *fakeConfig) Put(cfg *pb.Configuration) error {
+func (fc *fakeConfig) Delete(id string) error {
 	if fc.putErr != nil {
 		return fc.putErr
 	}
-	fc.cfg = cfg
+	i := fc.find(id)
+	if i < 0 {
+		return config.ErrNotFound
+	}
+	fc.signs = append(fc.signs[:i], fc.signs[i+1:]...)
+	for _, w := range fc.watchers[id] {
+		close(w)
+	}
+	delete(fc.watchers, id)
+	return nil
+}
+
+func (fc *fakeConfig) Get(id string) (*pb.Configuration, string, error) {
+	if fc.getErr != nil {
+		return nil, "", fc.getErr
+	}
+	i := fc.find(id)
+	if i < 0 {
+		return nil, "", config.ErrNotFound
+	}
+	return fc.signs[i].GetConfiguration(), fc.revs[id], nil
+}
+
+func (fc *fakeConfig) Put(id string, cfg *pb.Configuration, rev string) (string, error) {
+	if fc.putErr != nil {
+		return "", fc.putErr
+	}
+	i := fc.find(id)
+	if i < 0 {
+		return "", config.ErrNotFound
+	}
+	if rev != "" && rev != fc.revs[id] {
+		return "", config.ErrConflict
+	}
+	if fc.revs == nil {
+		fc.revs = make(map[string]string)
+	}
+	fc.signs[i].Configuration = cfg
+	fc.revs[id] = config.Revision(cfg)
+	for _, w := range fc.watchers[id] {
+		w <- config.Update{Config: cfg, Revision: fc.revs[id]}
+	}
+	return fc.revs[id], nil
+}
+
+func (fc *fakeConfig) Revisions(id string) ([]*pb.ConfigurationRevision, error) {
+	cfg, rev, err := fc.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	return []*pb.ConfigurationRevision{{Revision: rev, Configuration: cfg}}, nil
+}
+
+func (fc *fakeConfig) Watch(id string) (<-chan config.Update, func()) {
+	ch := make(chan config.Update, 10)
+	if fc.watchers == nil {
+		fc.watchers = make(map[string][]chan config.Update)
+	}
+	fc.watchers[id] = append(fc.watchers[id], ch)
+	return ch, func() {}
+}
+
+type fakeUsers struct {
+	passwords map[string]string
+	tokens    map[string]string
+	// What Export returns, and the data passed to the last Import.
+	exported []byte
+	imported []byte
+}
+
+func (fu *fakeUsers) Authenticate(user, password string) error {
+	if p, ok := fu.passwords[user]; !ok || p != password {
+		return auth.ErrInvalidCredentials
+	}
+	return nil
+}
+
+func (fu *fakeUsers) AuthenticateToken(token string) (string, error) {
+	user, ok := fu.tokens[token]
+	if !ok {
+		return "", auth.ErrInvalidCredentials
+	}
+	return user, nil
+}
+
+func (fu *fakeUsers) SetPassword(user, password string) error {
+	fu.passwords[user] = password
+	return nil
+}
+
+func (fu *fakeUsers) NewToken(user string) (string, error) {
+	return "", errors.New("fake NewToken is unimplemented")
+}
+
+func (fu *fakeUsers) Export() ([]byte, error) {
+	return fu.exported, nil
+}
+
+func (fu *fakeUsers) Import(data []byte) error {
+	fu.imported = data
 	return nil
 }
 
 type fakeNbClient struct {
 	agenciesRes *pb.ListAgenciesResponse
 	agenciesErr error
+	// The number of calls to ListAgencies, accessed atomically.
+	agenciesCalls int32
+	// If set, ListAgencies waits for it to be closed.
+	agenciesBlock chan struct{}
+	// The predictions listed for each stop ID. ListPredictions is
+	// unimplemented if there are none and there is no error.
+	predictionsRes map[string]*pb.ListPredictionsResponse
+	predictionsErr error
+	// The number of calls to ListPredictions, accessed atomically.
+	predictionsCalls int32
 }
 
 func (fnb *fakeNbClient) ListAgencies(ctx grpcContext.Context, req *pb.ListAgenciesRequest, _ ...grpc.CallOption) (*pb.ListAgenciesResponse, error) {
+	atomic.AddInt32(&fnb.agenciesCalls, 1)
+	if fnb.agenciesBlock != nil {
+		<-fnb.agenciesBlock
+	}
 	if fnb.agenciesErr != nil {
 		return nil, fnb.agenciesErr
 	}
@@ -54,14 +230,29 @@ func (fnb *fakeNbClient) ListAgencies(ctx grpcContext.Context, req *pb.ListAgenc
 }
 
 func (fnb *fakeNbClient) ListPredictions(ctx grpcContext.Context, req *pb.ListPredictionsRequest, _ ...grpc.CallOption) (*pb.ListPredictionsResponse, error) {
-	return nil, grpc.Errorf(codes.Unimplemented, "Fake ListPredictions is unimplemented.")
+	atomic.AddInt32(&fnb.predictionsCalls, 1)
+	if fnb.predictionsErr != nil {
+		return nil, fnb.predictionsErr
+	}
+	if fnb.predictionsRes == nil {
+		return nil, grpc.Errorf(codes.Unimplemented, "Fake ListPredictions is unimplemented.")
+	}
+	if res, ok := fnb.predictionsRes[req.GetStopId()]; ok {
+		return res, nil
+	}
+	return &pb.ListPredictionsResponse{}, nil
 }
 
 const testPort = 25565
 
 var testConfig = &pb.Configuration{
-	Agency:  "sf-muni",
-	StopIds: []string{"1234", "5678"},
+	Agency: "sf-muni",
+	Stops:  []*pb.Stop{{Id: "1234"}, {Id: "5678"}},
+}
+
+var testUsers = &fakeUsers{
+	passwords: map[string]string{"sean": "hunter2"},
+	tokens:    map[string]string{"driver-token": "sean"},
 }
 
 var goodFakeNb = &fakeNbClient{
@@ -70,16 +261,23 @@ var goodFakeNb = &fakeNbClient{
 	}}
 
 func TestServing(t *testing.T) {
-	srv := newServer(testPort, goodFakeNb, &fakeConfig{cfg: testConfig}).serve()
-	defer srv.Shutdown(context.Background())
+	// Each server has its own routes, so several can run in one process.
+	for _, port := range []int{testPort, testPort + 1} {
+		srv, err := newServer(port, goodFakeNb, newFakeConfig(testConfig, ""), testUsers).serve()
+		if err != nil {
+			t.Fatalf("problem starting server: %v", err)
+		}
+		defer srv.Shutdown(context.Background())
 
-	res, err := http.Get(fmt.Sprintf("http://localhost:%d", testPort))
-	if err != nil {
-		t.Fatalf("problem starting server: %v", err)
-	}
+		res, err := http.Get(fmt.Sprintf("http://localhost:%d", port))
+		if err != nil {
+			t.Fatalf("problem reaching server: %v", err)
+		}
+		res.Body.Close()
 
-	if res.StatusCode != http.StatusOK {
-		t.Errorf("expected OK response from server, got %d want %d", res.StatusCode, http.StatusOK)
+		if res.StatusCode != http.StatusOK {
+			t.Errorf("expected OK response from server, got %d want %d", res.StatusCode, http.StatusOK)
+		}
 	}
 }
 
@@ -92,30 +290,30 @@ func TestGetConfig(t *testing.T) {
 	}{
 		{
 			name:     "Good",
-			cfg:      &fakeConfig{cfg: testConfig},
-			req:      httptest.NewRequest(http.MethodGet, "/", &bytes.Buffer{}),
+			cfg:      newFakeConfig(testConfig, ""),
+			req:      httptest.NewRequest(http.MethodGet, "/signs/default", &bytes.Buffer{}),
 			wantCode: http.StatusOK,
 		},
 		{
 			name:     "ConfigError",
-			cfg:      &fakeConfig{cfg: nil, getErr: errors.New("fake config get error")},
-			req:      httptest.NewRequest(http.MethodGet, "/", &bytes.Buffer{}),
+			cfg:      &fakeConfig{getErr: errors.New("fake config get error")},
+			req:      httptest.NewRequest(http.MethodGet, "/signs/default", &bytes.Buffer{}),
 			wantCode: http.StatusInternalServerError,
 		},
 		{
 			name:     "ConfigNil",
-			cfg:      &fakeConfig{cfg: nil},
-			req:      httptest.NewRequest(http.MethodGet, "/", &bytes.Buffer{}),
+			cfg:      newFakeConfig(nil, ""),
+			req:      httptest.NewRequest(http.MethodGet, "/signs/default", &bytes.Buffer{}),
 			wantCode: http.StatusInternalServerError,
 		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			srv := newServer(testPort, goodFakeNb, test.cfg)
+			srv := newServer(testPort, goodFakeNb, test.cfg, testUsers)
 			rec := httptest.NewRecorder()
 
-			srv.rootHandler(rec, test.req)
+			srv.signHandler(rec, test.req)
 			res := rec.Result()
 
 			if res.StatusCode != test.wantCode {
@@ -127,95 +325,177 @@ func TestGetConfig(t *testing.T) {
 
 func TestUpdateConfig(t *testing.T) {
 	tests := []struct {
-		name       string
-		cfg        *fakeConfig
-		formAgency string
-		formStopID string
-		wantCode   int
-		wantCfg    *pb.Configuration
+		name     string
+		cfg      *fakeConfig
+		form     url.Values
+		wantCode int
+		wantCfg  *pb.Configuration
 	}{
 		{
-			name:       "OneStop",
-			cfg:        &fakeConfig{cfg: testConfig},
-			formAgency: "sf-muni",
-			formStopID: "5678",
-			wantCode:   http.StatusOK,
+			name:     "OneStop",
+			cfg:      newFakeConfig(testConfig, ""),
+			form:     url.Values{"agency": {"sf-muni"}, "stop_id": {"5678"}},
+			wantCode: http.StatusOK,
 			wantCfg: &pb.Configuration{
-				Agency:  "sf-muni",
-				StopIds: []string{"5678"},
+				Agency: "sf-muni",
+				Stops:  []*pb.Stop{{Id: "5678"}},
 			},
 		},
 		{
-			name:       "MultipleStops",
-			cfg:        &fakeConfig{cfg: testConfig},
-			formAgency: "sf-muni",
-			formStopID: "1234 5678 9012",
-			wantCode:   http.StatusOK,
+			name:     "MultipleStops",
+			cfg:      newFakeConfig(testConfig, ""),
+			form:     url.Values{"agency": {"sf-muni"}, "stop_id": {"1234", "5678", "9012"}},
+			wantCode: http.StatusOK,
 			wantCfg: &pb.Configuration{
-				Agency:  "sf-muni",
-				StopIds: []string{"1234", "5678", "9012"},
+				Agency: "sf-muni",
+				Stops:  []*pb.Stop{{Id: "1234"}, {Id: "5678"}, {Id: "9012"}},
 			},
 		},
 		{
-			name:       "MultipleStopsExtraSpaces",
-			cfg:        &fakeConfig{cfg: testConfig},
-			formAgency: "sf-muni",
-			formStopID: "      1234  5678        9012  ",
-			wantCode:   http.StatusOK,
+			name: "StopSettings",
+			cfg:  newFakeConfig(testConfig, ""),
+			form: url.Values{
+				"agency":        {"sf-muni"},
+				"stop_order":    {"1", "2", "3"},
+				"stop_id":       {" 1234 ", "5678", ""},
+				"stop_nickname": {"Home→Work", "", ""},
+				"stop_colored":  {"0"},
+				"stop_color":    {"#ff0000", "#ffffff", "#ffffff"},
+				"stop_routes":   {"N  J", "", ""},
+				"stop_walk":     {"4", "", ""},
+			},
+			wantCode: http.StatusOK,
 			wantCfg: &pb.Configuration{
-				Agency:  "sf-muni",
-				StopIds: []string{"1234", "5678", "9012"},
+				Agency: "sf-muni",
+				Stops: []*pb.Stop{
+					{Id: "1234", Nickname: "Home→Work", Color: &pb.Color{Red: 1.0}, Routes: []string{"N", "J"}, WalkingMinutes: 4},
+					{Id: "5678"},
+				},
 			},
 		},
 		{
-			name:       "MissingAgency",
-			cfg:        &fakeConfig{cfg: testConfig},
-			formAgency: "",
-			formStopID: "5678",
-			wantCode:   http.StatusBadRequest,
-			wantCfg:    testConfig,
+			name: "Reordered",
+			cfg:  newFakeConfig(testConfig, ""),
+			form: url.Values{
+				"agency":     {"sf-muni"},
+				"stop_order": {"3", "1", "2"},
+				"stop_id":    {"1234", "5678", "9012"},
+			},
+			wantCode: http.StatusOK,
+			wantCfg: &pb.Configuration{
+				Agency: "sf-muni",
+				Stops:  []*pb.Stop{{Id: "5678"}, {Id: "9012"}, {Id: "1234"}},
+			},
 		},
 		{
-			name:       "EmptyStopIds",
-			cfg:        &fakeConfig{cfg: testConfig},
-			formAgency: "sf-muni",
-			formStopID: "",
-			wantCode:   http.StatusOK,
-			wantCfg:    &pb.Configuration{Agency: "sf-muni"},
+			name:     "MissingAgency",
+			cfg:      newFakeConfig(testConfig, ""),
+			form:     url.Values{"stop_id": {"5678"}},
+			wantCode: http.StatusBadRequest,
+			wantCfg:  testConfig,
+		},
+		{
+			name:     "EmptyStopIds",
+			cfg:      newFakeConfig(testConfig, ""),
+			form:     url.Values{"agency": {"sf-muni"}, "stop_id": {""}},
+			wantCode: http.StatusOK,
+			wantCfg:  &pb.Configuration{Agency: "sf-muni"},
 		},
 		{
-			name:       "ConfigPutError",
-			cfg:        &fakeConfig{cfg: testConfig, putErr: errors.New("fake config put error")},
-			formAgency: "sf-muni",
-			formStopID: "5678",
-			wantCode:   http.StatusInternalServerError,
-			wantCfg:    testConfig,
+			name:     "DuplicateStop",
+			cfg:      newFakeConfig(testConfig, ""),
+			form:     url.Values{"agency": {"sf-muni"}, "stop_id": {"5678", "5678"}},
+			wantCode: http.StatusBadRequest,
+			wantCfg:  testConfig,
+		},
+		{
+			name:     "InvalidWalkingTime",
+			cfg:      newFakeConfig(testConfig, ""),
+			form:     url.Values{"agency": {"sf-muni"}, "stop_id": {"5678"}, "stop_walk": {"soon"}},
+			wantCode: http.StatusBadRequest,
+			wantCfg:  testConfig,
+		},
+		{
+			name:     "ConfigPutError",
+			cfg:      &fakeConfig{signs: defaultFleet(testConfig), putErr: errors.New("fake config put error")},
+			form:     url.Values{"agency": {"sf-muni"}, "stop_id": {"5678"}},
+			wantCode: http.StatusInternalServerError,
+			wantCfg:  testConfig,
 		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			srv := newServer(testPort, goodFakeNb, test.cfg)
+			srv := newServer(testPort, goodFakeNb, test.cfg, testUsers)
 			rec := httptest.NewRecorder()
 
-			req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(fmt.Sprintf("agency=%s&stopIds=%s", test.formAgency, test.formStopID)))
+			req := httptest.NewRequest(http.MethodPost, "/signs/default", strings.NewReader(test.form.Encode()))
 			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
-			srv.rootHandler(rec, req)
+			srv.signHandler(rec, req)
+			res := rec.Result()
+
+			if res.StatusCode != test.wantCode {
+				t.Errorf("server response code unexpected, got %d want %d", res.StatusCode, test.wantCode)
+			}
+			if !proto.Equal(test.cfg.config("default"), test.wantCfg) {
+				t.Errorf("configurations differ: got %v, want %v", test.cfg.config("default"), test.wantCfg)
+			}
+		})
+	}
+}
+
+func TestUpdateConfigRevision(t *testing.T) {
+	tests := []struct {
+		name     string
+		formRev  string
+		wantCode int
+		wantCfg  *pb.Configuration
+	}{
+		{
+			name:     "NoRevision",
+			formRev:  "",
+			wantCode: http.StatusOK,
+			wantCfg:  &pb.Configuration{Agency: "sf-muni", Stops: []*pb.Stop{{Id: "9012"}}},
+		},
+		{
+			name:     "CurrentRevision",
+			formRev:  "rev1",
+			wantCode: http.StatusOK,
+			wantCfg:  &pb.Configuration{Agency: "sf-muni", Stops: []*pb.Stop{{Id: "9012"}}},
+		},
+		{
+			name:     "StaleRevision",
+			formRev:  "rev0",
+			wantCode: http.StatusConflict,
+			wantCfg:  testConfig,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := newFakeConfig(testConfig, "rev1")
+			srv := newServer(testPort, goodFakeNb, cfg, testUsers)
+			rec := httptest.NewRecorder()
+
+			req := httptest.NewRequest(http.MethodPost, "/signs/default", bytes.NewBufferString(fmt.Sprintf("agency=sf-muni&stop_id=9012&revision=%s", test.formRev)))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+			srv.signHandler(rec, req)
 			res := rec.Result()
 
 			if res.StatusCode != test.wantCode {
 				t.Errorf("server response code unexpected, got %d want %d", res.StatusCode, test.wantCode)
 			}
-			if !proto.Equal(test.cfg.cfg, test.wantCfg) {
-				t.Errorf("configurations differ: got %v, want %v", test.cfg.cfg, test.wantCfg)
+			if !proto.Equal(cfg.config("default"), test.wantCfg) {
+				t.Errorf("configurations differ: got %v, want %v", cfg.config("default"), test.wantCfg)
 			}
 		})
 	}
 }
 
 func TestRootInvalidMethod(t *testing.T) {
-	srv := newServer(testPort, goodFakeNb, &fakeConfig{})
+	srv := newServer(testPort, goodFakeNb, newFakeConfig(testConfig, ""), testUsers)
 	rec := httptest.NewRecorder()
 
 	req := httptest.NewRequest(http.MethodDelete, "/", nil)
@@ -227,6 +507,19 @@ func TestRootInvalidMethod(t *testing.T) {
 	}
 }
 
+func TestSignInvalidMethod(t *testing.T) {
+	srv := newServer(testPort, goodFakeNb, newFakeConfig(testConfig, ""), testUsers)
+	rec := httptest.NewRecorder()
+
+	req := httptest.NewRequest(http.MethodDelete, "/signs/default", nil)
+	srv.signHandler(rec, req)
+	res := rec.Result()
+
+	if res.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("StatusCode = %d, want %d", res.StatusCode, http.StatusMethodNotAllowed)
+	}
+}
+
 func TestApiConfigGet(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -235,7 +528,7 @@ func TestApiConfigGet(t *testing.T) {
 	}{
 		{
 			name:    "Good",
-			fakeCfg: &fakeConfig{cfg: testConfig},
+			fakeCfg: newFakeConfig(testConfig, "rev1"),
 			wantErr: false,
 		},
 		{
@@ -247,11 +540,11 @@ func TestApiConfigGet(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			srv := newServer(testPort, goodFakeNb, test.fakeCfg)
+			srv := newServer(testPort, goodFakeNb, test.fakeCfg, testUsers)
 			rec := httptest.NewRecorder()
 
-			req := httptest.NewRequest(http.MethodGet, "/api/config", nil)
-			srv.apiConfigHandler(rec, req)
+			req := httptest.NewRequest(http.MethodGet, "/api/signs/default/config", nil)
+			srv.apiSignHandler(rec, req)
 			res := rec.Result()
 
 			if test.wantErr {
@@ -265,6 +558,10 @@ func TestApiConfigGet(t *testing.T) {
 				t.Errorf("get API config got code %d want %d", res.StatusCode, http.StatusOK)
 			}
 
+			if got, want := res.Header.Get("ETag"), `"`+test.fakeCfg.revs["default"]+`"`; got != want {
+				t.Errorf("get API config got ETag %s want %s", got, want)
+			}
+
 			got := &pb.Configuration{}
 			body, err := ioutil.ReadAll(res.Body)
 			if err != nil {
@@ -274,87 +571,993 @@ func TestApiConfigGet(t *testing.T) {
 				t.Fatalf("error unmarshaling JSON response: %v", err)
 			}
 
-			if !proto.Equal(got, test.fakeCfg.cfg) {
-				t.Errorf("configuration does not match: got %v want %v", got, test.fakeCfg.cfg)
+			if !proto.Equal(got, test.fakeCfg.config("default")) {
+				t.Errorf("configuration does not match: got %v want %v", got, test.fakeCfg.config("default"))
+			}
+		})
+	}
+}
+
+func TestApiConfigPut(t *testing.T) {
+	// The configuration is stored, and returned, as upgraded to the current
+	// schema.
+	newConfig := &pb.Configuration{SchemaVersion: config.CurrentSchemaVersion, Agency: "sf-muni", Stops: []*pb.Stop{{Id: "9012"}}}
+
+	tests := []struct {
+		name     string
+		body     string
+		ifMatch  string
+		wantCode int
+		wantCfg  *pb.Configuration
+	}{
+		{
+			name:     "NoIfMatch",
+			body:     `{"agency": "sf-muni", "stops": [{"id": "9012"}]}`,
+			wantCode: http.StatusOK,
+			wantCfg:  newConfig,
+		},
+		{
+			name:     "MatchingIfMatch",
+			body:     `{"agency": "sf-muni", "stops": [{"id": "9012"}]}`,
+			ifMatch:  `"rev1"`,
+			wantCode: http.StatusOK,
+			wantCfg:  newConfig,
+		},
+		{
+			name:     "WildcardIfMatch",
+			body:     `{"agency": "sf-muni", "stops": [{"id": "9012"}]}`,
+			ifMatch:  "*",
+			wantCode: http.StatusOK,
+			wantCfg:  newConfig,
+		},
+		{
+			name:     "OldSchema",
+			body:     `{"agency": "sf-muni", "stop_ids": ["9012"]}`,
+			wantCode: http.StatusOK,
+			wantCfg:  newConfig,
+		},
+		{
+			name:     "UnsupportedSchemaVersion",
+			body:     `{"schema_version": 99, "agency": "sf-muni"}`,
+			wantCode: http.StatusBadRequest,
+			wantCfg:  testConfig,
+		},
+		{
+			name:     "StaleIfMatch",
+			body:     `{"agency": "sf-muni", "stops": [{"id": "9012"}]}`,
+			ifMatch:  `"rev0"`,
+			wantCode: http.StatusPreconditionFailed,
+			wantCfg:  testConfig,
+		},
+		{
+			name:     "MissingAgency",
+			body:     `{"stops": [{"id": "9012"}]}`,
+			wantCode: http.StatusBadRequest,
+			wantCfg:  testConfig,
+		},
+		{
+			name:     "InvalidJSON",
+			body:     `{"agency":`,
+			wantCode: http.StatusBadRequest,
+			wantCfg:  testConfig,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := newFakeConfig(testConfig, "rev1")
+			srv := newServer(testPort, goodFakeNb, cfg, testUsers)
+			rec := httptest.NewRecorder()
+
+			req := httptest.NewRequest(http.MethodPut, "/api/signs/default/config", bytes.NewBufferString(test.body))
+			if test.ifMatch != "" {
+				req.Header.Set("If-Match", test.ifMatch)
+			}
+			srv.apiSignHandler(rec, req)
+			res := rec.Result()
+
+			if res.StatusCode != test.wantCode {
+				t.Errorf("put API config got code %d want %d", res.StatusCode, test.wantCode)
+			}
+			if !proto.Equal(cfg.config("default"), test.wantCfg) {
+				t.Errorf("configurations differ: got %v, want %v", cfg.config("default"), test.wantCfg)
+			}
+			if res.StatusCode == http.StatusOK {
+				if got, want := res.Header.Get("ETag"), `"`+cfg.revs["default"]+`"`; got != want {
+					t.Errorf("put API config got ETag %s want %s", got, want)
+				}
+				got := &pb.Configuration{}
+				if err := json.NewDecoder(res.Body).Decode(got); err != nil {
+					t.Fatalf("error unmarshaling JSON response: %v", err)
+				}
+				if !proto.Equal(got, test.wantCfg) {
+					t.Errorf("put API config returned %v want %v", got, test.wantCfg)
+				}
+			}
+		})
+	}
+}
+
+func TestApiConfigWatch(t *testing.T) {
+	newConfig := &pb.Configuration{Agency: "sf-muni", Stops: []*pb.Stop{{Id: "9012"}}}
+
+	tests := []struct {
+		name     string
+		lastRev  string
+		wantCfgs []*pb.Configuration
+	}{
+		{
+			name:     "FromScratch",
+			wantCfgs: []*pb.Configuration{testConfig, newConfig},
+		},
+		{
+			name:     "ResumeFromCurrent",
+			lastRev:  "rev1",
+			wantCfgs: []*pb.Configuration{newConfig},
+		},
+		{
+			name:     "ResumeFromStale",
+			lastRev:  "rev0",
+			wantCfgs: []*pb.Configuration{testConfig, newConfig},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := newFakeConfig(testConfig, "rev1")
+			srv := newServer(testPort, goodFakeNb, cfg, testUsers)
+			ts := httptest.NewServer(http.HandlerFunc(srv.apiSignHandler))
+			defer ts.Close()
+
+			req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/signs/default/config/watch", nil)
+			if err != nil {
+				t.Fatalf("error creating request: %v", err)
+			}
+			if test.lastRev != "" {
+				req.Header.Set("Last-Event-ID", test.lastRev)
+			}
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("error watching config: %v", err)
+			}
+			defer res.Body.Close()
+
+			if got, want := res.Header.Get("Content-Type"), "text/event-stream"; got != want {
+				t.Errorf("watch API config got Content-Type %s want %s", got, want)
+			}
+
+			if _, err := cfg.Put("default", newConfig, ""); err != nil {
+				t.Fatalf("error updating config: %v", err)
+			}
+
+			scanner := bufio.NewScanner(res.Body)
+			for _, want := range test.wantCfgs {
+				got := &pb.Configuration{}
+				for scanner.Scan() {
+					if line := scanner.Text(); strings.HasPrefix(line, "data: ") {
+						if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), got); err != nil {
+							t.Fatalf("error unmarshaling event data: %v", err)
+						}
+						break
+					}
+				}
+				if !proto.Equal(got, want) {
+					t.Errorf("configuration event does not match: got %v want %v", got, want)
+				}
 			}
 		})
 	}
 }
 
+func TestApiConfigWatchDeletedSign(t *testing.T) {
+	cfg := newFakeConfig(testConfig, "rev1")
+	srv := newServer(testPort, goodFakeNb, cfg, testUsers)
+	ts := httptest.NewServer(http.HandlerFunc(srv.apiSignHandler))
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + "/api/signs/default/config/watch?revision=rev1")
+	if err != nil {
+		t.Fatalf("error watching config: %v", err)
+	}
+	defer res.Body.Close()
+
+	if err := cfg.Delete("default"); err != nil {
+		t.Fatalf("error deleting sign: %v", err)
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("error reading stream: %v", err)
+	}
+	if want := "event: error\ndata: No such sign.\n\n"; !strings.HasSuffix(string(body), want) {
+		t.Errorf("stream after deleting sign = %q want suffix %q", body, want)
+	}
+}
+
+func TestApiConfigDefaultSign(t *testing.T) {
+	srv := newServer(testPort, goodFakeNb, newFakeConfig(testConfig, "rev1"), testUsers)
+	rec := httptest.NewRecorder()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/config", nil)
+	defaultSign(srv.apiConfigHandler)(rec, req)
+
+	got := &pb.Configuration{}
+	if err := json.NewDecoder(rec.Body).Decode(got); err != nil {
+		t.Fatalf("error unmarshaling JSON response: %v", err)
+	}
+	if !proto.Equal(got, testConfig) {
+		t.Errorf("configuration does not match: got %v want %v", got, testConfig)
+	}
+}
+
+func TestApiConfigUnknownSign(t *testing.T) {
+	srv := newServer(testPort, goodFakeNb, newFakeConfig(testConfig, "rev1"), testUsers)
+
+	for _, method := range []string{http.MethodGet, http.MethodPut} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(method, "/api/signs/lobby/config", bytes.NewBufferString(`{"agency": "sf-muni"}`))
+		srv.apiSignHandler(rec, req)
+
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%s unknown sign config got code %d want %d", method, rec.Code, http.StatusNotFound)
+		}
+	}
+}
+
 func TestApiConfigInvalidMethod(t *testing.T) {
-	srv := newServer(testPort, goodFakeNb, &fakeConfig{})
+	srv := newServer(testPort, goodFakeNb, &fakeConfig{}, testUsers)
 	rec := &httptest.ResponseRecorder{}
 
-	req := httptest.NewRequest(http.MethodPost, "/api/config", nil)
-	srv.apiConfigHandler(rec, req)
+	req := httptest.NewRequest(http.MethodPost, "/api/signs/default/config", nil)
+	srv.apiSignHandler(rec, req)
 	if rec.Code != http.StatusMethodNotAllowed {
 		t.Errorf("rec.Code = %d, want %d", rec.Code, http.StatusMethodNotAllowed)
 	}
 }
 
-func TestAgencyListCache(t *testing.T) {
-	lastRefresh := time.Now()
+func TestManageFleet(t *testing.T) {
+	tests := []struct {
+		name      string
+		form      string
+		wantCode  int
+		wantSigns []*pb.Sign
+	}{
+		{
+			name:     "Create",
+			form:     "action=create&id=lobby&name=Front+Lobby",
+			wantCode: http.StatusSeeOther,
+			wantSigns: []*pb.Sign{
+				{Id: "default", Name: "Default", Configuration: testConfig},
+				{Id: "lobby", Name: "Front Lobby", Configuration: &pb.Configuration{}},
+			},
+		},
+		{
+			name:     "CreateWithoutName",
+			form:     "action=create&id=lobby",
+			wantCode: http.StatusSeeOther,
+			wantSigns: []*pb.Sign{
+				{Id: "default", Name: "Default", Configuration: testConfig},
+				{Id: "lobby", Name: "lobby", Configuration: &pb.Configuration{}},
+			},
+		},
+		{
+			name:      "CreateInvalidID",
+			form:      "action=create&id=Front+Lobby",
+			wantCode:  http.StatusBadRequest,
+			wantSigns: defaultFleet(testConfig),
+		},
+		{
+			name:      "CreateDuplicate",
+			form:      "action=create&id=default",
+			wantCode:  http.StatusConflict,
+			wantSigns: defaultFleet(testConfig),
+		},
+		{
+			name:     "Rename",
+			form:     "action=rename&id=default&name=Kitchen",
+			wantCode: http.StatusSeeOther,
+			wantSigns: []*pb.Sign{
+				{Id: "default", Name: "Kitchen", Configuration: testConfig},
+			},
+		},
+		{
+			name:      "RenameEmpty",
+			form:      "action=rename&id=default&name=+",
+			wantCode:  http.StatusBadRequest,
+			wantSigns: defaultFleet(testConfig),
+		},
+		{
+			name:      "RenameUnknown",
+			form:      "action=rename&id=lobby&name=Lobby",
+			wantCode:  http.StatusNotFound,
+			wantSigns: defaultFleet(testConfig),
+		},
+		{
+			name:      "Delete",
+			form:      "action=delete&id=default",
+			wantCode:  http.StatusSeeOther,
+			wantSigns: []*pb.Sign{},
+		},
+		{
+			name:      "UnknownAction",
+			form:      "action=explode&id=default",
+			wantCode:  http.StatusBadRequest,
+			wantSigns: defaultFleet(testConfig),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := newFakeConfig(testConfig, "")
+			srv := newServer(testPort, goodFakeNb, cfg, testUsers)
+			rec := httptest.NewRecorder()
+
+			req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(test.form))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			srv.rootHandler(rec, req)
+
+			if rec.Code != test.wantCode {
+				t.Errorf("server response code unexpected, got %d want %d", rec.Code, test.wantCode)
+			}
+			if len(cfg.signs) != len(test.wantSigns) {
+				t.Fatalf("signs differ: got %v want %v", cfg.signs, test.wantSigns)
+			}
+			for i := range test.wantSigns {
+				if !proto.Equal(cfg.signs[i], test.wantSigns[i]) {
+					t.Errorf("signs differ: got %v want %v", cfg.signs[i], test.wantSigns[i])
+				}
+			}
+		})
+	}
+}
+
+func TestApiSigns(t *testing.T) {
+	cfg := newFakeConfig(testConfig, "")
+	srv := newServer(testPort, goodFakeNb, cfg, testUsers)
 
-	cachedAgencies := []*pb.Agency{{
-		Name: "Los Angeles Metro",
-		Tag:  "la-metro",
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/signs", bytes.NewBufferString(`{"id": "lobby", "name": "Lobby"}`))
+	srv.apiSignsHandler(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Errorf("create sign got code %d want %d", rec.Code, http.StatusCreated)
+	}
+	if got, want := rec.Header().Get("Location"), "/api/signs/lobby"; got != want {
+		t.Errorf("create sign got Location %q want %q", got, want)
+	}
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPost, "/api/signs", bytes.NewBufferString(`{"id": "lobby"}`))
+	srv.apiSignsHandler(rec, req)
+	if rec.Code != http.StatusConflict {
+		t.Errorf("create duplicate sign got code %d want %d", rec.Code, http.StatusConflict)
+	}
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPatch, "/api/signs/lobby", bytes.NewBufferString(`{"name": "Front Lobby"}`))
+	srv.apiSignHandler(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("rename sign got code %d want %d", rec.Code, http.StatusOK)
+	}
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/api/signs", nil)
+	srv.apiSignsHandler(rec, req)
+	got := &pb.Fleet{}
+	if err := json.NewDecoder(rec.Body).Decode(got); err != nil {
+		t.Fatalf("error unmarshaling JSON response: %v", err)
+	}
+	want := &pb.Fleet{Signs: []*pb.Sign{
+		{Id: "default", Name: "Default", Configuration: testConfig},
+		{Id: "lobby", Name: "Front Lobby", Configuration: &pb.Configuration{}},
 	}}
+	if !proto.Equal(got, want) {
+		t.Errorf("list signs got %v want %v", got, want)
+	}
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodDelete, "/api/signs/lobby", nil)
+	srv.apiSignHandler(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("delete sign got code %d want %d", rec.Code, http.StatusNoContent)
+	}
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/api/signs/lobby", nil)
+	srv.apiSignHandler(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("get deleted sign got code %d want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestRequireAuth(t *testing.T) {
+	srv := newServer(testPort, goodFakeNb, &fakeConfig{}, testUsers)
+	sess, err := srv.sessions.Create("sean")
+	if err != nil {
+		t.Fatalf("error creating session: %v", err)
+	}
 
 	tests := []struct {
-		name    string
-		timeNow time.Time
-		fakeNb  *fakeNbClient
-		want    []*pb.Agency
+		name         string
+		path         string
+		token        string
+		cookie       string
+		wantCode     int
+		wantUser     string
+		wantLocation string
 	}{
 		{
-			name:    "FetchFromServer",
-			timeNow: lastRefresh.Add(cacheTimeout + time.Second),
-			fakeNb:  goodFakeNb,
-			want: []*pb.Agency{{
-				Name: "San Francisco MTA",
-				Tag:  "sf-muni",
-			}},
+			name:     "Token",
+			path:     "/api/config",
+			token:    "driver-token",
+			wantCode: http.StatusOK,
+			wantUser: "sean",
 		},
 		{
-			name:    "FetchFromServerError",
-			timeNow: lastRefresh.Add(cacheTimeout + time.Second),
-			fakeNb: &fakeNbClient{
-				agenciesErr: errors.New("fake list agencies error"),
-			},
-			want: []*pb.Agency{{
-				Name: "San Francisco MTA",
-				Tag:  "sf-muni",
-			}},
+			name:     "BadToken",
+			path:     "/api/config",
+			token:    "bogus",
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "Session",
+			path:     "/",
+			cookie:   sess.ID,
+			wantCode: http.StatusOK,
+			wantUser: "sean",
+		},
+		{
+			name:         "BadSession",
+			path:         "/",
+			cookie:       "bogus",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/login?next=%2F",
 		},
 		{
-			name:    "FetchFromCache",
-			timeNow: lastRefresh.Add(cacheTimeout - time.Second),
-			fakeNb:  goodFakeNb,
-			want:    cachedAgencies,
+			name:     "AnonymousAPI",
+			path:     "/api/config",
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "AnonymousPage",
+			path:         "/?sign=default",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/login?next=%2F%3Fsign%3Ddefault",
 		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			srv := newServer(testPort, test.fakeNb, &fakeConfig{})
-			srv.agencyCache = &agencyCache{
-				lastRefresh: lastRefresh,
-				agencies:    cachedAgencies,
+			var gotUser string
+			h := srv.requireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotUser = requestUser(r)
+			}))
+			rec := httptest.NewRecorder()
+
+			req := httptest.NewRequest(http.MethodGet, test.path, nil)
+			if test.token != "" {
+				req.Header.Set("Authorization", "Bearer "+test.token)
+			}
+			if test.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: sessionCookie, Value: test.cookie})
+			}
+			h.ServeHTTP(rec, req)
+			res := rec.Result()
+
+			if res.StatusCode != test.wantCode {
+				t.Errorf("server response code unexpected, got %d want %d", res.StatusCode, test.wantCode)
+			}
+			if gotUser != test.wantUser {
+				t.Errorf("requestUser() = %q want %q", gotUser, test.wantUser)
 			}
-			timeNow = func() time.Time { return test.timeNow }
+			if got := res.Header.Get("Location"); got != test.wantLocation {
+				t.Errorf("redirect location = %q want %q", got, test.wantLocation)
+			}
+		})
+	}
+}
 
-			got := srv.getAgencies()
-			if len(got) != len(test.want) {
-				t.Fatalf("got %d agencies, want %d", len(got), len(test.want))
+func TestCSRFProtection(t *testing.T) {
+	srv := newServer(testPort, goodFakeNb, &fakeConfig{}, testUsers)
+	sess, err := srv.sessions.Create("sean")
+	if err != nil {
+		t.Fatalf("error creating session: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		body       string
+		header     string
+		token      string
+		useSession bool
+		wantCode   int
+	}{
+		{
+			name:       "FormWithToken",
+			method:     http.MethodPost,
+			body:       "csrf_token=" + sess.CSRFToken,
+			useSession: true,
+			wantCode:   http.StatusOK,
+		},
+		{
+			name:       "HeaderWithToken",
+			method:     http.MethodPut,
+			header:     sess.CSRFToken,
+			useSession: true,
+			wantCode:   http.StatusOK,
+		},
+		{
+			name:       "ForgedFormWithoutToken",
+			method:     http.MethodPost,
+			body:       "agency=evil",
+			useSession: true,
+			wantCode:   http.StatusForbidden,
+		},
+		{
+			name:       "ForgedFormWithWrongToken",
+			method:     http.MethodPost,
+			body:       "csrf_token=guess",
+			useSession: true,
+			wantCode:   http.StatusForbidden,
+		},
+		{
+			name:       "ForgedJSONWithoutHeader",
+			method:     http.MethodPut,
+			body:       `{"agency": "evil"}`,
+			useSession: true,
+			wantCode:   http.StatusForbidden,
+		},
+		{
+			name:       "SafeMethodWithoutToken",
+			method:     http.MethodGet,
+			useSession: true,
+			wantCode:   http.StatusOK,
+		},
+		{
+			name:     "APITokenWithoutCSRFToken",
+			method:   http.MethodPut,
+			token:    "driver-token",
+			wantCode: http.StatusOK,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := srv.requireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			rec := httptest.NewRecorder()
+
+			req := httptest.NewRequest(test.method, "/", bytes.NewBufferString(test.body))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if test.header != "" {
+				req.Header.Set(csrfHeader, test.header)
 			}
+			if test.token != "" {
+				req.Header.Set("Authorization", "Bearer "+test.token)
+			}
+			if test.useSession {
+				req.AddCookie(&http.Cookie{Name: sessionCookie, Value: sess.ID})
+			}
+			h.ServeHTTP(rec, req)
 
-			mismatch := false
-			for i, gotAgency := range got {
-				mismatch = mismatch && !proto.Equal(gotAgency, test.want[i])
+			if rec.Code != test.wantCode {
+				t.Errorf("server response code unexpected, got %d want %d", rec.Code, test.wantCode)
 			}
+		})
+	}
+}
+
+func TestFormsIncludeCSRFToken(t *testing.T) {
+	srv := newServer(testPort, goodFakeNb, newFakeConfig(testConfig, ""), testUsers)
+	sess, err := srv.sessions.Create("sean")
+	if err != nil {
+		t.Fatalf("error creating session: %v", err)
+	}
 
-			if mismatch {
-				t.Errorf("agencies differ: got %v want %v", got, test.want)
+	for _, path := range []string{"/", "/signs/default", "/status", "/audit", "/emulator"} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.AddCookie(&http.Cookie{Name: sessionCookie, Value: sess.ID})
+		srv.handler().ServeHTTP(rec, req)
+
+		body := rec.Body.String()
+		want := fmt.Sprintf(`name="csrf_token" value="%s"`, sess.CSRFToken)
+		if got, forms := strings.Count(body, want), strings.Count(body, "<form"); forms == 0 || got != forms {
+			t.Errorf("%s: found CSRF token in %d forms, want all %d", path, got, forms)
+		}
+	}
+}
+
+func TestLogin(t *testing.T) {
+	tests := []struct {
+		name         string
+		form         string
+		wantCode     int
+		wantSession  bool
+		wantLocation string
+	}{
+		{
+			name:         "Good",
+			form:         "username=sean&password=hunter2&next=%2Fapi%2Fconfig",
+			wantCode:     http.StatusSeeOther,
+			wantSession:  true,
+			wantLocation: "/api/config",
+		},
+		{
+			name:         "OffsiteRedirect",
+			form:         "username=sean&password=hunter2&next=%2F%2Fevil.example.com",
+			wantCode:     http.StatusSeeOther,
+			wantSession:  true,
+			wantLocation: "/",
+		},
+		{
+			name:     "WrongPassword",
+			form:     "username=sean&password=hunter3",
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "UnknownUser",
+			form:     "username=mallory&password=hunter2",
+			wantCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srv := newServer(testPort, goodFakeNb, &fakeConfig{}, testUsers)
+			rec := httptest.NewRecorder()
+
+			srv.loginHandler(rec, newLoginRequest(test.form))
+			res := rec.Result()
+
+			if res.StatusCode != test.wantCode {
+				t.Errorf("server response code unexpected, got %d want %d", res.StatusCode, test.wantCode)
+			}
+			if got := res.Header.Get("Location"); got != test.wantLocation {
+				t.Errorf("redirect location = %q want %q", got, test.wantLocation)
+			}
+
+			var gotSession bool
+			for _, c := range res.Cookies() {
+				if c.Name != sessionCookie {
+					continue
+				}
+				if _, ok := srv.sessions.Get(c.Value); ok {
+					gotSession = true
+				}
+			}
+			if gotSession != test.wantSession {
+				t.Errorf("got valid session %t want %t", gotSession, test.wantSession)
+			}
+		})
+	}
+}
+
+// newLoginRequest returns a submission of the login form with a CSRF token
+// that matches the login CSRF cookie.
+func newLoginRequest(form string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(form+"&csrf_token=login-token"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(&http.Cookie{Name: loginCSRFCookie, Value: "login-token"})
+	return req
+}
+
+func TestLoginCSRF(t *testing.T) {
+	srv := newServer(testPort, goodFakeNb, &fakeConfig{}, testUsers)
+
+	// The login page sets a CSRF cookie and puts the same token in the form.
+	rec := httptest.NewRecorder()
+	srv.loginHandler(rec, httptest.NewRequest(http.MethodGet, "/login", nil))
+	var token string
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == loginCSRFCookie {
+			token = c.Value
+		}
+	}
+	if token == "" {
+		t.Fatalf("GET /login did not set the %s cookie", loginCSRFCookie)
+	}
+	if want := fmt.Sprintf(`name="csrf_token" value="%s"`, token); !strings.Contains(rec.Body.String(), want) {
+		t.Errorf("GET /login did not put the CSRF token in the form")
+	}
+
+	tests := []struct {
+		name   string
+		cookie string
+		token  string
+		want   int
+	}{
+		{name: "Matching", cookie: token, token: token, want: http.StatusSeeOther},
+		{name: "NoCookie", token: token, want: http.StatusForbidden},
+		{name: "NoToken", cookie: token, want: http.StatusForbidden},
+		{name: "Mismatched", cookie: token, token: "forged-token", want: http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			form := url.Values{"username": {"sean"}, "password": {"hunter2"}}
+			if test.token != "" {
+				form.Set("csrf_token", test.token)
+			}
+			req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if test.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: loginCSRFCookie, Value: test.cookie})
+			}
+			rec := httptest.NewRecorder()
+			srv.loginHandler(rec, req)
+			if rec.Code != test.want {
+				t.Errorf("POST /login got code %d want %d", rec.Code, test.want)
+			}
+		})
+	}
+}
+
+func TestLogout(t *testing.T) {
+	srv := newServer(testPort, goodFakeNb, &fakeConfig{}, testUsers)
+	sess, err := srv.sessions.Create("sean")
+	if err != nil {
+		t.Fatalf("error creating session: %v", err)
+	}
+	rec := httptest.NewRecorder()
+
+	req := httptest.NewRequest(http.MethodPost, "/logout", nil)
+	req.AddCookie(&http.Cookie{Name: sessionCookie, Value: sess.ID})
+	srv.logoutHandler(rec, req)
+
+	if rec.Code != http.StatusSeeOther {
+		t.Errorf("server response code unexpected, got %d want %d", rec.Code, http.StatusSeeOther)
+	}
+	if _, ok := srv.sessions.Get(sess.ID); ok {
+		t.Errorf("session still valid after logout")
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	tests := []struct {
+		name        string
+		current     string
+		new         string
+		wantCode    int
+		wantChanged bool
+	}{
+		{name: "Changed", current: "hunter2", new: "correct horse", wantCode: http.StatusSeeOther, wantChanged: true},
+		{name: "WrongPassword", current: "hunter3", new: "correct horse", wantCode: http.StatusForbidden},
+		{name: "EmptyPassword", current: "hunter2", wantCode: http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			users := &fakeUsers{passwords: map[string]string{"sean": "hunter2"}}
+			srv := newServer(testPort, goodFakeNb, &fakeConfig{}, users)
+			var sessions []*auth.Session
+			for i := 0; i < 2; i++ {
+				sess, err := srv.sessions.Create("sean")
+				if err != nil {
+					t.Fatalf("error creating session: %v", err)
+				}
+				sessions = append(sessions, sess)
+			}
+
+			form := url.Values{"current_password": {test.current}, "new_password": {test.new}, "csrf_token": {sessions[0].CSRFToken}}
+			req := httptest.NewRequest(http.MethodPost, "/account/password", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.AddCookie(&http.Cookie{Name: sessionCookie, Value: sessions[0].ID})
+			rec := httptest.NewRecorder()
+			srv.handler().ServeHTTP(rec, req)
+
+			if rec.Code != test.wantCode {
+				t.Errorf("POST /account/password got code %d want %d", rec.Code, test.wantCode)
+			}
+			if changed := users.passwords["sean"] == test.new; changed != test.wantChanged {
+				t.Errorf("password changed = %t want %t", changed, test.wantChanged)
+			}
+			for i, sess := range sessions {
+				if _, ok := srv.sessions.Get(sess.ID); ok == test.wantChanged {
+					t.Errorf("session %d valid = %t after password change want %t", i, ok, !test.wantChanged)
+				}
+			}
+		})
+	}
+}
+
+// A bcrypt hash of "hunter2".
+const testPasswordHash = "$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy"
+
+func TestExportImport(t *testing.T) {
+	lobby := &pb.Configuration{Agency: "sf-muni", Stops: []*pb.Stop{{Id: "9012"}}}
+	usersData := []byte(`{"users": [{"name": "sean", "password_hash": "` + testPasswordHash + `"}]}`)
+
+	src := newFakeConfig(testConfig, config.Revision(testConfig))
+	src.Create("lobby", "Lobby")
+	src.Put("lobby", lobby, "")
+	srcUsers := &fakeUsers{exported: usersData}
+	rec := httptest.NewRecorder()
+	newServer(testPort, goodFakeNb, src, srcUsers).apiExportHandler(rec, httptest.NewRequest(http.MethodGet, "/api/export", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("export got code %d want %d", rec.Code, http.StatusOK)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "application/gzip" {
+		t.Errorf("export got Content-Type %q want %q", got, "application/gzip")
+	}
+	archive := rec.Body.Bytes()
+
+	// The destination has a different default sign and an extra sign, which
+	// the import replaces and deletes.
+	dst := newFakeConfig(&pb.Configuration{Agency: "actransit"}, "")
+	dst.Create("garage", "Garage")
+	dstUsers := &fakeUsers{}
+	srv := newServer(testPort, goodFakeNb, dst, dstUsers)
+
+	wantSummary := importSummary{
+		Created: []string{"lobby"},
+		Updated: []string{"default"},
+		Deleted: []string{"garage"},
+		Users:   []string{"sean"},
+	}
+	for _, dryRun := range []bool{true, false} {
+		url := "/api/import"
+		if dryRun {
+			url += "?dry_run=1"
+		}
+		rec = httptest.NewRecorder()
+		srv.apiImportHandler(rec, httptest.NewRequest(http.MethodPost, url, bytes.NewReader(archive)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("import (dry run %t) got code %d want %d: %s", dryRun, rec.Code, http.StatusOK, rec.Body)
+		}
+		var got importSummary
+		if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+			t.Fatalf("error unmarshaling JSON response: %v", err)
+		}
+		want := wantSummary
+		want.DryRun = dryRun
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("import (dry run %t) got summary %+v want %+v", dryRun, got, want)
+		}
+
+		if dryRun {
+			if len(dst.signs) != 2 || dstUsers.imported != nil {
+				t.Errorf("dry run import changed the signs or users")
+			}
+		}
+	}
+
+	// The imported configurations are upgraded to the current schema, as
+	// they would be by any other change.
+	migrated := func(c *pb.Configuration) *pb.Configuration {
+		c = proto.Clone(c).(*pb.Configuration)
+		c.SchemaVersion = config.CurrentSchemaVersion
+		return c
+	}
+	want := &pb.Fleet{Signs: []*pb.Sign{
+		{Id: "default", Name: "Default", Configuration: migrated(testConfig)},
+		{Id: "lobby", Name: "Lobby", Configuration: migrated(lobby)},
+	}}
+	if got := (&pb.Fleet{Signs: dst.signs}); !proto.Equal(got, want) {
+		t.Errorf("signs after import = %v want %v", got, want)
+	}
+	if !bytes.Equal(dstUsers.imported, usersData) {
+		t.Errorf("users after import = %s want %s", dstUsers.imported, usersData)
+	}
+
+	// Every change to a sign is audited.
+	var actions []string
+	for _, e := range srv.audit.entries {
+		actions = append(actions, e.Action+" "+e.Sign)
+	}
+	wantActions := []string{"update default", "create lobby", "update lobby", "delete garage", "import "}
+	if !reflect.DeepEqual(actions, wantActions) {
+		t.Errorf("audit log after import = %q want %q", actions, wantActions)
+	}
+
+	// Importing the same backup again changes nothing, even though it holds
+	// configurations from before the current schema.
+	rec = httptest.NewRecorder()
+	srv.apiImportHandler(rec, httptest.NewRequest(http.MethodPost, "/api/import?dry_run=1", bytes.NewReader(archive)))
+	var got importSummary
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatalf("error unmarshaling JSON response: %v", err)
+	}
+	if len(got.Created) != 0 || len(got.Updated) != 0 || len(got.Deleted) != 0 {
+		t.Errorf("second import got summary %+v want no changes", got)
+	}
+}
+
+func TestImportFailure(t *testing.T) {
+	usersData := []byte(`{"users": [{"name": "sean", "password_hash": "` + testPasswordHash + `"}]}`)
+	var archive bytes.Buffer
+	b := &backup{
+		fleet: &pb.Fleet{Signs: []*pb.Sign{{Id: "lobby", Name: "Lobby", Configuration: testConfig}}},
+		users: usersData,
+	}
+	if err := writeBackup(&archive, b); err != nil {
+		t.Fatalf("writeBackup() = %v want <nil>", err)
+	}
+
+	cfg := newFakeConfig(testConfig, "")
+	cfg.putErr = errors.New("disk is full")
+	oldUsers := []byte(`{"users": [{"name": "admin", "password_hash": "` + testPasswordHash + `"}]}`)
+	users := &fakeUsers{exported: oldUsers}
+	srv := newServer(testPort, goodFakeNb, cfg, users)
+
+	rec := httptest.NewRecorder()
+	srv.apiImportHandler(rec, httptest.NewRequest(http.MethodPost, "/api/import", &archive))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("import got code %d want %d", rec.Code, http.StatusInternalServerError)
+	}
+	if len(cfg.signs) != 1 || cfg.signs[0].GetId() != config.DefaultSignID {
+		t.Errorf("signs after failed import = %v want only the default sign", cfg.signs)
+	}
+	// The users are put back.
+	if !bytes.Equal(users.imported, oldUsers) {
+		t.Errorf("users after failed import = %s want %s", users.imported, oldUsers)
+	}
+}
+
+func TestImportTooLarge(t *testing.T) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, err := mw.CreateFormFile("archive", "backup.tar.gz")
+	if err != nil {
+		t.Fatalf("error creating form file: %v", err)
+	}
+	fw.Write(make([]byte, maxBackupSize+1))
+	mw.Close()
+
+	cfg := newFakeConfig(testConfig, "")
+	srv := newServer(testPort, goodFakeNb, cfg, &fakeUsers{})
+	req := httptest.NewRequest(http.MethodPost, "/api/import", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	rec := httptest.NewRecorder()
+	srv.apiImportHandler(rec, req)
+
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "request body too large") {
+		t.Errorf("oversized import got code %d, %q want %d, body too large", rec.Code, rec.Body.String(), http.StatusBadRequest)
+	}
+}
+
+func TestImportInvalid(t *testing.T) {
+	gzipped := func(files map[string]string) []byte {
+		var buf bytes.Buffer
+		gw := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gw)
+		for name, data := range files {
+			tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(data))})
+			tw.Write([]byte(data))
+		}
+		tw.Close()
+		gw.Close()
+		return buf.Bytes()
+	}
+
+	tests := []struct {
+		name string
+		body []byte
+	}{
+		{name: "NotGzip", body: []byte("hello")},
+		{name: "MissingFleet", body: gzipped(map[string]string{"users.json": `{"users": []}`})},
+		{name: "BadFleet", body: gzipped(map[string]string{"fleet.json": `{"signs": 5}`})},
+		{name: "InvalidSignID", body: gzipped(map[string]string{"fleet.json": `{"signs": [{"id": "Not Valid!"}]}`})},
+		{name: "BadUsers", body: gzipped(map[string]string{"fleet.json": `{}`, "users.json": `{"users": [{"name": "sean"}]}`})},
+		{name: "NoUsers", body: gzipped(map[string]string{"fleet.json": `{}`, "users.json": `{"users": []}`})},
+		{name: "UnsupportedSchemaVersion", body: gzipped(map[string]string{"fleet.json": `{"signs": [{"id": "lobby", "configuration": {"schema_version": 99, "agency": "sf-muni"}}]}`})},
+		{name: "NoAgency", body: gzipped(map[string]string{"fleet.json": `{"signs": [{"id": "lobby", "configuration": {"stops": [{"id": "1234"}]}}]}`})},
+		{name: "UnknownProfile", body: gzipped(map[string]string{"fleet.json": `{"signs": [{"id": "lobby", "configuration": {"agency": "sf-muni", "schedule": {"default_profile": "Weekdays"}}}]}`})},
+		{name: "UnexpectedFile", body: gzipped(map[string]string{"fleet.json": `{}`, "evil.sh": `rm -rf /`})},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := newFakeConfig(testConfig, "")
+			users := &fakeUsers{}
+			srv := newServer(testPort, goodFakeNb, cfg, users)
+
+			rec := httptest.NewRecorder()
+			srv.apiImportHandler(rec, httptest.NewRequest(http.MethodPost, "/api/import", bytes.NewReader(test.body)))
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("import got code %d want %d", rec.Code, http.StatusBadRequest)
+			}
+			if len(cfg.signs) != 1 || !proto.Equal(cfg.signs[0].GetConfiguration(), testConfig) || users.imported != nil {
+				t.Errorf("invalid import changed the signs or users")
 			}
 		})
 	}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/wallaceicy06/muni-sign/admin/config"
+	pb "github.com/wallaceicy06/muni-sign/proto"
+)
+
+// signHandlerFunc is a handler for a resource that belongs to a single sign.
+type signHandlerFunc func(w http.ResponseWriter, r *http.Request, id string)
+
+// defaultSign adapts a sign handler to always act on the default sign.
+func defaultSign(h signHandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h(w, r, config.DefaultSignID)
+	}
+}
+
+// apiSignsHandler lists the signs in the fleet and creates new ones.
+func (s *server) apiSignsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		signs, err := s.cfg.List()
+		if err != nil {
+			configError(w, err)
+			return
+		}
+		writeJSON(w, &pb.Fleet{Signs: signs})
+	case http.MethodPost:
+		sign := &pb.Sign{}
+		if err := json.NewDecoder(r.Body).Decode(sign); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid sign: %v", err), http.StatusBadRequest)
+			return
+		}
+		if !config.ValidSignID(sign.GetId()) {
+			http.Error(w, "Sign IDs may only contain lowercase letters, digits, dashes and underscores.", http.StatusBadRequest)
+			return
+		}
+		if sign.GetName() == "" {
+			sign.Name = sign.GetId()
+		}
+		if err := s.configFor(r).Create(sign.GetId(), sign.GetName()); err != nil {
+			configError(w, err)
+			return
+		}
+		w.Header().Set("Location", "/api/signs/"+sign.GetId())
+		writeJSONStatus(w, http.StatusCreated, &pb.Sign{Id: sign.GetId(), Name: sign.GetName()})
+	default:
+		http.Error(w, fmt.Sprintf("Unsupported method: %s.", r.Method), http.StatusMethodNotAllowed)
+	}
+}
+
+// apiSignHandler serves the resources of a single sign:
+//
+//	/api/signs/<id>               the sign itself
+//	/api/signs/<id>/config        its configuration
+//	/api/signs/<id>/config/watch  a stream of its configurations
+//	/api/signs/<id>/status        its health, and heartbeats from its driver
+//	/api/signs/<id>/override      a temporary message shown on the sign
+func (s *server) apiSignHandler(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/api/signs/")
+	id, resource := path, ""
+	if i := strings.Index(path, "/"); i >= 0 {
+		id, resource = path[:i], path[i+1:]
+	}
+
+	switch resource {
+	case "":
+		s.apiSignResourceHandler(w, r, id)
+	case "config":
+		s.apiConfigHandler(w, r, id)
+	case "config/watch":
+		s.apiConfigWatchHandler(w, r, id)
+	case "status":
+		s.apiSignStatusHandler(w, r, id)
+	case "override":
+		s.apiOverrideHandler(w, r, id)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// apiSignResourceHandler gets, renames (with a PATCH containing a new name) and
+// deletes a sign.
+func (s *server) apiSignResourceHandler(w http.ResponseWriter, r *http.Request, id string) {
+	switch r.Method {
+	case http.MethodGet:
+		sign, err := s.findSign(id)
+		if err != nil {
+			configError(w, err)
+			return
+		}
+		writeJSON(w, sign)
+	case http.MethodPatch:
+		sign := &pb.Sign{}
+		if err := json.NewDecoder(r.Body).Decode(sign); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid sign: %v", err), http.StatusBadRequest)
+			return
+		}
+		if sign.GetId() != "" && sign.GetId() != id {
+			http.Error(w, "Sign IDs cannot be changed.", http.StatusBadRequest)
+			return
+		}
+		if sign.GetName() == "" {
+			http.Error(w, "Name must be provided.", http.StatusBadRequest)
+			return
+		}
+		if err := s.configFor(r).Rename(id, sign.GetName()); err != nil {
+			configError(w, err)
+			return
+		}
+		writeJSON(w, &pb.Sign{Id: id, Name: sign.GetName()})
+	case http.MethodDelete:
+		if err := s.configFor(r).Delete(id); err != nil {
+			configError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, fmt.Sprintf("Unsupported method: %s.", r.Method), http.StatusMethodNotAllowed)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	writeJSONStatus(w, http.StatusOK, v)
+}
+
+func writeJSONStatus(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error writing JSON response: %v", err)
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/wallaceicy06/muni-sign/proto"
+)
+
+// How often a driver is assumed to send heartbeats if it does not say.
+const defaultHeartbeatInterval = time.Minute
+
+// How many heartbeats in a row a sign may miss before it is considered
+// offline.
+const missedHeartbeats = 3
+
+// The health of a sign, as shown on the status page.
+const (
+	stateOnline  = "online"
+	stateOffline = "offline"
+	// The sign has not sent a heartbeat since the admin server started.
+	stateUnknown = "unknown"
+)
+
+// statusStore holds the last heartbeat received from each sign. Heartbeats are
+// only kept in memory, since a sign that is alive sends another one soon
+// after the admin server restarts. It is safe for concurrent use.
+type statusStore struct {
+	mu       sync.Mutex
+	statuses map[string]*pb.SignStatus
+}
+
+func newStatusStore() *statusStore {
+	return &statusStore{statuses: make(map[string]*pb.SignStatus)}
+}
+
+// report records a heartbeat from the sign with the given ID, stamping it with
+// the time it was received.
+func (ss *statusStore) report(id string, status *pb.SignStatus) {
+	status = proto.Clone(status).(*pb.SignStatus)
+	status.ReportTime = timeNow().Unix()
+
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.statuses[id] = status
+}
+
+// health returns the health of a sign based on its last heartbeat.
+func (ss *statusStore) health(sign *pb.Sign) *signHealth {
+	ss.mu.Lock()
+	status := ss.statuses[sign.GetId()]
+	ss.mu.Unlock()
+
+	h := &signHealth{ID: sign.GetId(), Name: sign.GetName(), State: stateUnknown, Status: status}
+	if status == nil {
+		return h
+	}
+	interval := time.Duration(status.GetIntervalSeconds()) * time.Second
+	if interval <= 0 {
+		interval = defaultHeartbeatInterval
+	}
+	if timeNow().Sub(h.lastSeen()) > missedHeartbeats*interval {
+		h.State = stateOffline
+	} else {
+		h.State = stateOnline
+	}
+	return h
+}
+
+// signHealth describes how a sign is doing.
+type signHealth struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	State string `json:"state"`
+	// The last heartbeat received from the sign, if any.
+	Status *pb.SignStatus `json:"status,omitempty"`
+}
+
+func (h *signHealth) lastSeen() time.Time {
+	return time.Unix(h.Status.GetReportTime(), 0)
+}
+
+// LastSeen describes how long ago the last heartbeat was received.
+func (h *signHealth) LastSeen() string {
+	if h.Status == nil {
+		return "never"
+	}
+	return ago(h.lastSeen())
+}
+
+// LastFetch describes how long ago the sign last fetched predictions.
+func (h *signHealth) LastFetch() string {
+	if h.Status.GetLastFetchTime() == 0 {
+		return "never"
+	}
+	return ago(time.Unix(h.Status.GetLastFetchTime(), 0))
+}
+
+// Uptime returns how long the sign's driver has been running.
+func (h *signHealth) Uptime() string {
+	return (time.Duration(h.Status.GetUptimeSeconds()) * time.Second).String()
+}
+
+// Color returns the color of the current message as a CSS hex color.
+func (h *signHealth) Color() string {
+	return cssColor(h.Status.GetColor())
+}
+
+func ago(t time.Time) string {
+	d := timeNow().Sub(t)
+	if d < 0 {
+		d = 0
+	}
+	return d.Truncate(time.Second).String() + " ago"
+}
+
+type statusTemplate struct {
+	Signs []*signHealth
+	accountTemplate
+}
+
+// fleetHealth returns the health of every sign in the fleet.
+func (s *server) fleetHealth() ([]*signHealth, error) {
+	signs, err := s.cfg.List()
+	if err != nil {
+		return nil, err
+	}
+	health := make([]*signHealth, 0, len(signs))
+	for _, sign := range signs {
+		health = append(health, s.statuses.health(sign))
+	}
+	return health, nil
+}
+
+// statusHandler serves the status page, which shows the health of every sign.
+func (s *server) statusHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, fmt.Sprintf("Unsupported method: %s.", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+	health, err := s.fleetHealth()
+	if err != nil {
+		configError(w, err)
+		return
+	}
+	s.renderPage("status", &statusTemplate{health, requestAccount(r)}, w)
+}
+
+// apiStatusHandler lists the health of every sign.
+func (s *server) apiStatusHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, fmt.Sprintf("Unsupported method: %s.", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+	health, err := s.fleetHealth()
+	if err != nil {
+		configError(w, err)
+		return
+	}
+	writeJSON(w, health)
+}
+
+// apiSignStatusHandler gets the health of a sign and records the heartbeats
+// that its driver PUTs.
+func (s *server) apiSignStatusHandler(w http.ResponseWriter, r *http.Request, id string) {
+	sign, err := s.findSign(id)
+	if err != nil {
+		configError(w, err)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, s.statuses.health(sign))
+	case http.MethodPut:
+		status := &pb.SignStatus{}
+		if err := json.NewDecoder(r.Body).Decode(status); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid status: %v", err), http.StatusBadRequest)
+			return
+		}
+		s.statuses.report(id, status)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, fmt.Sprintf("Unsupported method: %s.", r.Method), http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/wallaceicy06/muni-sign/proto"
+)
+
+func TestStatusStoreHealth(t *testing.T) {
+	defer func() { timeNow = time.Now }()
+	reportTime := time.Now()
+	sign := &pb.Sign{Id: "default", Name: "Default"}
+
+	tests := []struct {
+		name    string
+		status  *pb.SignStatus
+		timeNow time.Time
+		want    string
+	}{
+		{
+			name:    "NeverReported",
+			timeNow: reportTime,
+			want:    stateUnknown,
+		},
+		{
+			name:    "Online",
+			status:  &pb.SignStatus{IntervalSeconds: 10},
+			timeNow: reportTime.Add(25 * time.Second),
+			want:    stateOnline,
+		},
+		{
+			name:    "Offline",
+			status:  &pb.SignStatus{IntervalSeconds: 10},
+			timeNow: reportTime.Add(35 * time.Second),
+			want:    stateOffline,
+		},
+		{
+			name:    "DefaultIntervalOnline",
+			status:  &pb.SignStatus{},
+			timeNow: reportTime.Add(missedHeartbeats*defaultHeartbeatInterval - time.Second),
+			want:    stateOnline,
+		},
+		{
+			name:    "DefaultIntervalOffline",
+			status:  &pb.SignStatus{},
+			timeNow: reportTime.Add(missedHeartbeats*defaultHeartbeatInterval + time.Second),
+			want:    stateOffline,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ss := newStatusStore()
+			if test.status != nil {
+				timeNow = func() time.Time { return reportTime }
+				ss.report(sign.GetId(), test.status)
+			}
+
+			timeNow = func() time.Time { return test.timeNow }
+			if got := ss.health(sign).State; got != test.want {
+				t.Errorf("ss.health().State = %q want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestApiSignStatus(t *testing.T) {
+	defer func() { timeNow = time.Now }()
+	now := time.Unix(1500000000, 0)
+	timeNow = func() time.Time { return now }
+
+	srv := newServer(testPort, goodFakeNb, newFakeConfig(testConfig, ""), testUsers)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/signs/default/status", nil)
+	srv.apiSignHandler(rec, req)
+	got := &signHealth{}
+	if err := json.NewDecoder(rec.Body).Decode(got); err != nil {
+		t.Fatalf("error unmarshaling JSON response: %v", err)
+	}
+	if got.State != stateUnknown || got.Status != nil {
+		t.Errorf("status before heartbeat got %+v want state %q and no status", got, stateUnknown)
+	}
+
+	status := &pb.SignStatus{
+		Message:       "N-Judah\n3 mins",
+		Color:         &pb.Color{Red: 1.0},
+		LastFetchTime: now.Unix() - 5,
+		FetchErrors:   2,
+		UptimeSeconds: 3600,
+	}
+	data, err := json.Marshal(status)
+	if err != nil {
+		t.Fatalf("error marshaling status: %v", err)
+	}
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPut, "/api/signs/default/status", bytes.NewReader(data))
+	srv.apiSignHandler(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("heartbeat got code %d want %d", rec.Code, http.StatusNoContent)
+	}
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/api/status", nil)
+	srv.apiStatusHandler(rec, req)
+	var health []*signHealth
+	if err := json.NewDecoder(rec.Body).Decode(&health); err != nil {
+		t.Fatalf("error unmarshaling JSON response: %v", err)
+	}
+	want := proto.Clone(status).(*pb.SignStatus)
+	want.ReportTime = now.Unix()
+	if len(health) != 1 || health[0].ID != "default" || health[0].State != stateOnline || !proto.Equal(health[0].Status, want) {
+		t.Errorf("list status got %+v want one online sign with status %v", health, want)
+	}
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/status", nil)
+	srv.statusHandler(rec, req)
+	body := rec.Body.String()
+	for _, s := range []string{"online", "N-Judah", "#ff0000", "5s ago", "1h0m0s"} {
+		if !strings.Contains(body, s) {
+			t.Errorf("status page does not contain %q", s)
+		}
+	}
+}
+
+func TestApiSignStatusInvalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		wantCode int
+	}{
+		{
+			name:     "UnknownSign",
+			method:   http.MethodPut,
+			path:     "/api/signs/bogus/status",
+			body:     `{}`,
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "InvalidJSON",
+			method:   http.MethodPut,
+			path:     "/api/signs/default/status",
+			body:     `{`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "InvalidMethod",
+			method:   http.MethodPost,
+			path:     "/api/signs/default/status",
+			body:     `{}`,
+			wantCode: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srv := newServer(testPort, goodFakeNb, newFakeConfig(testConfig, ""), testUsers)
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(test.method, test.path, strings.NewReader(test.body))
+			srv.apiSignHandler(rec, req)
+			if rec.Code != test.wantCode {
+				t.Errorf("got code %d want %d", rec.Code, test.wantCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	pb "github.com/wallaceicy06/muni-sign/proto"
+)
+
+// How many empty rows the configuration form offers for adding stops.
+const blankStopRows = 2
+
+// The color offered for stops that do not have one.
+var defaultStopColor = &pb.Color{Red: 1.0, Green: 1.0, Blue: 1.0}
+
+// stopRow is a row of the stops table in the configuration form.
+type stopRow struct {
+	// The index of the row, which identifies its checkboxes.
+	Index int
+	// The position that the stop is shown in, starting at 1.
+	Order    int
+	ID       string
+	Nickname string
+	// Whether the stop has its own color, and the color.
+	Colored bool
+	Color   string
+	Routes  string
+	Walk    string
+}
+
+// Stops returns the stops of the sign, in the order they are shown.
+func (t *signTemplate) Stops() []stopRow {
+	return stopRows(t.Cfg)
+}
+
+// CurrentStops returns the stops of the configuration that is currently
+// stored.
+func (t *conflictTemplate) CurrentStops() []stopRow {
+	return stopRows(t.Current)
+}
+
+// StopRows returns the rows of the stops table, with room for new stops at
+// the end.
+func (t *signTemplate) StopRows() []stopRow {
+	rows := stopRows(t.Cfg)
+	for i := 0; i < blankStopRows; i++ {
+		rows = append(rows, stopRow{Index: len(rows), Order: len(rows) + 1, Color: cssColor(defaultStopColor)})
+	}
+	return rows
+}
+
+func stopRows(c *pb.Configuration) []stopRow {
+	var rows []stopRow
+	for i, s := range c.GetStops() {
+		row := stopRow{
+			Index:    i,
+			Order:    i + 1,
+			ID:       s.GetId(),
+			Nickname: s.GetNickname(),
+			Colored:  s.GetColor() != nil,
+			Color:    cssColor(defaultStopColor),
+			Routes:   strings.Join(s.GetRoutes(), " "),
+		}
+		if s.GetColor() != nil {
+			row.Color = cssColor(s.GetColor())
+		}
+		if s.GetWalkingMinutes() > 0 {
+			row.Walk = strconv.Itoa(int(s.GetWalkingMinutes()))
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// parseStopsForm reads the stops submitted with the configuration form, in
+// the order given by their order fields. Rows whose id is empty are left out.
+func parseStopsForm(r *http.Request) ([]*pb.Stop, error) {
+	ids, nicknames, colors, routes, walks, orders := r.Form["stop_id"], r.Form["stop_nickname"], r.Form["stop_color"], r.Form["stop_routes"], r.Form["stop_walk"], r.Form["stop_order"]
+	// Only the ids are required, so that scripts can submit just those.
+	field := func(values []string, i int) string {
+		if i < len(values) {
+			return strings.TrimSpace(values[i])
+		}
+		return ""
+	}
+	colored := make(map[string]bool)
+	for _, i := range r.Form["stop_colored"] {
+		colored[i] = true
+	}
+
+	type orderedStop struct {
+		order int
+		stop  *pb.Stop
+	}
+	var stops []orderedStop
+	for i, id := range ids {
+		id = strings.TrimSpace(id)
+		if id == "" {
+			continue
+		}
+		s := &pb.Stop{
+			Id:       id,
+			Nickname: field(nicknames, i),
+			Routes:   strings.Fields(field(routes, i)),
+		}
+		if colored[strconv.Itoa(i)] {
+			c, err := parseCSSColor(field(colors, i))
+			if err != nil {
+				return nil, fmt.Errorf("stop %s: %v", id, err)
+			}
+			s.Color = c
+		}
+		if walk := field(walks, i); walk != "" {
+			m, err := strconv.Atoi(walk)
+			if err != nil || m < 0 {
+				return nil, fmt.Errorf("stop %s: invalid walking time %q", id, walk)
+			}
+			s.WalkingMinutes = int32(m)
+		}
+		order := i + 1
+		if o := field(orders, i); o != "" {
+			var err error
+			if order, err = strconv.Atoi(o); err != nil {
+				return nil, fmt.Errorf("stop %s: invalid order %q", id, o)
+			}
+		}
+		stops = append(stops, orderedStop{order, s})
+	}
+	sort.SliceStable(stops, func(i, j int) bool { return stops[i].order < stops[j].order })
+
+	var sorted []*pb.Stop
+	for _, s := range stops {
+		sorted = append(sorted, s.stop)
+	}
+	return sorted, nil
+}
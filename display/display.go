@@ -0,0 +1,294 @@
+// Package display serves the DisplayDriver gRPC service without an LCD. What
+// is written to the display is passed on to sinks, such as a terminal, a
+// recording or a web page, so that the whole sign can be run and tested
+// anywhere.
+package display
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	pb "github.com/wallaceicy06/muni-sign/proto"
+)
+
+// The size of the emulated display, in characters.
+const (
+	Rows = 2
+	Cols = 16
+)
+
+// The number of custom characters that can be defined, like an HD44780.
+const GlyphSlots = 8
+
+// Alias for time.Now to facilitate testing.
+var timeNow = time.Now
+
+// State is what the display shows.
+type State struct {
+	// The message exactly as it was written, including newlines.
+	Message string `json:"message"`
+	// The color of the backlight.
+	Color *pb.Color `json:"color"`
+	// The brightness of the backlight, from 0 (off) to 1 (full).
+	Brightness float64 `json:"brightness"`
+	// The custom characters by slot, with nil for those that are not defined,
+	// or nil if none are.
+	Glyphs []*pb.Glyph `json:"glyphs,omitempty"`
+}
+
+// Lines returns the text of each row of the display. Like an HD44780, a
+// newline moves to the start of the next row, and characters past the last
+// column are not visible.
+func (s State) Lines() []string {
+	lines := strings.Split(s.Message, "\n")
+	rows := make([]string, Rows)
+	for i := range rows {
+		if i >= len(lines) {
+			break
+		}
+		line := []rune(lines[i])
+		if len(line) > Cols {
+			line = line[:Cols]
+		}
+		rows[i] = string(line)
+	}
+	return rows
+}
+
+// Event is a change to the display, as passed to sinks.
+type Event struct {
+	Time time.Time `json:"time"`
+	// The RPC that changed the display, such as "Write".
+	Method string `json:"method"`
+	// What the display shows after the change.
+	State State `json:"state"`
+}
+
+// Sink is shown every change to the display.
+type Sink interface {
+	// Show is called with every change, in order. An error fails the RPC
+	// that caused the change, but the display still changes.
+	Show(e Event) error
+}
+
+// Server implements the DisplayDriver service, checking requests the way a
+// real display would before passing them to its sinks. It is safe for
+// concurrent use.
+type Server struct {
+	sinks []Sink
+
+	mu    sync.Mutex
+	state State
+}
+
+// NewServer returns a server for a display that is blank, with the backlight
+// at full brightness, and shows every change on the given sinks.
+func NewServer(sinks ...Sink) *Server {
+	return &Server{
+		sinks: sinks,
+		state: State{Color: &pb.Color{}, Brightness: 1},
+	}
+}
+
+// State returns what the display shows.
+func (s *Server) State() State {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state
+}
+
+// GetCapabilities describes the emulated display, which is able to show any
+// character.
+func (s *Server) GetCapabilities(ctx context.Context, req *pb.GetCapabilitiesRequest) (*pb.Capabilities, error) {
+	return &pb.Capabilities{
+		Rows:         Rows,
+		Cols:         Cols,
+		Charset:      pb.Capabilities_UNICODE,
+		ColorSupport: pb.Capabilities_RGB,
+		GlyphSlots:   GlyphSlots,
+	}, nil
+}
+
+func (s *Server) DefineGlyph(ctx context.Context, req *pb.DefineGlyphRequest) (*pb.Empty, error) {
+	if req.GetSlot() < 0 || req.GetSlot() >= GlyphSlots {
+		return nil, grpc.Errorf(codes.OutOfRange, "slot must be between 0 and %d, got %d", GlyphSlots-1, req.GetSlot())
+	}
+	rows := req.GetGlyph().GetRows()
+	if len(rows) != 8 {
+		return nil, grpc.Errorf(codes.InvalidArgument, "glyph must have 8 rows, got %d", len(rows))
+	}
+	for i, r := range rows {
+		if r >= 1<<5 {
+			return nil, grpc.Errorf(codes.InvalidArgument, "glyph row %d must be 5 pixels wide, got %#x", i, r)
+		}
+	}
+	err := s.update("DefineGlyph", func(st *State) {
+		// Events keep the glyphs they were shown with, so they are copied
+		// rather than changed.
+		glyphs := make([]*pb.Glyph, GlyphSlots)
+		copy(glyphs, st.Glyphs)
+		glyphs[req.GetSlot()] = &pb.Glyph{Rows: append([]uint32(nil), rows...)}
+		st.Glyphs = glyphs
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &pb.Empty{}, nil
+}
+
+func (s *Server) Write(ctx context.Context, req *pb.WriteRequest) (*pb.Empty, error) {
+	if !utf8.ValidString(req.GetMessage()) {
+		return nil, grpc.Errorf(codes.InvalidArgument, "message must be a string: %q", req.GetMessage())
+	}
+	if err := checkColor(req.GetColor()); err != nil {
+		return nil, err
+	}
+	err := s.update("Write", func(st *State) {
+		st.Message = req.GetMessage()
+		st.Color = copyColor(req.GetColor())
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &pb.Empty{}, nil
+}
+
+func (s *Server) WriteLines(ctx context.Context, req *pb.WriteLinesRequest) (*pb.Empty, error) {
+	for i, l := range req.GetLines() {
+		if !utf8.ValidString(l.GetText()) {
+			return nil, grpc.Errorf(codes.InvalidArgument, "line %d must be a string: %q", i, l.GetText())
+		}
+		if l.GetRow() < 0 || l.GetRow() >= Rows {
+			return nil, grpc.Errorf(codes.OutOfRange, "line %d row must be between 0 and %d, got %d", i, Rows-1, l.GetRow())
+		}
+		if l.GetColumn() < 0 || l.GetColumn() >= Cols {
+			return nil, grpc.Errorf(codes.OutOfRange, "line %d column must be between 0 and %d, got %d", i, Cols-1, l.GetColumn())
+		}
+	}
+	if err := checkColor(req.GetColor()); err != nil {
+		return nil, err
+	}
+	err := s.update("WriteLines", func(st *State) {
+		st.Message = layOut(req.GetLines())
+		st.Color = copyColor(req.GetColor())
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &pb.Empty{}, nil
+}
+
+func (s *Server) Clear(ctx context.Context, req *pb.ClearRequest) (*pb.Empty, error) {
+	if err := s.update("Clear", func(st *State) { st.Message = "" }); err != nil {
+		return nil, err
+	}
+	return &pb.Empty{}, nil
+}
+
+func (s *Server) SetBrightness(ctx context.Context, req *pb.SetBrightnessRequest) (*pb.Empty, error) {
+	if err := checkFraction("brightness", req.GetBrightness()); err != nil {
+		return nil, err
+	}
+	err := s.update("SetBrightness", func(st *State) {
+		st.Brightness = req.GetBrightness()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &pb.Empty{}, nil
+}
+
+// layOut places lines on the display, and returns the result as a message
+// that Write would show the same way.
+func layOut(lines []*pb.WriteLinesRequest_Line) string {
+	var grid [Rows][Cols]rune
+	for r := range grid {
+		for c := range grid[r] {
+			grid[r][c] = ' '
+		}
+	}
+	for _, l := range lines {
+		c := int(l.GetColumn())
+		for _, ch := range l.GetText() {
+			if c >= Cols {
+				break
+			}
+			grid[l.GetRow()][c] = ch
+			c++
+		}
+	}
+	rows := make([]string, Rows)
+	for r := range grid {
+		rows[r] = strings.TrimRight(string(grid[r][:]), " ")
+	}
+	return strings.TrimRight(strings.Join(rows, "\n"), "\n")
+}
+
+// checkColor returns an InvalidArgument error unless every component of c is
+// between 0 and 1.
+func checkColor(c *pb.Color) error {
+	for _, v := range []struct {
+		name  string
+		value float64
+	}{{"red", c.GetRed()}, {"green", c.GetGreen()}, {"blue", c.GetBlue()}} {
+		if err := checkFraction(v.name+" color", v.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyColor returns a copy of c, which is black if c is nil.
+func copyColor(c *pb.Color) *pb.Color {
+	return &pb.Color{Red: c.GetRed(), Green: c.GetGreen(), Blue: c.GetBlue()}
+}
+
+// checkFraction returns an InvalidArgument error unless v is a number between
+// 0 and 1, like the checks of the Python fake display.
+func checkFraction(name string, v float64) error {
+	if math.IsNaN(v) || v < 0 || v > 1 {
+		return grpc.Errorf(codes.InvalidArgument, "%s must be a decimal between 0.0 and 1.0, got %v", name, v)
+	}
+	return nil
+}
+
+// update changes the state with f and shows the change on every sink.
+func (s *Server) update(method string, f func(st *State)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f(&s.state)
+	e := Event{Time: timeNow(), Method: method, State: s.state}
+
+	var errs []string
+	for _, sink := range s.sinks {
+		if err := sink.Show(e); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return grpc.Errorf(codes.Internal, "Error showing %s: %s", method, strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// cssColor formats c as a CSS hex color, such as "#ff0000".
+func cssColor(c *pb.Color) string {
+	r, g, b := rgb(c, 1)
+	return fmt.Sprintf("#%02x%02x%02x", r, g, b)
+}
+
+// rgb returns the components of c at the given brightness, from 0 to 255.
+func rgb(c *pb.Color, brightness float64) (r, g, b int) {
+	component := func(v float64) int {
+		return int(math.Round(math.Max(0, math.Min(1, v*brightness)) * 255))
+	}
+	return component(c.GetRed()), component(c.GetGreen()), component(c.GetBlue())
+}
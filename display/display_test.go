@@ -0,0 +1,354 @@
+package display
+
+import (
+	"context"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	pb "github.com/wallaceicy06/muni-sign/proto"
+)
+
+var testTime = time.Date(2017, time.June, 1, 8, 30, 0, 0, time.UTC)
+
+func init() {
+	timeNow = func() time.Time { return testTime }
+}
+
+// A bus, as defined in the HD44780's CGRAM.
+var testGlyph = &pb.Glyph{Rows: []uint32{0x0e, 0x1f, 0x11, 0x11, 0x1f, 0x1f, 0x0a, 0x00}}
+
+type failingSink struct{}
+
+func (failingSink) Show(e Event) error {
+	return errors.New("sink is broken")
+}
+
+func TestServerValidation(t *testing.T) {
+	tests := []struct {
+		name     string
+		call     func(s *Server) error
+		wantCode codes.Code
+	}{
+		{
+			name: "Write",
+			call: func(s *Server) error {
+				_, err := s.Write(context.Background(), &pb.WriteRequest{Message: "N-Caltrain\n2 mins", Color: &pb.Color{Red: 1.0}})
+				return err
+			},
+			wantCode: codes.OK,
+		},
+		{
+			name: "WriteWithoutColor",
+			call: func(s *Server) error {
+				_, err := s.Write(context.Background(), &pb.WriteRequest{Message: "N-Caltrain"})
+				return err
+			},
+			wantCode: codes.OK,
+		},
+		{
+			name: "WriteColorOutOfRange",
+			call: func(s *Server) error {
+				_, err := s.Write(context.Background(), &pb.WriteRequest{Message: "N-Caltrain", Color: &pb.Color{Green: 1.5}})
+				return err
+			},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name: "WriteColorNaN",
+			call: func(s *Server) error {
+				_, err := s.Write(context.Background(), &pb.WriteRequest{Message: "N-Caltrain", Color: &pb.Color{Blue: math.NaN()}})
+				return err
+			},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name: "WriteInvalidUTF8",
+			call: func(s *Server) error {
+				_, err := s.Write(context.Background(), &pb.WriteRequest{Message: "N-Caltrain\xff"})
+				return err
+			},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name: "WriteLines",
+			call: func(s *Server) error {
+				_, err := s.WriteLines(context.Background(), &pb.WriteLinesRequest{
+					Lines: []*pb.WriteLinesRequest_Line{{Text: "N-Caltrain"}, {Text: "2 mins", Row: 1, Column: 10}},
+					Color: &pb.Color{Red: 1.0},
+				})
+				return err
+			},
+			wantCode: codes.OK,
+		},
+		{
+			name: "WriteLinesRowOutOfRange",
+			call: func(s *Server) error {
+				_, err := s.WriteLines(context.Background(), &pb.WriteLinesRequest{
+					Lines: []*pb.WriteLinesRequest_Line{{Text: "N-Caltrain", Row: 2}},
+				})
+				return err
+			},
+			wantCode: codes.OutOfRange,
+		},
+		{
+			name: "WriteLinesColumnOutOfRange",
+			call: func(s *Server) error {
+				_, err := s.WriteLines(context.Background(), &pb.WriteLinesRequest{
+					Lines: []*pb.WriteLinesRequest_Line{{Text: "N-Caltrain", Column: -1}},
+				})
+				return err
+			},
+			wantCode: codes.OutOfRange,
+		},
+		{
+			name: "WriteLinesColorOutOfRange",
+			call: func(s *Server) error {
+				_, err := s.WriteLines(context.Background(), &pb.WriteLinesRequest{
+					Lines: []*pb.WriteLinesRequest_Line{{Text: "N-Caltrain"}},
+					Color: &pb.Color{Red: 2},
+				})
+				return err
+			},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name: "Clear",
+			call: func(s *Server) error {
+				_, err := s.Clear(context.Background(), &pb.ClearRequest{})
+				return err
+			},
+			wantCode: codes.OK,
+		},
+		{
+			name: "DefineGlyph",
+			call: func(s *Server) error {
+				_, err := s.DefineGlyph(context.Background(), &pb.DefineGlyphRequest{Slot: 7, Glyph: testGlyph})
+				return err
+			},
+			wantCode: codes.OK,
+		},
+		{
+			name: "DefineGlyphSlotOutOfRange",
+			call: func(s *Server) error {
+				_, err := s.DefineGlyph(context.Background(), &pb.DefineGlyphRequest{Slot: 8, Glyph: testGlyph})
+				return err
+			},
+			wantCode: codes.OutOfRange,
+		},
+		{
+			name: "DefineGlyphTooFewRows",
+			call: func(s *Server) error {
+				_, err := s.DefineGlyph(context.Background(), &pb.DefineGlyphRequest{Glyph: &pb.Glyph{Rows: []uint32{0x1f}}})
+				return err
+			},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name: "DefineGlyphTooWide",
+			call: func(s *Server) error {
+				_, err := s.DefineGlyph(context.Background(), &pb.DefineGlyphRequest{Glyph: &pb.Glyph{Rows: []uint32{0x20, 0, 0, 0, 0, 0, 0, 0}}})
+				return err
+			},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name: "SetBrightness",
+			call: func(s *Server) error {
+				_, err := s.SetBrightness(context.Background(), &pb.SetBrightnessRequest{Brightness: 0.2})
+				return err
+			},
+			wantCode: codes.OK,
+		},
+		{
+			name: "SetBrightnessOutOfRange",
+			call: func(s *Server) error {
+				_, err := s.SetBrightness(context.Background(), &pb.SetBrightnessRequest{Brightness: -0.5})
+				return err
+			},
+			wantCode: codes.InvalidArgument,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ring := NewRing(10)
+			err := test.call(NewServer(ring))
+			if got := grpc.Code(err); got != test.wantCode {
+				t.Errorf("got code %v want %v", got, test.wantCode)
+			}
+			// Requests that are rejected never reach the sinks.
+			if got, want := len(ring.Events()) > 0, err == nil; got != want {
+				t.Errorf("got sink shown a change %t want %t", got, want)
+			}
+		})
+	}
+}
+
+func TestServerState(t *testing.T) {
+	ring := NewRing(10)
+	s := NewServer(ring)
+	if _, err := s.Write(context.Background(), &pb.WriteRequest{Message: "N-Caltrain\n2 mins", Color: &pb.Color{Red: 1.0}}); err != nil {
+		t.Fatalf("Write() = %v want <nil>", err)
+	}
+	if _, err := s.SetBrightness(context.Background(), &pb.SetBrightnessRequest{Brightness: 0.2}); err != nil {
+		t.Fatalf("SetBrightness() = %v want <nil>", err)
+	}
+
+	if _, err := s.Clear(context.Background(), &pb.ClearRequest{}); err != nil {
+		t.Fatalf("Clear() = %v want <nil>", err)
+	}
+
+	// Clearing the display leaves the backlight as it is.
+	want := State{Message: "", Color: &pb.Color{Red: 1.0}, Brightness: 0.2}
+	if got := s.State(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got state %+v want %+v", got, want)
+	}
+	wantEvents := []Event{
+		{Time: testTime, Method: "Write", State: State{Message: "N-Caltrain\n2 mins", Color: &pb.Color{Red: 1.0}, Brightness: 1}},
+		{Time: testTime, Method: "SetBrightness", State: State{Message: "N-Caltrain\n2 mins", Color: &pb.Color{Red: 1.0}, Brightness: 0.2}},
+		{Time: testTime, Method: "Clear", State: want},
+	}
+	if got := ring.Events(); !reflect.DeepEqual(got, wantEvents) {
+		t.Errorf("got events %+v want %+v", got, wantEvents)
+	}
+}
+
+func TestServerSinkError(t *testing.T) {
+	ring := NewRing(10)
+	s := NewServer(failingSink{}, ring)
+	_, err := s.Write(context.Background(), &pb.WriteRequest{Message: "N-Caltrain"})
+	if got, want := grpc.Code(err), codes.Internal; got != want {
+		t.Errorf("got code %v want %v", got, want)
+	}
+	// The other sinks are still shown the change.
+	if got, want := ring.Messages(), []string{"N-Caltrain"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got messages %q want %q", got, want)
+	}
+}
+
+func TestDefineGlyph(t *testing.T) {
+	ring := NewRing(10)
+	s := NewServer(ring)
+	if _, err := s.DefineGlyph(context.Background(), &pb.DefineGlyphRequest{Slot: 2, Glyph: testGlyph}); err != nil {
+		t.Fatalf("DefineGlyph() = %v want <nil>", err)
+	}
+	arrow := &pb.Glyph{Rows: []uint32{0x00, 0x04, 0x02, 0x1f, 0x02, 0x04, 0x00, 0x00}}
+	if _, err := s.DefineGlyph(context.Background(), &pb.DefineGlyphRequest{Slot: 5, Glyph: arrow}); err != nil {
+		t.Fatalf("DefineGlyph() = %v want <nil>", err)
+	}
+
+	want := make([]*pb.Glyph, GlyphSlots)
+	want[2], want[5] = testGlyph, arrow
+	if got := s.State().Glyphs; !reflect.DeepEqual(got, want) {
+		t.Errorf("got glyphs %v want %v", got, want)
+	}
+	// Earlier events keep the glyphs that they were shown with.
+	events := ring.Events()
+	if got := events[0].State.Glyphs[5]; got != nil {
+		t.Errorf("got glyph %v in slot 5 of the first event want <nil>", got)
+	}
+}
+
+func TestWriteLines(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []*pb.WriteLinesRequest_Line
+		want  string
+	}{
+		{
+			name:  "Empty",
+			lines: nil,
+			want:  "",
+		},
+		{
+			name:  "TwoRows",
+			lines: []*pb.WriteLinesRequest_Line{{Text: "N-Caltrain"}, {Text: "2 mins", Row: 1}},
+			want:  "N-Caltrain\n2 mins",
+		},
+		{
+			name:  "SecondRowOnly",
+			lines: []*pb.WriteLinesRequest_Line{{Text: "2 mins", Row: 1}},
+			want:  "\n2 mins",
+		},
+		{
+			name:  "Column",
+			lines: []*pb.WriteLinesRequest_Line{{Text: "N-Caltrain"}, {Text: "2 mins", Row: 1, Column: 10}},
+			want:  "N-Caltrain\n          2 mins",
+		},
+		{
+			name:  "PastLastColumn",
+			lines: []*pb.WriteLinesRequest_Line{{Text: "2, 14 mins", Column: 10}},
+			want:  "          2, 14",
+		},
+		{
+			name:  "Overlapping",
+			lines: []*pb.WriteLinesRequest_Line{{Text: "N-Caltrain"}, {Text: "Judah", Column: 2}},
+			want:  "N-Judahain",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := NewServer()
+			if _, err := s.WriteLines(context.Background(), &pb.WriteLinesRequest{Lines: test.lines}); err != nil {
+				t.Fatalf("WriteLines() = %v want <nil>", err)
+			}
+			if got := s.State().Message; got != test.want {
+				t.Errorf("got message %q want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestStateLines(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		want    []string
+	}{
+		{
+			name:    "Blank",
+			message: "",
+			want:    []string{"", ""},
+		},
+		{
+			name:    "OneLine",
+			message: "N-Caltrain",
+			want:    []string{"N-Caltrain", ""},
+		},
+		{
+			name:    "TwoLines",
+			message: "N-Caltrain\n2, 14 mins",
+			want:    []string{"N-Caltrain", "2, 14 mins"},
+		},
+		{
+			name:    "TooLong",
+			message: "N-Judah Outbound\n2, 14, 26, 38 mins",
+			want:    []string{"N-Judah Outbound", "2, 14, 26, 38 mi"},
+		},
+		{
+			name:    "TooManyLines",
+			message: "N-Caltrain\n2 mins\nJ-Church",
+			want:    []string{"N-Caltrain", "2 mins"},
+		},
+		{
+			name:    "Unicode",
+			message: "Café → Église ñññ",
+			want:    []string{"Café → Église ññ", ""},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := (State{Message: test.message}).Lines(); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got lines %q want %q", got, test.want)
+			}
+		})
+	}
+}
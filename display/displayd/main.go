@@ -0,0 +1,68 @@
+// Command displayd serves an emulated display over gRPC, so that the driver
+// can be run without a sign. What the driver writes is drawn on the terminal,
+// recorded to a file or shown on a web page.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+
+	"google.golang.org/grpc"
+
+	"github.com/wallaceicy06/muni-sign/display"
+	pb "github.com/wallaceicy06/muni-sign/proto"
+)
+
+var port = flag.Int("port", 50051, "the port to serve the DisplayDriver gRPC service on")
+var terminal = flag.Bool("terminal", true, "whether to draw the display on the terminal")
+var clearScreen = flag.Bool("clear", false, "whether to clear the terminal before drawing the display, instead of scrolling")
+var recordPath = flag.String("record", "", "the path of a file to record every change to the display to as JSON lines, or empty to not record")
+var webPort = flag.Int("web_port", 0, "the port to serve a web page showing the display on, or 0 to not serve it")
+
+func main() {
+	flag.Parse()
+
+	var sinks []display.Sink
+	if *terminal {
+		sinks = append(sinks, display.NewTerminal(os.Stdout, *clearScreen))
+	}
+	if *recordPath != "" {
+		f, err := os.OpenFile(*recordPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening recording: %v\n", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		sinks = append(sinks, display.NewRecorder(f))
+	}
+	if *webPort != 0 {
+		web := display.NewWeb()
+		sinks = append(sinks, web)
+		go func() {
+			log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", *webPort), web))
+		}()
+	}
+
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", *port))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error serving: %v\n", err)
+		os.Exit(1)
+	}
+	grpcSrv := grpc.NewServer()
+	pb.RegisterDisplayDriverServer(grpcSrv, display.NewServer(sinks...))
+	go func() {
+		if err := grpcSrv.Serve(lis); err != nil {
+			log.Printf("grpc server stopped: %v", err)
+		}
+	}()
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt)
+	<-sigs
+	grpcSrv.GracefulStop()
+}
@@ -7,11 +7,16 @@ import grpc
 from proto import muni_sign_pb2
 
 _ONE_DAY_IN_SECONDS = 60 * 60 * 24
+_ROWS = 2
+_COLS = 16
+_GLYPH_SLOTS = 8
 
 class FakeLCD(object):
     def __init__(self):
         self.text = ""
         self.color = {'red': 0.0, 'green': 0.0, 'blue': 0.0}
+        self.brightness = 1.0
+        self.glyphs = [None] * _GLYPH_SLOTS
 
     def clear(self):
         self.text = ""
@@ -29,6 +34,34 @@ class FakeLCD(object):
         self.color = {'red': red, 'green': green, 'blue': blue}
         print 'Set color to %s.' % self.color
 
+    def set_brightness(self, brightness):
+        assert type(brightness) is FloatType, 'brightness is not a decimal value: %r' % brightness
+        assert brightness >= 0.0 and brightness <= 1.0, 'brightness must be a decimal between 0.0 and 1.0, got %f' % brightness
+
+        self.brightness = brightness
+        print 'Set brightness to %s.' % self.brightness
+
+    def create_char(self, location, pattern):
+        assert location >= 0 and location < _GLYPH_SLOTS, 'slot must be between 0 and %d, got %d' % (_GLYPH_SLOTS - 1, location)
+        assert len(pattern) == 8, 'glyph must have 8 rows, got %d' % len(pattern)
+        for row in pattern:
+            assert row >= 0 and row < 1 << 5, 'glyph row must be 5 pixels wide, got %#x' % row
+
+        self.glyphs[location] = list(pattern)
+        print 'Set glyph %d to\n%s' % (location, '\n'.join(format(row, '05b') for row in pattern))
+
+    def write_lines(self, lines):
+        grid = [[' '] * _COLS for _ in range(_ROWS)]
+        for line in lines:
+            assert isinstance(line.text, StringTypes), 'line must be a string: %r' % line.text
+            assert line.row >= 0 and line.row < _ROWS, 'row must be between 0 and %d, got %d' % (_ROWS - 1, line.row)
+            assert line.column >= 0 and line.column < _COLS, 'column must be between 0 and %d, got %d' % (_COLS - 1, line.column)
+
+            text = line.text[:_COLS - line.column]
+            grid[line.row][line.column:line.column + len(text)] = list(text)
+
+        self.message('\n'.join(''.join(row).rstrip() for row in grid).rstrip('\n'))
+
     def message(self, msg): 
         assert isinstance(msg, StringTypes), 'message must be a string: %r' % msg
 
@@ -55,6 +88,33 @@ class DisplayDriver(muni_sign_pb2.DisplayDriverServicer):
         self.lcd.message(request.message)
         return muni_sign_pb2.Empty()
 
+    def SetBrightness(self, request, context):
+        self.lcd.set_brightness(request.brightness)
+        return muni_sign_pb2.Empty()
+
+    def GetCapabilities(self, request, context):
+        return muni_sign_pb2.Capabilities(
+            rows=_ROWS,
+            cols=_COLS,
+            charset=muni_sign_pb2.Capabilities.HD44780_A00,
+            color_support=muni_sign_pb2.Capabilities.RGB,
+            glyph_slots=_GLYPH_SLOTS)
+
+    def Clear(self, request, context):
+        self.lcd.clear()
+        self.lcd.message('')
+        return muni_sign_pb2.Empty()
+
+    def DefineGlyph(self, request, context):
+        self.lcd.create_char(request.slot, request.glyph.rows)
+        return muni_sign_pb2.Empty()
+
+    def WriteLines(self, request, context):
+        self.lcd.clear()
+        self.lcd.set_color(request.color.red, request.color.green, request.color.blue)
+        self.lcd.write_lines(request.lines)
+        return muni_sign_pb2.Empty()
+
 def serve():
     lcd = FakeLCD()
 
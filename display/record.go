@@ -0,0 +1,25 @@
+package display
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// Recorder writes every change to the display as a line of JSON, so that a
+// run of the driver can be examined or compared with another afterwards.
+type Recorder struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewRecorder returns a sink that records every change to the display to w.
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{enc: json.NewEncoder(w)}
+}
+
+func (r *Recorder) Show(e Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.enc.Encode(e)
+}
@@ -0,0 +1,39 @@
+package display
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	pb "github.com/wallaceicy06/muni-sign/proto"
+)
+
+func TestRecorder(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewRecorder(&buf)
+	events := []Event{
+		{Time: testTime, Method: "Write", State: State{Message: "N-Caltrain", Color: &pb.Color{Red: 1.0}, Brightness: 1}},
+		{Time: testTime, Method: "SetBrightness", State: State{Message: "N-Caltrain", Color: &pb.Color{Red: 1.0}, Brightness: 0.2}},
+	}
+	for _, e := range events {
+		if err := r.Show(e); err != nil {
+			t.Fatalf("Show() = %v want <nil>", err)
+		}
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != len(events) {
+		t.Fatalf("got %d lines want %d: %q", len(lines), len(events), buf.String())
+	}
+	for i, line := range lines {
+		var got Event
+		if err := json.Unmarshal([]byte(line), &got); err != nil {
+			t.Fatalf("error unmarshaling line %d: %v", i, err)
+		}
+		if !reflect.DeepEqual(got, events[i]) {
+			t.Errorf("got event %+v on line %d want %+v", got, i, events[i])
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package display
+
+import "sync"
+
+// Ring keeps the latest changes to the display in memory, for tests. It is
+// safe for concurrent use.
+type Ring struct {
+	mu     sync.Mutex
+	events []Event
+	// The index of the oldest event, once the ring is full.
+	start int
+}
+
+// NewRing returns a sink that keeps the last n changes to the display.
+func NewRing(n int) *Ring {
+	return &Ring{events: make([]Event, 0, n)}
+}
+
+func (r *Ring) Show(e Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.events) < cap(r.events) {
+		r.events = append(r.events, e)
+		return nil
+	}
+	if len(r.events) > 0 {
+		r.events[r.start] = e
+		r.start = (r.start + 1) % len(r.events)
+	}
+	return nil
+}
+
+// Events returns the changes kept by the ring, oldest first.
+func (r *Ring) Events() []Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	events := make([]Event, 0, len(r.events))
+	events = append(events, r.events[r.start:]...)
+	return append(events, r.events[:r.start]...)
+}
+
+// Messages returns the messages of the changes kept by the ring, oldest
+// first.
+func (r *Ring) Messages() []string {
+	var msgs []string
+	for _, e := range r.Events() {
+		msgs = append(msgs, e.State.Message)
+	}
+	return msgs
+}
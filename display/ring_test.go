@@ -0,0 +1,60 @@
+package display
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRing(t *testing.T) {
+	tests := []struct {
+		name     string
+		size     int
+		messages []string
+		want     []string
+	}{
+		{
+			name:     "Empty",
+			size:     3,
+			messages: nil,
+			want:     nil,
+		},
+		{
+			name:     "NotFull",
+			size:     3,
+			messages: []string{"a", "b"},
+			want:     []string{"a", "b"},
+		},
+		{
+			name:     "Full",
+			size:     3,
+			messages: []string{"a", "b", "c"},
+			want:     []string{"a", "b", "c"},
+		},
+		{
+			name:     "Wraps",
+			size:     3,
+			messages: []string{"a", "b", "c", "d", "e"},
+			want:     []string{"c", "d", "e"},
+		},
+		{
+			name:     "ZeroSize",
+			size:     0,
+			messages: []string{"a", "b"},
+			want:     nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := NewRing(test.size)
+			for _, msg := range test.messages {
+				if err := r.Show(Event{State: State{Message: msg}}); err != nil {
+					t.Fatalf("Show() = %v want <nil>", err)
+				}
+			}
+			if got := r.Messages(); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got messages %q want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package display
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// Terminal draws the display on a terminal that supports 24-bit color, as
+// text on the color of the backlight. Custom characters are drawn as the
+// circled number of their slot, and the pixels of those in the message are
+// listed below the display.
+type Terminal struct {
+	w io.Writer
+	// Whether to clear the screen before drawing, so that the display stays
+	// in place.
+	clear bool
+}
+
+// NewTerminal returns a sink that draws every change to the display on w. If
+// clear is set, the screen is cleared first, otherwise the drawings scroll
+// by.
+func NewTerminal(w io.Writer, clear bool) *Terminal {
+	return &Terminal{w: w, clear: clear}
+}
+
+func (t *Terminal) Show(e Event) error {
+	var buf bytes.Buffer
+	if t.clear {
+		buf.WriteString("\x1b[H\x1b[2J")
+	}
+	r, g, b := rgb(e.State.Color, e.State.Brightness)
+	// Dark text on the backlight, like a positive LCD.
+	cell := fmt.Sprintf("\x1b[48;2;%d;%d;%dm\x1b[38;2;16;16;16m", r, g, b)
+	const reset = "\x1b[0m"
+
+	fmt.Fprintf(&buf, "%s %s\n", e.Time.Format("15:04:05"), e.Method)
+	fmt.Fprintf(&buf, "┌%s┐\n", strings.Repeat("─", Cols))
+	for _, line := range e.State.Lines() {
+		pad := strings.Repeat(" ", Cols-utf8.RuneCountInString(line))
+		fmt.Fprintf(&buf, "│%s%s%s%s│\n", cell, strings.Map(glyphMark, line), pad, reset)
+	}
+	fmt.Fprintf(&buf, "└%s┘\n", strings.Repeat("─", Cols))
+	for slot, g := range e.State.Glyphs {
+		if g == nil || !strings.ContainsRune(e.State.Message, rune(slot)) {
+			continue
+		}
+		fmt.Fprintf(&buf, "%c %d:", glyphMark(rune(slot)), slot)
+		for _, r := range g.GetRows() {
+			fmt.Fprintf(&buf, " %05b", r)
+		}
+		buf.WriteString("\n")
+	}
+
+	_, err := t.w.Write(buf.Bytes())
+	return err
+}
+
+// glyphMark returns the circled number drawn for the custom character in a
+// slot, or r itself if it is not one.
+func glyphMark(r rune) rune {
+	switch {
+	case r == 0:
+		return '⓪'
+	case r > 0 && r < GlyphSlots:
+		return '①' + r - 1
+	}
+	return r
+}
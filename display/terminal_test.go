@@ -0,0 +1,74 @@
+package display
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	pb "github.com/wallaceicy06/muni-sign/proto"
+)
+
+func TestTerminal(t *testing.T) {
+	tests := []struct {
+		name      string
+		clear     bool
+		wantClear bool
+	}{
+		{
+			name:      "Scroll",
+			clear:     false,
+			wantClear: false,
+		},
+		{
+			name:      "Clear",
+			clear:     true,
+			wantClear: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			e := Event{Time: testTime, Method: "Write", State: State{Message: "N-Caltrain\n2 mins", Color: &pb.Color{Red: 1.0}, Brightness: 0.5}}
+			if err := NewTerminal(&buf, test.clear).Show(e); err != nil {
+				t.Fatalf("Show() = %v want <nil>", err)
+			}
+			out := buf.String()
+			if got := strings.HasPrefix(out, "\x1b[H\x1b[2J"); got != test.wantClear {
+				t.Errorf("got screen cleared %t want %t", got, test.wantClear)
+			}
+			for _, want := range []string{
+				"08:30:00 Write",
+				// The backlight at half brightness.
+				"\x1b[48;2;128;0;0m",
+				"N-Caltrain      ",
+				"2 mins          ",
+			} {
+				if !strings.Contains(out, want) {
+					t.Errorf("output %q does not contain %q", out, want)
+				}
+			}
+		})
+	}
+}
+
+func TestTerminalGlyphs(t *testing.T) {
+	var buf bytes.Buffer
+	glyphs := make([]*pb.Glyph, GlyphSlots)
+	glyphs[0] = &pb.Glyph{Rows: []uint32{0x0e, 0x1f, 0x11, 0x11, 0x1f, 0x1f, 0x0a, 0x00}}
+	glyphs[3] = &pb.Glyph{Rows: []uint32{0x00, 0x04, 0x02, 0x1f, 0x02, 0x04, 0x00, 0x00}}
+	e := Event{Time: testTime, Method: "Write", State: State{Message: "\x00 38-Geary", Color: &pb.Color{Red: 1.0}, Brightness: 1, Glyphs: glyphs}}
+	if err := NewTerminal(&buf, false).Show(e); err != nil {
+		t.Fatalf("Show() = %v want <nil>", err)
+	}
+	out := buf.String()
+	for _, want := range []string{"⓪ 38-Geary", "⓪ 0: 01110 11111 10001 10001 11111 11111 01010 00000"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output %q does not contain %q", out, want)
+		}
+	}
+	// Only the glyphs in the message are listed.
+	if strings.Contains(out, "③") {
+		t.Errorf("output %q lists a glyph that is not in the message", out)
+	}
+}
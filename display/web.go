@@ -0,0 +1,172 @@
+package display
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	pb "github.com/wallaceicy06/muni-sign/proto"
+)
+
+// How often an idle event stream sends a comment to keep intermediate proxies
+// from closing the connection.
+const webKeepAlive = 30 * time.Second
+
+// The page and script that draw the display in a browser.
+//
+//go:embed web
+var webAssets embed.FS
+
+// webState is what the display shows, as sent to web pages.
+type webState struct {
+	Message string `json:"message"`
+	// The backlight color, such as "#ff0000".
+	Color      string    `json:"color"`
+	Brightness float64   `json:"brightness"`
+	UpdateTime time.Time `json:"update_time"`
+	// The rows of pixels of the custom character in each slot, or null for
+	// slots that are not defined.
+	Glyphs [][]uint32 `json:"glyphs"`
+}
+
+// Web draws the display in web browsers, which are sent every change as it
+// happens. It is an http.Handler that serves a page with the display at /,
+// the script that draws it at /lcd.js and the changes to the display as
+// Server-Sent Events at /events. It is safe for concurrent use.
+type Web struct {
+	mu    sync.Mutex
+	state webState
+	subs  map[chan webState]bool
+}
+
+// NewWeb returns a sink that shows a blank display until the first change.
+func NewWeb() *Web {
+	return &Web{
+		state: webState{Color: cssColor(&pb.Color{}), Brightness: 1, UpdateTime: timeNow(), Glyphs: make([][]uint32, GlyphSlots)},
+		subs:  make(map[chan webState]bool),
+	}
+}
+
+func (w *Web) Show(e Event) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.state = webState{
+		Message:    e.State.Message,
+		Color:      cssColor(e.State.Color),
+		Brightness: e.State.Brightness,
+		UpdateTime: e.Time,
+		Glyphs:     make([][]uint32, GlyphSlots),
+	}
+	for slot, g := range e.State.Glyphs {
+		w.state.Glyphs[slot] = g.GetRows()
+	}
+	// Watchers that fall behind only receive the most recent state.
+	for ch := range w.subs {
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- w.state
+	}
+	return nil
+}
+
+func (w *Web) watch() (webState, <-chan webState, func()) {
+	ch := make(chan webState, 1)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.subs[ch] = true
+
+	var once sync.Once
+	return w.state, ch, func() {
+		once.Do(func() {
+			w.mu.Lock()
+			defer w.mu.Unlock()
+			delete(w.subs, ch)
+			close(ch)
+		})
+	}
+}
+
+func (w *Web) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(rw, fmt.Sprintf("Unsupported method: %s.", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+	switch r.URL.Path {
+	case "", "/":
+		serveAsset(rw, "web/index.html", "text/html; charset=utf-8")
+	case "/lcd.js":
+		serveAsset(rw, "web/lcd.js", "application/javascript")
+	case "/events":
+		w.serveEvents(rw, r)
+	default:
+		http.NotFound(rw, r)
+	}
+}
+
+func serveAsset(rw http.ResponseWriter, name, contentType string) {
+	data, err := webAssets.ReadFile(name)
+	if err != nil {
+		http.Error(rw, fmt.Sprintf("Internal error: %v", err), http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", contentType)
+	rw.Write(data)
+}
+
+// serveEvents streams what the display shows: the current state first,
+// followed by every change.
+func (w *Web) serveEvents(rw http.ResponseWriter, r *http.Request) {
+	flusher, ok := rw.(http.Flusher)
+	if !ok {
+		http.Error(rw, "Internal error: streaming is not supported.", http.StatusInternalServerError)
+		return
+	}
+
+	current, updates, cancel := w.watch()
+	defer cancel()
+
+	rw.Header().Set("Content-Type", "text/event-stream")
+	rw.Header().Set("Cache-Control", "no-cache")
+	if err := writeWebEvent(rw, current); err != nil {
+		log.Printf("Error writing display event: %v", err)
+		return
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(webKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case st, ok := <-updates:
+			if !ok {
+				return
+			}
+			if err := writeWebEvent(rw, st); err != nil {
+				log.Printf("Error writing display event: %v", err)
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(rw, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+func writeWebEvent(rw http.ResponseWriter, st webState) error {
+	data, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(rw, "event: display\ndata: %s\n\n", data)
+	return err
+}
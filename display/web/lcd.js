@@ -0,0 +1,194 @@
+// Draws a 16x2 HD44780 character LCD with an RGB backlight on a canvas, the
+// way the sign's display shows a message. Served by the web sink of the display
+// package.
+var LCD = (function() {
+  'use strict';
+
+  var COLS = 16;
+  var ROWS = 2;
+  // Each character is a 5x8 grid of pixels, the last row being reserved for
+  // the cursor.
+  var CHAR_WIDTH = 5;
+  var CHAR_HEIGHT = 8;
+  // The size of a pixel and the gaps between pixels and characters, in canvas
+  // pixels.
+  var PIXEL = 4;
+  var PIXEL_GAP = 1;
+  var CHAR_GAP = 4;
+  var MARGIN = 16;
+
+  // The glyphs of the HD44780 A00 character ROM from 0x20 to 0x7f, as five
+  // columns of seven rows each, the top row being the lowest bit. Like the
+  // real ROM, 0x5c is a yen sign and 0x7e and 0x7f are arrows.
+  var FONT = [
+    [0x00, 0x00, 0x00, 0x00, 0x00], [0x00, 0x00, 0x5f, 0x00, 0x00],
+    [0x00, 0x07, 0x00, 0x07, 0x00], [0x14, 0x7f, 0x14, 0x7f, 0x14],
+    [0x24, 0x2a, 0x7f, 0x2a, 0x12], [0x23, 0x13, 0x08, 0x64, 0x62],
+    [0x36, 0x49, 0x55, 0x22, 0x50], [0x00, 0x05, 0x03, 0x00, 0x00],
+    [0x00, 0x1c, 0x22, 0x41, 0x00], [0x00, 0x41, 0x22, 0x1c, 0x00],
+    [0x08, 0x2a, 0x1c, 0x2a, 0x08], [0x08, 0x08, 0x3e, 0x08, 0x08],
+    [0x00, 0x50, 0x30, 0x00, 0x00], [0x08, 0x08, 0x08, 0x08, 0x08],
+    [0x00, 0x60, 0x60, 0x00, 0x00], [0x20, 0x10, 0x08, 0x04, 0x02],
+    [0x3e, 0x51, 0x49, 0x45, 0x3e], [0x00, 0x42, 0x7f, 0x40, 0x00],
+    [0x42, 0x61, 0x51, 0x49, 0x46], [0x21, 0x41, 0x45, 0x4b, 0x31],
+    [0x18, 0x14, 0x12, 0x7f, 0x10], [0x27, 0x45, 0x45, 0x45, 0x39],
+    [0x3c, 0x4a, 0x49, 0x49, 0x30], [0x01, 0x71, 0x09, 0x05, 0x03],
+    [0x36, 0x49, 0x49, 0x49, 0x36], [0x06, 0x49, 0x49, 0x29, 0x1e],
+    [0x00, 0x36, 0x36, 0x00, 0x00], [0x00, 0x56, 0x36, 0x00, 0x00],
+    [0x08, 0x14, 0x22, 0x41, 0x00], [0x14, 0x14, 0x14, 0x14, 0x14],
+    [0x00, 0x41, 0x22, 0x14, 0x08], [0x02, 0x01, 0x51, 0x09, 0x06],
+    [0x32, 0x49, 0x79, 0x41, 0x3e], [0x7e, 0x11, 0x11, 0x11, 0x7e],
+    [0x7f, 0x49, 0x49, 0x49, 0x36], [0x3e, 0x41, 0x41, 0x41, 0x22],
+    [0x7f, 0x41, 0x41, 0x22, 0x1c], [0x7f, 0x49, 0x49, 0x49, 0x41],
+    [0x7f, 0x09, 0x09, 0x09, 0x01], [0x3e, 0x41, 0x49, 0x49, 0x7a],
+    [0x7f, 0x08, 0x08, 0x08, 0x7f], [0x00, 0x41, 0x7f, 0x41, 0x00],
+    [0x20, 0x40, 0x41, 0x3f, 0x01], [0x7f, 0x08, 0x14, 0x22, 0x41],
+    [0x7f, 0x40, 0x40, 0x40, 0x40], [0x7f, 0x02, 0x0c, 0x02, 0x7f],
+    [0x7f, 0x04, 0x08, 0x10, 0x7f], [0x3e, 0x41, 0x41, 0x41, 0x3e],
+    [0x7f, 0x09, 0x09, 0x09, 0x06], [0x3e, 0x41, 0x51, 0x21, 0x5e],
+    [0x7f, 0x09, 0x19, 0x29, 0x46], [0x46, 0x49, 0x49, 0x49, 0x31],
+    [0x01, 0x01, 0x7f, 0x01, 0x01], [0x3f, 0x40, 0x40, 0x40, 0x3f],
+    [0x1f, 0x20, 0x40, 0x20, 0x1f], [0x3f, 0x40, 0x38, 0x40, 0x3f],
+    [0x63, 0x14, 0x08, 0x14, 0x63], [0x07, 0x08, 0x70, 0x08, 0x07],
+    [0x61, 0x51, 0x49, 0x45, 0x43], [0x00, 0x7f, 0x41, 0x41, 0x00],
+    [0x15, 0x16, 0x7c, 0x16, 0x15], [0x00, 0x41, 0x41, 0x7f, 0x00],
+    [0x04, 0x02, 0x01, 0x02, 0x04], [0x40, 0x40, 0x40, 0x40, 0x40],
+    [0x00, 0x01, 0x02, 0x04, 0x00], [0x20, 0x54, 0x54, 0x54, 0x78],
+    [0x7f, 0x48, 0x44, 0x44, 0x38], [0x38, 0x44, 0x44, 0x44, 0x20],
+    [0x38, 0x44, 0x44, 0x48, 0x7f], [0x38, 0x54, 0x54, 0x54, 0x18],
+    [0x08, 0x7e, 0x09, 0x01, 0x02], [0x0c, 0x52, 0x52, 0x52, 0x3e],
+    [0x7f, 0x08, 0x04, 0x04, 0x78], [0x00, 0x44, 0x7d, 0x40, 0x00],
+    [0x20, 0x40, 0x44, 0x3d, 0x00], [0x7f, 0x10, 0x28, 0x44, 0x00],
+    [0x00, 0x41, 0x7f, 0x40, 0x00], [0x7c, 0x04, 0x18, 0x04, 0x78],
+    [0x7c, 0x08, 0x04, 0x04, 0x78], [0x38, 0x44, 0x44, 0x44, 0x38],
+    [0x7c, 0x14, 0x14, 0x14, 0x08], [0x08, 0x14, 0x14, 0x18, 0x7c],
+    [0x7c, 0x08, 0x04, 0x04, 0x08], [0x48, 0x54, 0x54, 0x54, 0x20],
+    [0x04, 0x3f, 0x44, 0x40, 0x20], [0x3c, 0x40, 0x40, 0x20, 0x7c],
+    [0x1c, 0x20, 0x40, 0x20, 0x1c], [0x3c, 0x40, 0x30, 0x40, 0x3c],
+    [0x44, 0x28, 0x10, 0x28, 0x44], [0x0c, 0x50, 0x50, 0x50, 0x3c],
+    [0x44, 0x64, 0x54, 0x4c, 0x44], [0x00, 0x08, 0x36, 0x41, 0x00],
+    [0x00, 0x00, 0x7f, 0x00, 0x00], [0x00, 0x41, 0x36, 0x08, 0x00],
+    [0x08, 0x08, 0x2a, 0x1c, 0x08], [0x08, 0x1c, 0x2a, 0x08, 0x08]
+  ];
+
+  // Characters that the ROM has at other codes than in Unicode.
+  var ROM_CODES = {'¥': 0x5c, '→': 0x7e, '←': 0x7f};
+
+  // The glyph shown for characters that the ROM does not have.
+  var BLOCK = [0x7f, 0x7f, 0x7f, 0x7f, 0x7f];
+
+  // The number of custom characters, which are shown for the codes 0 to 7.
+  var GLYPH_SLOTS = 8;
+
+  // customGlyph converts the rows of pixels of a custom character, as defined
+  // in CGRAM, to columns like those of the FONT.
+  function customGlyph(rows) {
+    var cols = [0, 0, 0, 0, 0];
+    for (var y = 0; y < rows.length; y++) {
+      for (var x = 0; x < CHAR_WIDTH; x++) {
+        if ((rows[y] >> (CHAR_WIDTH - 1 - x)) & 1) {
+          cols[x] |= 1 << y;
+        }
+      }
+    }
+    return cols;
+  }
+
+  function glyph(ch, glyphs) {
+    var code = ROM_CODES.hasOwnProperty(ch) ? ROM_CODES[ch] : ch.charCodeAt(0);
+    if (code < GLYPH_SLOTS) {
+      // Slots that are not defined show random pixels on an HD44780, but
+      // blank is less distracting.
+      return glyphs && glyphs[code] ? customGlyph(glyphs[code]) : FONT[0];
+    }
+    if (code >= 0x20 && code < 0x20 + FONT.length) {
+      return FONT[code - 0x20];
+    }
+    return BLOCK;
+  }
+
+  // layout returns the characters in each row of the display after writing
+  // msg. Like the HD44780, a newline moves to the start of the next row, and
+  // characters past the last column are not visible.
+  function layout(msg) {
+    var rows = [];
+    var lines = msg.split('\n');
+    for (var r = 0; r < ROWS; r++) {
+      // Array.from splits by code point, so that characters outside of the
+      // Basic Multilingual Plane take a single cell.
+      var chars = Array.from(lines[r] || '').slice(0, COLS);
+      while (chars.length < COLS) {
+        chars.push(' ');
+      }
+      rows.push(chars);
+    }
+    return rows;
+  }
+
+  function parseColor(css) {
+    return [1, 3, 5].map(function(i) { return parseInt(css.substr(i, 2), 16); });
+  }
+
+  function rgb(c) {
+    return 'rgb(' + c.map(Math.round).join(',') + ')';
+  }
+
+  function LCD(canvas) {
+    this.canvas = canvas;
+    canvas.width = 2 * MARGIN + COLS * (CHAR_WIDTH * (PIXEL + PIXEL_GAP) + CHAR_GAP) - CHAR_GAP;
+    canvas.height = 2 * MARGIN + ROWS * (CHAR_HEIGHT * (PIXEL + PIXEL_GAP) + CHAR_GAP) - CHAR_GAP;
+  }
+
+  // draw shows msg on a backlight of the given CSS color and brightness,
+  // from 0 to 1. The optional glyphs are the rows of pixels of the custom
+  // character in each slot.
+  LCD.prototype.draw = function(msg, color, brightness, glyphs) {
+    var ctx = this.canvas.getContext('2d');
+    var backlight = parseColor(color).map(function(v) { return v * brightness; });
+    // Pixels that are off still show faintly against the backlight, and
+    // pixels that are on block it.
+    var off = backlight.map(function(v) { return v * 0.85; });
+    var on = backlight.map(function(v) { return v * 0.15 + 16; });
+
+    ctx.fillStyle = rgb(backlight);
+    ctx.fillRect(0, 0, this.canvas.width, this.canvas.height);
+
+    var rows = layout(msg);
+    for (var r = 0; r < ROWS; r++) {
+      for (var c = 0; c < COLS; c++) {
+        var g = glyph(rows[r][c], glyphs);
+        var x0 = MARGIN + c * (CHAR_WIDTH * (PIXEL + PIXEL_GAP) + CHAR_GAP);
+        var y0 = MARGIN + r * (CHAR_HEIGHT * (PIXEL + PIXEL_GAP) + CHAR_GAP);
+        for (var x = 0; x < CHAR_WIDTH; x++) {
+          for (var y = 0; y < CHAR_HEIGHT; y++) {
+            ctx.fillStyle = rgb((g[x] >> y) & 1 ? on : off);
+            ctx.fillRect(x0 + x * (PIXEL + PIXEL_GAP), y0 + y * (PIXEL + PIXEL_GAP), PIXEL, PIXEL);
+          }
+        }
+      }
+    }
+  };
+
+  // connect draws what the display shows on canvas as it changes, streamed
+  // from the events URL of a web sink, and describes the backlight in the
+  // status element.
+  LCD.connect = function(canvas, status, url) {
+    var lcd = new LCD(canvas);
+    lcd.draw('', '#000000', 1);
+    status.textContent = 'Connecting…';
+
+    var events = new EventSource(url);
+    events.addEventListener('display', function(e) {
+      var st = JSON.parse(e.data);
+      lcd.draw(st.message, st.color, st.brightness, st.glyphs);
+      status.textContent = 'Backlight ' + st.color + ' at ' + Math.round(st.brightness * 100) + '%, last changed ' +
+          new Date(st.update_time).toLocaleTimeString() + '.';
+    });
+    events.onerror = function() {
+      status.textContent = 'Disconnected, reconnecting…';
+    };
+    return lcd;
+  };
+
+  return LCD;
+})();
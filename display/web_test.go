@@ -0,0 +1,114 @@
+package display
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	pb "github.com/wallaceicy06/muni-sign/proto"
+)
+
+func TestWebAssets(t *testing.T) {
+	tests := []struct {
+		name            string
+		path            string
+		wantCode        int
+		wantContentType string
+	}{
+		{
+			name:            "Page",
+			path:            "/",
+			wantCode:        http.StatusOK,
+			wantContentType: "text/html; charset=utf-8",
+		},
+		{
+			name:            "Script",
+			path:            "/lcd.js",
+			wantCode:        http.StatusOK,
+			wantContentType: "application/javascript",
+		},
+		{
+			name:     "NotFound",
+			path:     "/index.html",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			NewWeb().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, test.path, nil))
+			if rec.Code != test.wantCode {
+				t.Fatalf("got code %d want %d", rec.Code, test.wantCode)
+			}
+			if test.wantContentType == "" {
+				return
+			}
+			if got := rec.Header().Get("Content-Type"); got != test.wantContentType {
+				t.Errorf("got Content-Type %s want %s", got, test.wantContentType)
+			}
+		})
+	}
+}
+
+func TestWebEvents(t *testing.T) {
+	web := NewWeb()
+	ts := httptest.NewServer(web)
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + "/events")
+	if err != nil {
+		t.Fatalf("error watching display: %v", err)
+	}
+	defer res.Body.Close()
+	if got, want := res.Header.Get("Content-Type"), "text/event-stream"; got != want {
+		t.Errorf("got Content-Type %s want %s", got, want)
+	}
+
+	scanner := bufio.NewScanner(res.Body)
+	next := func() webState {
+		var st webState
+		for scanner.Scan() {
+			if line := scanner.Text(); strings.HasPrefix(line, "data: ") {
+				if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &st); err != nil {
+					t.Fatalf("error unmarshaling event data: %v", err)
+				}
+				break
+			}
+		}
+		return st
+	}
+
+	// The blank display is sent first.
+	if st := next(); st.Message != "" || st.Color != "#000000" || st.Brightness != 1 {
+		t.Errorf("got initial state %+v want a blank display at full brightness", st)
+	}
+
+	s := NewServer(web)
+	if _, err := s.Write(context.Background(), &pb.WriteRequest{Message: "N-Caltrain\n2 mins", Color: &pb.Color{Red: 1.0}}); err != nil {
+		t.Fatalf("Write() = %v want <nil>", err)
+	}
+	if st := next(); st.Message != "N-Caltrain\n2 mins" || st.Color != "#ff0000" || !st.UpdateTime.Equal(testTime) {
+		t.Errorf("got state %+v after Write want the message in red", st)
+	}
+
+	if _, err := s.SetBrightness(context.Background(), &pb.SetBrightnessRequest{Brightness: 0.2}); err != nil {
+		t.Fatalf("SetBrightness() = %v want <nil>", err)
+	}
+	if st := next(); st.Message != "N-Caltrain\n2 mins" || st.Brightness != 0.2 {
+		t.Errorf("got state %+v after SetBrightness want the same message dimmed", st)
+	}
+
+	rows := []uint32{0x0e, 0x1f, 0x11, 0x11, 0x1f, 0x1f, 0x0a, 0x00}
+	if _, err := s.DefineGlyph(context.Background(), &pb.DefineGlyphRequest{Slot: 1, Glyph: &pb.Glyph{Rows: rows}}); err != nil {
+		t.Fatalf("DefineGlyph() = %v want <nil>", err)
+	}
+	if st := next(); len(st.Glyphs) != GlyphSlots || st.Glyphs[0] != nil || !reflect.DeepEqual(st.Glyphs[1], rows) {
+		t.Errorf("got glyphs %v after DefineGlyph want %v in slot 1", st.Glyphs, rows)
+	}
+}
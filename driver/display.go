@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	"github.com/wallaceicy06/muni-sign/glyph"
+	pb "github.com/wallaceicy06/muni-sign/proto"
+)
+
+var black = &pb.Color{}
+
+// What displays that do not implement GetCapabilities are able to show.
+var defaultCapabilities = &pb.Capabilities{
+	Rows:         2,
+	Cols:         16,
+	Charset:      pb.Capabilities_HD44780_A00,
+	ColorSupport: pb.Capabilities_RGB,
+}
+
+// display writes messages to the display server, dimming them during quiet
+// hours.
+type display struct {
+	client pb.DisplayDriverClient
+	status *statusReporter
+
+	// The brightness that was last set, or a negative number if it is not
+	// known.
+	brightness float64
+	// Set when the display server does not support SetBrightness, in which
+	// case the colors of messages are darkened instead.
+	noBacklight bool
+	// The color of every message while dimmed, or nil to keep their colors.
+	dimColor *pb.Color
+
+	// What the display is able to show, or nil until it is known.
+	caps *pb.Capabilities
+	// Set when the display server does not support WriteLines, in which
+	// case messages are written with Write.
+	noWriteLines bool
+	// Set when the display server does not support Clear, in which case an
+	// empty message is written instead.
+	noClear bool
+	// The icons defined in the display's glyph slots, or nil until the
+	// capabilities of the display are known.
+	slots *glyph.Slots
+	// Set when the display server does not support DefineGlyph, in which
+	// case icons are replaced by text.
+	noGlyphs bool
+}
+
+func newDisplay(client pb.DisplayDriverClient, status *statusReporter) *display {
+	return &display{client: client, status: status, brightness: -1}
+}
+
+// show writes a message to the display and records it in status. It reports
+// whether the message was written.
+func (d *display) show(msg string, color *pb.Color) bool {
+	if d.dimColor != nil {
+		color = d.dimColor
+	}
+	if d.noBacklight && d.brightness >= 0 && d.brightness < 1 {
+		color = &pb.Color{
+			Red:   color.GetRed() * d.brightness,
+			Green: color.GetGreen() * d.brightness,
+			Blue:  color.GetBlue() * d.brightness,
+		}
+	}
+	if err := d.write(d.resolveIcons(msg), color); err != nil {
+		log.Printf("Error writing: %v", err)
+		d.status.displayFailed(err)
+		// The display may have restarted and lost its glyphs, so they are
+		// defined again.
+		d.slots = nil
+		return false
+	}
+	d.status.shown(msg, color)
+	return true
+}
+
+// write writes a message with WriteLines, one line per row, or with Write if
+// the display server does not support it.
+func (d *display) write(msg string, color *pb.Color) error {
+	if !d.noWriteLines {
+		caps := d.capabilities()
+		var lines []*pb.WriteLinesRequest_Line
+		for i, text := range strings.Split(msg, "\n") {
+			if i >= int(caps.GetRows()) {
+				log.Printf("Message has more lines than the display's %d rows: %q", caps.GetRows(), msg)
+				break
+			}
+			lines = append(lines, &pb.WriteLinesRequest_Line{Text: text, Row: int32(i)})
+		}
+		_, err := d.client.WriteLines(context.Background(), &pb.WriteLinesRequest{Lines: lines, Color: color})
+		if grpc.Code(err) != codes.Unimplemented {
+			return err
+		}
+		log.Printf("Display does not support writing lines, writing messages instead.")
+		d.noWriteLines = true
+	}
+	_, err := d.client.Write(context.Background(), &pb.WriteRequest{Message: msg, Color: color})
+	return err
+}
+
+// resolveIcons replaces the icons in a message, such as "{bus}", with the
+// characters of the glyph slots that they are defined in, defining them first
+// if needed. Icons that cannot be shown are replaced by text.
+func (d *display) resolveIcons(msg string) string {
+	names := glyph.Names(msg)
+	if len(names) == 0 {
+		return msg
+	}
+	fallback := func(i *glyph.Icon) string { return i.Fallback }
+	if d.slots == nil {
+		caps := d.capabilities()
+		if d.caps == nil {
+			// Try again once the capabilities are known.
+			return glyph.Replace(msg, fallback)
+		}
+		d.slots = glyph.NewSlots(int(caps.GetGlyphSlots()))
+	}
+	if d.noGlyphs {
+		return glyph.Replace(msg, fallback)
+	}
+
+	assigned, define := d.slots.Assign(names)
+	if len(assigned) < len(names) {
+		log.Printf("Message has more icons than the display's %d glyph slots: %q", d.capabilities().GetGlyphSlots(), msg)
+	}
+	for slot, name := range define {
+		req := &pb.DefineGlyphRequest{Slot: int32(slot), Glyph: glyph.Lookup(name).Glyph}
+		_, err := d.client.DefineGlyph(context.Background(), req)
+		if err == nil {
+			continue
+		}
+		d.slots.Forget(slot)
+		delete(assigned, name)
+		if grpc.Code(err) == codes.Unimplemented {
+			log.Printf("Display does not support defining glyphs, showing icons as text instead.")
+			d.noGlyphs = true
+			return glyph.Replace(msg, fallback)
+		}
+		log.Printf("Error defining glyph %q: %v", name, err)
+	}
+	return glyph.Replace(msg, func(i *glyph.Icon) string {
+		if slot, ok := assigned[i.Name]; ok {
+			return string(rune(slot))
+		}
+		return i.Fallback
+	})
+}
+
+// capabilities returns what the display is able to show, asking the display
+// server the first time.
+func (d *display) capabilities() *pb.Capabilities {
+	if d.caps != nil {
+		return d.caps
+	}
+	caps, err := d.client.GetCapabilities(context.Background(), &pb.GetCapabilitiesRequest{})
+	switch {
+	case grpc.Code(err) == codes.Unimplemented:
+		log.Printf("Display does not support getting its capabilities, assuming a %dx%d display.", defaultCapabilities.GetCols(), defaultCapabilities.GetRows())
+		d.caps = defaultCapabilities
+	case err != nil:
+		// Ask again the next time.
+		log.Printf("Error getting capabilities: %v", err)
+		return defaultCapabilities
+	default:
+		log.Printf("Display has %d rows and %d columns.", caps.GetRows(), caps.GetCols())
+		d.caps = caps
+	}
+	return d.caps
+}
+
+// blank turns the display off, as far as it is able to.
+func (d *display) blank() bool {
+	d.dimColor = nil
+	d.setBrightness(0)
+	// A black, empty message darkens displays without a backlight to turn
+	// off, as well as clearing those that cannot be cleared.
+	if d.noBacklight || d.noClear {
+		return d.show("", black)
+	}
+	_, err := d.client.Clear(context.Background(), &pb.ClearRequest{})
+	if grpc.Code(err) == codes.Unimplemented {
+		log.Printf("Display does not support clearing, writing an empty message instead.")
+		d.noClear = true
+		return d.show("", black)
+	}
+	if err != nil {
+		log.Printf("Error clearing: %v", err)
+		d.status.displayFailed(err)
+		return false
+	}
+	d.status.shown("", black)
+	return true
+}
+
+// dim shows messages at the given brightness from now on, in the given color
+// unless it is nil.
+func (d *display) dim(brightness float64, color *pb.Color) {
+	d.dimColor = color
+	d.setBrightness(brightness)
+}
+
+// restore shows messages at full brightness in their own colors from now on.
+func (d *display) restore() {
+	d.dimColor = nil
+	d.setBrightness(1)
+}
+
+func (d *display) setBrightness(b float64) {
+	if b == d.brightness {
+		return
+	}
+	d.brightness = b
+	if d.noBacklight {
+		return
+	}
+	_, err := d.client.SetBrightness(context.Background(), &pb.SetBrightnessRequest{Brightness: b})
+	if grpc.Code(err) == codes.Unimplemented {
+		log.Printf("Display does not support setting the brightness, darkening colors instead.")
+		d.noBacklight = true
+		return
+	}
+	if err != nil {
+		log.Printf("Error setting brightness: %v", err)
+		d.status.displayFailed(err)
+		// Try again the next time the brightness is set.
+		d.brightness = -1
+	}
+}
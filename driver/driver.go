@@ -1,57 +1,51 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"google.golang.org/grpc"
 
 	pb "github.com/wallaceicy06/muni-sign/proto"
+	"github.com/wallaceicy06/muni-sign/schedule"
 )
 
-const configFile = "/Users/sean/muni_sign_config.pb.txt"
+// How long each prediction is shown on the display.
+const messageDuration = 5 * time.Second
+
+// How long to wait before reconnecting to the admin server after the
+// configuration stream is interrupted.
+const watchRetryDelay = 5 * time.Second
+
+// How long to wait before trying again when fetching predictions fails.
+const fetchRetryDelay = 30 * time.Second
 
 var displayAddr = flag.String("display_addr", "raspberrypi.local:50051", "The display server address in the format of host:port")
 var nextbusAddr = flag.String("nextbus_addr", "localhost:8081", "The nextbus server address in the format of host:port")
 var adminAddr = flag.String("admin_addr", "http://localhost:8080", "The admin server address to use in the format http://host:port")
-
-var colors = []*pb.Color{
-	{
-		Red:   1.0,
-		Green: 0.0,
-		Blue:  0.0,
-	},
-	{
-		Red:   1.0,
-		Green: 1.0,
-		Blue:  0.0,
-	},
-	{
-		Red:   0.0,
-		Green: 1.0,
-		Blue:  0.0,
-	},
-	{
-		Red:   0.0,
-		Green: 0.0,
-		Blue:  1.0,
-	},
-	{
-		Red:   0.6,
-		Green: 0.0,
-		Blue:  0.8,
-	},
-}
+var signID = flag.String("sign_id", "default", "The ID of the sign in the admin server that this driver displays")
+var adminToken = flag.String("admin_token", "", "The API token used to authenticate with the admin server")
+var displayToken = flag.String("display_token", "", "The API token sent to the display server, which the display emulator of the admin server requires")
+var statusInterval = flag.Duration("status_interval", time.Minute, "How often to report the status of the sign to the admin server")
 
 func main() {
 	flag.Parse()
 
-	dspConn, err := grpc.Dial(*displayAddr, grpc.WithInsecure())
+	dspOpts := []grpc.DialOption{grpc.WithInsecure()}
+	if *displayToken != "" {
+		dspOpts = append(dspOpts, grpc.WithPerRPCCredentials(tokenAuth(*displayToken)))
+	}
+	dspConn, err := grpc.Dial(*displayAddr, dspOpts...)
 	if err != nil {
 		log.Fatalf("Error connecting to display server: %v", err)
 	}
@@ -63,55 +57,270 @@ func main() {
 	}
 	nbClient := pb.NewNextbusClient(nbConn)
 
+	config, rev, err := readConfigFile()
+	if err != nil {
+		log.Fatalf("Error reading configuration file: %v", err)
+	}
+	watcher := newConfigWatcher(config, rev)
+	go watcher.run()
+	status := newStatusReporter(*statusInterval)
+	go status.run()
+	dsp := newDisplay(dspClient, status)
+
 	for {
-		config, err := readConfigFile()
+		config := watcher.get()
+
+		quiet, end, err := schedule.InQuietHours(config.GetQuietHours(), time.Now())
 		if err != nil {
-			log.Fatalf("Error reading configuration file: %v", err)
+			log.Printf("Error checking quiet hours: %v", err)
+		}
+		switch q := config.GetQuietHours(); {
+		case !quiet:
+			dsp.restore()
+		case q.GetMode() == pb.QuietHours_BLANK:
+			// Nothing is shown until the quiet hours end, or the
+			// configuration changes.
+			if !dsp.blank() {
+				end = time.Now().Add(fetchRetryDelay)
+			}
+			watcher.wait(time.Until(end))
+			continue
+		default:
+			brightness := q.GetBrightness()
+			if brightness == 0 {
+				brightness = schedule.DefaultDimBrightness
+			}
+			dsp.dim(brightness, q.GetDimColor())
 		}
 
-		for i, stopId := range config.GetStopIds() {
+		// Only the override is shown while it is active, unless predictions
+		// are to be shown in between.
+		if o := schedule.ActiveOverride(config, time.Now()); o != nil && !o.GetInterleave() {
+			dsp.show(o.GetText(), schedule.OverrideColor(o))
+			watcher.wait(messageDuration)
+			continue
+		}
+
+		sel, err := schedule.Select(config, time.Now())
+		if err != nil {
+			log.Printf("Error picking the scheduled profile: %v", err)
+		}
+
+		shown := false
+	stops:
+		for i, stop := range sel.Stops {
 			res, err := nbClient.ListPredictions(context.Background(), &pb.ListPredictionsRequest{
 				Agency: config.GetAgency(),
-				StopId: stopId,
+				StopId: stop.GetId(),
 			})
 			if err != nil {
-				log.Fatalf("Error listing predictions: %v", err)
+				log.Printf("Error listing predictions: %v", err)
+				status.fetchFailed(err)
+				continue
 			}
+			status.fetched()
 
+			color := schedule.StopColor(stop, i)
 			for _, pred := range res.GetPredictions() {
-				var msg string
-				if l := len(pred.GetNextArrivals()); l == 1 {
-					msg = fmt.Sprintf("%s-%s\n%d mins", pred.GetRoute(), pred.GetDestination(), pred.GetNextArrivals()[0])
-				} else if l >= 2 {
-					msg = fmt.Sprintf("%s-%s\n%d & %d mins", pred.GetRoute(), pred.GetDestination(), pred.GetNextArrivals()[0], pred.GetNextArrivals()[1])
-				} else {
+				if !sel.Shows(stop, pred.GetRoute()) {
+					continue
+				}
+				msg, ok := schedule.FormatPrediction(stop, pred)
+				if !ok {
 					continue
 				}
 
-				req := &pb.WriteRequest{
-					Message: msg,
-					Color:   colors[i%len(colors)],
+				if !dsp.show(msg, color) {
+					continue
+				}
+				shown = true
+
+				// Start over with the new configuration as soon as it changes
+				// rather than finishing the rotation with the old one.
+				if watcher.wait(messageDuration) {
+					break stops
 				}
 
-				if _, err := dspClient.Write(context.Background(), req); err != nil {
-					log.Fatalf("Error writing: %v", err)
+				// Alternate between predictions and an interleaved override.
+				if o := schedule.ActiveOverride(config, time.Now()); o != nil && dsp.show(o.GetText(), schedule.OverrideColor(o)) {
+					if watcher.wait(messageDuration) {
+						break stops
+					}
 				}
+			}
+		}
 
-				time.Sleep(time.Second * 5)
+		if !shown {
+			// Keep showing an interleaved override even when there are no
+			// predictions to show it in between.
+			if o := schedule.ActiveOverride(config, time.Now()); o != nil && dsp.show(o.GetText(), schedule.OverrideColor(o)) {
+				watcher.wait(messageDuration)
+				continue
 			}
+			// Avoid spinning when there is nothing to show, or when the
+			// nextbus server or display are down.
+			watcher.wait(fetchRetryDelay)
 		}
 	}
 }
 
-func readConfigFile() (*pb.Configuration, error) {
-	res, err := http.Get(fmt.Sprintf("%s/api/config", *adminAddr))
+// tokenAuth sends an API token with every call, the way the admin server
+// expects it.
+type tokenAuth string
+
+func (t tokenAuth) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + string(t)}, nil
+}
+
+// RequireTransportSecurity allows the token to be sent over the plaintext
+// connections that the driver makes.
+func (t tokenAuth) RequireTransportSecurity() bool {
+	return false
+}
+
+// readConfigFile fetches the current configuration and its revision from the
+// admin server.
+func readConfigFile() (*pb.Configuration, string, error) {
+	req, err := newAdminRequest(http.MethodGet, fmt.Sprintf("/api/signs/%s/config", *signID), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	res, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("error getting config from admin server: %v", err)
+		return nil, "", fmt.Errorf("error getting config from admin server: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("error getting config from admin server: %s", res.Status)
 	}
 
 	parsedConfig := &pb.Configuration{}
 	if err := json.NewDecoder(res.Body).Decode(parsedConfig); err != nil {
-		return nil, fmt.Errorf("error unmarshalling config proto: %v", err)
+		return nil, "", fmt.Errorf("error unmarshalling config proto: %v", err)
+	}
+	rev, err := strconv.Unquote(res.Header.Get("ETag"))
+	if err != nil {
+		rev = ""
+	}
+	return parsedConfig, rev, nil
+}
+
+// newAdminRequest creates an authenticated request for a path on the admin
+// server.
+func newAdminRequest(method, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, *adminAddr+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("error creating admin server request: %v", err)
+	}
+	if *adminToken != "" {
+		req.Header.Set("Authorization", "Bearer "+*adminToken)
+	}
+	return req, nil
+}
+
+// configWatcher keeps track of the latest configuration streamed by the admin
+// server.
+type configWatcher struct {
+	mu  sync.Mutex
+	cfg *pb.Configuration
+	rev string
+
+	// Receives a value whenever a new configuration arrives.
+	updated chan struct{}
+}
+
+func newConfigWatcher(initial *pb.Configuration, rev string) *configWatcher {
+	return &configWatcher{
+		cfg:     initial,
+		rev:     rev,
+		updated: make(chan struct{}, 1),
+	}
+}
+
+func (cw *configWatcher) get() *pb.Configuration {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+	return cw.cfg
+}
+
+func (cw *configWatcher) set(cfg *pb.Configuration, rev string) {
+	cw.mu.Lock()
+	cw.cfg = cfg
+	cw.rev = rev
+	cw.mu.Unlock()
+
+	select {
+	case cw.updated <- struct{}{}:
+	default:
+	}
+}
+
+// wait waits for d to pass, and reports whether a new configuration arrived
+// in the meantime, in which case it returns early.
+func (cw *configWatcher) wait(d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return false
+	case <-cw.updated:
+		return true
+	}
+}
+
+// run streams configurations from the admin server forever, reconnecting
+// whenever the stream is interrupted.
+func (cw *configWatcher) run() {
+	for {
+		if err := cw.stream(); err != nil {
+			log.Printf("Error watching configuration: %v", err)
+		}
+		time.Sleep(watchRetryDelay)
+	}
+}
+
+func (cw *configWatcher) stream() error {
+	req, err := newAdminRequest(http.MethodGet, fmt.Sprintf("/api/signs/%s/config/watch", *signID), nil)
+	if err != nil {
+		return err
+	}
+	cw.mu.Lock()
+	if cw.rev != "" {
+		req.Header.Set("Last-Event-ID", cw.rev)
+	}
+	cw.mu.Unlock()
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error connecting to admin server: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("error connecting to admin server: %s", res.Status)
+	}
+
+	var rev, event string
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			event = ""
+		case strings.HasPrefix(line, "id: "):
+			rev = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: ") && event == "error":
+			return fmt.Errorf("admin server ended the stream: %s", strings.TrimPrefix(line, "data: "))
+		case strings.HasPrefix(line, "data: "):
+			cfg := &pb.Configuration{}
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), cfg); err != nil {
+				return fmt.Errorf("error unmarshalling config proto: %v", err)
+			}
+			log.Printf("Received configuration revision %s.", rev)
+			cw.set(cfg, rev)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
 	}
-	return parsedConfig, nil
+	return fmt.Errorf("configuration stream closed")
 }
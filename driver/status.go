@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	pb "github.com/wallaceicy06/muni-sign/proto"
+)
+
+// statusReporter keeps track of what the sign is doing and periodically
+// reports it to the admin server, so that the admin can tell whether the sign
+// is working. It is safe for concurrent use.
+type statusReporter struct {
+	start    time.Time
+	interval time.Duration
+
+	mu            sync.Mutex
+	message       string
+	color         *pb.Color
+	lastFetch     time.Time
+	fetchErrors   int64
+	displayErrors int64
+	lastErr       error
+}
+
+func newStatusReporter(interval time.Duration) *statusReporter {
+	return &statusReporter{start: time.Now(), interval: interval}
+}
+
+// shown records a message that was written to the display.
+func (sr *statusReporter) shown(msg string, color *pb.Color) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	sr.message = msg
+	sr.color = color
+}
+
+// fetched records a successful fetch of predictions.
+func (sr *statusReporter) fetched() {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	sr.lastFetch = time.Now()
+}
+
+// fetchFailed records an error fetching predictions.
+func (sr *statusReporter) fetchFailed(err error) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	sr.fetchErrors++
+	sr.lastErr = err
+}
+
+// displayFailed records an error writing to the display.
+func (sr *statusReporter) displayFailed(err error) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	sr.displayErrors++
+	sr.lastErr = err
+}
+
+func (sr *statusReporter) snapshot() *pb.SignStatus {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	status := &pb.SignStatus{
+		Message:         sr.message,
+		Color:           sr.color,
+		FetchErrors:     sr.fetchErrors,
+		DisplayErrors:   sr.displayErrors,
+		UptimeSeconds:   int64(time.Since(sr.start) / time.Second),
+		IntervalSeconds: int64(sr.interval / time.Second),
+	}
+	if !sr.lastFetch.IsZero() {
+		status.LastFetchTime = sr.lastFetch.Unix()
+	}
+	if sr.lastErr != nil {
+		status.LastError = sr.lastErr.Error()
+	}
+	return status
+}
+
+// run reports the status to the admin server forever.
+func (sr *statusReporter) run() {
+	for {
+		if err := sr.report(); err != nil {
+			log.Printf("Error reporting status: %v", err)
+		}
+		time.Sleep(sr.interval)
+	}
+}
+
+func (sr *statusReporter) report() error {
+	data, err := json.Marshal(sr.snapshot())
+	if err != nil {
+		return fmt.Errorf("error marshalling status proto: %v", err)
+	}
+	req, err := newAdminRequest(http.MethodPut, fmt.Sprintf("/api/signs/%s/status", *signID), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending status to admin server: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("error sending status to admin server: %s", res.Status)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+// Package glyph defines the icons that messages can show on the sign. An icon
+// is written in a message as its name in braces, such as "{bus}", and shown
+// as a custom character of the display.
+package glyph
+
+import (
+	"regexp"
+
+	pb "github.com/wallaceicy06/muni-sign/proto"
+)
+
+// Icon is a picture that fits in a single character of the display.
+type Icon struct {
+	Name  string
+	Glyph *pb.Glyph
+	// Shown instead of the icon on displays that cannot define characters.
+	Fallback string
+}
+
+// The icons that messages can show, by name.
+var icons = map[string]*Icon{}
+
+func init() {
+	for _, i := range []*Icon{
+		{"bus", rows(0x0e, 0x1f, 0x11, 0x11, 0x1f, 0x1f, 0x0a, 0x00), "B"},
+		{"train", rows(0x0e, 0x11, 0x11, 0x1f, 0x15, 0x1f, 0x0a, 0x11), "T"},
+		{"cable_car", rows(0x04, 0x1f, 0x15, 0x15, 0x1f, 0x1f, 0x0a, 0x00), "C"},
+		{"walk", rows(0x0c, 0x0c, 0x04, 0x0e, 0x15, 0x04, 0x0a, 0x11), "W"},
+		{"clock", rows(0x00, 0x0e, 0x15, 0x17, 0x11, 0x0e, 0x00, 0x00), "@"},
+		{"left", rows(0x00, 0x04, 0x08, 0x1f, 0x08, 0x04, 0x00, 0x00), "<"},
+		{"right", rows(0x00, 0x04, 0x02, 0x1f, 0x02, 0x04, 0x00, 0x00), ">"},
+		{"up", rows(0x04, 0x0e, 0x15, 0x04, 0x04, 0x04, 0x04, 0x00), "^"},
+		{"down", rows(0x04, 0x04, 0x04, 0x04, 0x15, 0x0e, 0x04, 0x00), "v"},
+	} {
+		icons[i.Name] = i
+	}
+}
+
+func rows(r ...uint32) *pb.Glyph {
+	return &pb.Glyph{Rows: r}
+}
+
+var tokenRegexp = regexp.MustCompile(`\{([a-z_]+)\}`)
+
+// Lookup returns the icon with the given name, or nil if there is none.
+func Lookup(name string) *Icon {
+	return icons[name]
+}
+
+// Names returns the names of the icons in a message, in the order that they
+// first appear. Names in braces that are not icons are not included.
+func Names(msg string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, m := range tokenRegexp.FindAllStringSubmatch(msg, -1) {
+		if name := m[1]; icons[name] != nil && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Replace returns a message with every icon in it replaced by the result of
+// f. Names in braces that are not icons are left as they are.
+func Replace(msg string, f func(i *Icon) string) string {
+	return tokenRegexp.ReplaceAllStringFunc(msg, func(token string) string {
+		i := icons[token[1:len(token)-1]]
+		if i == nil {
+			return token
+		}
+		return f(i)
+	})
+}
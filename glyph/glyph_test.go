@@ -0,0 +1,100 @@
+package glyph
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIcons(t *testing.T) {
+	for name, i := range icons {
+		if i.Name != name {
+			t.Errorf("icon %q has name %q", name, i.Name)
+		}
+		if got := len(i.Glyph.GetRows()); got != 8 {
+			t.Errorf("icon %q has %d rows want 8", name, got)
+		}
+		for _, r := range i.Glyph.GetRows() {
+			if r >= 1<<5 {
+				t.Errorf("icon %q has row %#x wider than 5 pixels", name, r)
+			}
+		}
+		if len(i.Fallback) != 1 {
+			t.Errorf("icon %q has fallback %q want a single character", name, i.Fallback)
+		}
+	}
+}
+
+func TestNames(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  string
+		want []string
+	}{
+		{
+			name: "None",
+			msg:  "N-Caltrain\n2 mins",
+			want: nil,
+		},
+		{
+			name: "One",
+			msg:  "{bus} 38-Geary\n2 mins",
+			want: []string{"bus"},
+		},
+		{
+			name: "InOrder",
+			msg:  "{train} N-Judah\n{walk} 5 {clock} 2 mins",
+			want: []string{"train", "walk", "clock"},
+		},
+		{
+			name: "Repeated",
+			msg:  "{up}{up}{down}{up}",
+			want: []string{"up", "down"},
+		},
+		{
+			name: "NotAnIcon",
+			msg:  "{rocket} {Bus} {bus",
+			want: nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := Names(test.msg); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got names %q want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestReplace(t *testing.T) {
+	fallback := func(i *Icon) string { return i.Fallback }
+	tests := []struct {
+		name string
+		msg  string
+		want string
+	}{
+		{
+			name: "None",
+			msg:  "N-Caltrain\n2 mins",
+			want: "N-Caltrain\n2 mins",
+		},
+		{
+			name: "Icons",
+			msg:  "{bus} 38-Geary\n{right} 2 mins",
+			want: "B 38-Geary\n> 2 mins",
+		},
+		{
+			name: "NotAnIcon",
+			msg:  "{rocket} {bus}",
+			want: "{rocket} B",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := Replace(test.msg, fallback); got != test.want {
+				t.Errorf("got %q want %q", got, test.want)
+			}
+		})
+	}
+}
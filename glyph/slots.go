@@ -0,0 +1,68 @@
+package glyph
+
+// Slots keeps track of the icons defined in a display's glyph slots. When a
+// message shows an icon that is not defined and every slot is taken, the slot
+// that was least recently shown is redefined.
+type Slots struct {
+	// The icon defined in each slot, or "" if the slot is free.
+	names []string
+	// The message that each slot was last shown in, counting from 1.
+	shown []int
+	count int
+}
+
+// NewSlots returns the slots of a display with n glyph slots, all free.
+func NewSlots(n int) *Slots {
+	return &Slots{names: make([]string, n), shown: make([]int, n)}
+}
+
+// Assign picks the slots that the icons of a message are shown in, given
+// their names. It returns the slot of each icon, and the slots that must be
+// defined with their new icons before the message is shown. When a message
+// has more icons than there are slots, the last ones are not assigned.
+func (s *Slots) Assign(names []string) (assigned map[string]int, define map[int]string) {
+	s.count++
+	assigned = make(map[string]int)
+	define = make(map[int]string)
+	var missing []string
+	for _, name := range names {
+		if i := s.find(name); i >= 0 {
+			assigned[name] = i
+			s.shown[i] = s.count
+		} else {
+			missing = append(missing, name)
+		}
+	}
+	for _, name := range missing {
+		// Free slots are never shown, so they are picked first.
+		i := -1
+		for j := range s.names {
+			if s.shown[j] != s.count && (i < 0 || s.shown[j] < s.shown[i]) {
+				i = j
+			}
+		}
+		if i < 0 {
+			break
+		}
+		s.names[i] = name
+		s.shown[i] = s.count
+		assigned[name] = i
+		define[i] = name
+	}
+	return assigned, define
+}
+
+// Forget frees a slot, such as when defining it failed.
+func (s *Slots) Forget(slot int) {
+	s.names[slot] = ""
+	s.shown[slot] = 0
+}
+
+func (s *Slots) find(name string) int {
+	for i, n := range s.names {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,127 @@
+package glyph
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSlots(t *testing.T) {
+	type assignment struct {
+		names        []string
+		wantAssigned map[string]int
+		wantDefine   map[int]string
+	}
+	tests := []struct {
+		name        string
+		slots       int
+		assignments []assignment
+	}{
+		{
+			name:  "FreeSlots",
+			slots: 3,
+			assignments: []assignment{
+				{
+					names:        []string{"bus", "walk"},
+					wantAssigned: map[string]int{"bus": 0, "walk": 1},
+					wantDefine:   map[int]string{0: "bus", 1: "walk"},
+				},
+				{
+					names:        []string{"walk", "train"},
+					wantAssigned: map[string]int{"walk": 1, "train": 2},
+					wantDefine:   map[int]string{2: "train"},
+				},
+			},
+		},
+		{
+			name:  "AlreadyDefined",
+			slots: 2,
+			assignments: []assignment{
+				{
+					names:        []string{"bus"},
+					wantAssigned: map[string]int{"bus": 0},
+					wantDefine:   map[int]string{0: "bus"},
+				},
+				{
+					names:        []string{"bus"},
+					wantAssigned: map[string]int{"bus": 0},
+					wantDefine:   map[int]string{},
+				},
+			},
+		},
+		{
+			name:  "LeastRecentlyShown",
+			slots: 2,
+			assignments: []assignment{
+				{
+					names:        []string{"bus", "walk"},
+					wantAssigned: map[string]int{"bus": 0, "walk": 1},
+					wantDefine:   map[int]string{0: "bus", 1: "walk"},
+				},
+				{
+					names:        []string{"bus"},
+					wantAssigned: map[string]int{"bus": 0},
+					wantDefine:   map[int]string{},
+				},
+				// Walk was shown longest ago.
+				{
+					names:        []string{"train"},
+					wantAssigned: map[string]int{"train": 1},
+					wantDefine:   map[int]string{1: "train"},
+				},
+				// Slots shown in the same message are never redefined.
+				{
+					names:        []string{"train", "walk"},
+					wantAssigned: map[string]int{"train": 1, "walk": 0},
+					wantDefine:   map[int]string{0: "walk"},
+				},
+			},
+		},
+		{
+			name:  "TooManyIcons",
+			slots: 2,
+			assignments: []assignment{
+				{
+					names:        []string{"bus", "walk", "train"},
+					wantAssigned: map[string]int{"bus": 0, "walk": 1},
+					wantDefine:   map[int]string{0: "bus", 1: "walk"},
+				},
+			},
+		},
+		{
+			name:  "NoSlots",
+			slots: 0,
+			assignments: []assignment{
+				{
+					names:        []string{"bus"},
+					wantAssigned: map[string]int{},
+					wantDefine:   map[int]string{},
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := NewSlots(test.slots)
+			for i, a := range test.assignments {
+				assigned, define := s.Assign(a.names)
+				if !reflect.DeepEqual(assigned, a.wantAssigned) {
+					t.Errorf("assignment %d got slots %v want %v", i, assigned, a.wantAssigned)
+				}
+				if !reflect.DeepEqual(define, a.wantDefine) {
+					t.Errorf("assignment %d got definitions %v want %v", i, define, a.wantDefine)
+				}
+			}
+		})
+	}
+}
+
+func TestSlotsForget(t *testing.T) {
+	s := NewSlots(2)
+	s.Assign([]string{"bus"})
+	s.Forget(0)
+	// A forgotten icon is defined again.
+	if _, define := s.Assign([]string{"bus"}); !reflect.DeepEqual(define, map[int]string{0: "bus"}) {
+		t.Errorf("got definitions %v want bus in slot 0", define)
+	}
+}
@@ -0,0 +1,116 @@
+package schedule
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+var dayNames = []string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"}
+
+// ParseDays parses a list of days of the week separated by spaces or commas,
+// where a range of days is written with a dash, such as "Mon-Fri" or
+// "Sat, Sun". Day names are the first three letters of the English name, in
+// any case. The days are returned in order, each day once, numbered like
+// time.Weekday. An empty list means every day and is returned as nil.
+func ParseDays(s string) ([]int32, error) {
+	var seen [7]bool
+	for _, f := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' }) {
+		first, last := f, f
+		if i := strings.Index(f, "-"); i >= 0 {
+			first, last = f[:i], f[i+1:]
+		}
+		start, err := parseDay(first)
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseDay(last)
+		if err != nil {
+			return nil, err
+		}
+		// Ranges may wrap around the end of the week, as in "Fri-Mon".
+		for d := start; ; d = (d + 1) % 7 {
+			seen[d] = true
+			if d == end {
+				break
+			}
+		}
+	}
+
+	var days []int32
+	for d, ok := range seen {
+		if ok {
+			days = append(days, int32(d))
+		}
+	}
+	if len(days) == 7 {
+		return nil, nil
+	}
+	return days, nil
+}
+
+func parseDay(s string) (int, error) {
+	for i, name := range dayNames {
+		if strings.EqualFold(s, name) {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown day %q", s)
+}
+
+// FormatDays formats days of the week the way ParseDays parses them, writing
+// runs of three or more days as ranges. Every day is formatted as the empty
+// string.
+func FormatDays(days []int32) string {
+	var seen [7]bool
+	for _, d := range days {
+		if d >= 0 && d < 7 {
+			seen[d] = true
+		}
+	}
+	sorted := make([]int, 0, 7)
+	for d, ok := range seen {
+		if ok {
+			sorted = append(sorted, d)
+		}
+	}
+	if len(sorted) == 0 || len(sorted) == 7 {
+		return ""
+	}
+
+	var parts []string
+	for i := 0; i < len(sorted); {
+		j := i
+		for j+1 < len(sorted) && sorted[j+1] == sorted[j]+1 {
+			j++
+		}
+		if j-i >= 2 {
+			parts = append(parts, dayNames[sorted[i]]+"-"+dayNames[sorted[j]])
+		} else {
+			for k := i; k <= j; k++ {
+				parts = append(parts, dayNames[sorted[k]])
+			}
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, " ")
+}
+
+// ParseMinute parses a time of day of the form "15:04" into minutes after
+// midnight. "24:00" is accepted as the end of the day.
+func ParseMinute(s string) (int32, error) {
+	if s == "24:00" {
+		return minutesPerDay, nil
+	}
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q", s)
+	}
+	return int32(t.Hour()*60 + t.Minute()), nil
+}
+
+// FormatMinute formats minutes after midnight as a time of day, such as
+// "15:04".
+func FormatMinute(m int32) string {
+	return fmt.Sprintf("%02d:%02d", m/60, m%60)
+}
@@ -0,0 +1,92 @@
+package schedule
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDays(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []int32
+		wantErr bool
+	}{
+		{in: "", want: nil},
+		{in: "Mon-Fri", want: []int32{1, 2, 3, 4, 5}},
+		{in: "sat, SUN", want: []int32{0, 6}},
+		{in: "Fri-Mon", want: []int32{0, 1, 5, 6}},
+		{in: "Mon Mon", want: []int32{1}},
+		{in: "Sun-Sat", want: nil},
+		{in: "Monday", wantErr: true},
+		{in: "Mon-", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.in, func(t *testing.T) {
+			got, err := ParseDays(test.in)
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("ParseDays(%q) = _, <nil> want _, <non-nil>", test.in)
+				}
+				return
+			}
+			if err != nil || !reflect.DeepEqual(got, test.want) {
+				t.Errorf("ParseDays(%q) = %v, %v want %v, <nil>", test.in, got, err, test.want)
+			}
+		})
+	}
+}
+
+func TestFormatDays(t *testing.T) {
+	tests := []struct {
+		days []int32
+		want string
+	}{
+		{days: nil, want: ""},
+		{days: []int32{0, 1, 2, 3, 4, 5, 6}, want: ""},
+		{days: []int32{5, 4, 3, 2, 1}, want: "Mon-Fri"},
+		{days: []int32{0, 6}, want: "Sun Sat"},
+		{days: []int32{1, 2, 4}, want: "Mon Tue Thu"},
+	}
+
+	for _, test := range tests {
+		got := FormatDays(test.days)
+		if got != test.want {
+			t.Errorf("FormatDays(%v) = %q want %q", test.days, got, test.want)
+		}
+		// Formatted days parse back to the same days.
+		if parsed, err := ParseDays(got); err != nil || FormatDays(parsed) != got {
+			t.Errorf("ParseDays(%q) = %v, %v want the days formatted as %q", got, parsed, err, got)
+		}
+	}
+}
+
+func TestParseMinute(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int32
+		wantErr bool
+	}{
+		{in: "00:00", want: 0},
+		{in: "07:30", want: 450},
+		{in: "24:00", want: 1440},
+		{in: "07:60", wantErr: true},
+		{in: "25:00", wantErr: true},
+	}
+
+	for _, test := range tests {
+		got, err := ParseMinute(test.in)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("ParseMinute(%q) = _, <nil> want _, <non-nil>", test.in)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("ParseMinute(%q) = %d, %v want %d, <nil>", test.in, got, err, test.want)
+		}
+		if f := FormatMinute(got); f != test.in {
+			t.Errorf("FormatMinute(%d) = %q want %q", got, f, test.in)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	pb "github.com/wallaceicy06/muni-sign/proto"
+)
+
+// The colors that stops without one of their own are shown in, in turn.
+var stopColors = []*pb.Color{
+	{Red: 1.0, Green: 0.0, Blue: 0.0},
+	{Red: 1.0, Green: 1.0, Blue: 0.0},
+	{Red: 0.0, Green: 1.0, Blue: 0.0},
+	{Red: 0.0, Green: 0.0, Blue: 1.0},
+	{Red: 0.6, Green: 0.0, Blue: 0.8},
+}
+
+// The color of an override that does not specify one.
+var defaultOverrideColor = &pb.Color{Red: 1.0, Green: 1.0, Blue: 1.0}
+
+// StopColor returns the color that predictions for a stop are shown in, given
+// its position among the stops that are shown.
+func StopColor(stop *pb.Stop, i int) *pb.Color {
+	if stop.GetColor() != nil {
+		return stop.GetColor()
+	}
+	return stopColors[i%len(stopColors)]
+}
+
+// OverrideColor returns the color that an override is shown in.
+func OverrideColor(o *pb.MessageOverride) *pb.Color {
+	if o.GetColor() == nil {
+		return defaultOverrideColor
+	}
+	return o.GetColor()
+}
+
+// ActiveOverride returns the override of a configuration, or nil if it has
+// none or it has expired by now.
+func ActiveOverride(cfg *pb.Configuration, now time.Time) *pb.MessageOverride {
+	o := cfg.GetOverride()
+	if o == nil || o.GetExpireTime() <= now.Unix() {
+		return nil
+	}
+	return o
+}
+
+// ValidateColor checks that every component of a color is between 0 and 1. A
+// missing color is valid, since a default is used in its place.
+func ValidateColor(c *pb.Color) error {
+	for _, v := range []float64{c.GetRed(), c.GetGreen(), c.GetBlue()} {
+		if !(v >= 0 && v <= 1) {
+			return errors.New("color components must be between 0 and 1")
+		}
+	}
+	return nil
+}
+
+// FormatPrediction formats the next arrivals of a route at a stop that can be
+// caught by walking there now, as the two lines shown on the sign. It reports
+// false if there are none.
+func FormatPrediction(stop *pb.Stop, pred *pb.Prediction) (string, bool) {
+	var arrivals []int32
+	for _, a := range pred.GetNextArrivals() {
+		if a >= stop.GetWalkingMinutes() {
+			arrivals = append(arrivals, a)
+		}
+	}
+	name := stop.GetNickname()
+	if name == "" {
+		name = pred.GetDestination()
+	}
+	switch {
+	case len(arrivals) == 1:
+		return fmt.Sprintf("%s-%s\n%d mins", pred.GetRoute(), name, arrivals[0]), true
+	case len(arrivals) >= 2:
+		return fmt.Sprintf("%s-%s\n%d & %d mins", pred.GetRoute(), name, arrivals[0], arrivals[1]), true
+	default:
+		return "", false
+	}
+}
@@ -0,0 +1,121 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/wallaceicy06/muni-sign/proto"
+)
+
+func TestFormatPrediction(t *testing.T) {
+	pred := &pb.Prediction{Route: "N", Destination: "Caltrain", NextArrivals: []int32{2, 7, 15}}
+
+	tests := []struct {
+		name   string
+		stop   *pb.Stop
+		pred   *pb.Prediction
+		want   string
+		wantOk bool
+	}{
+		{
+			name:   "TwoArrivals",
+			stop:   &pb.Stop{Id: "1234"},
+			pred:   pred,
+			want:   "N-Caltrain\n2 & 7 mins",
+			wantOk: true,
+		},
+		{
+			name:   "OneArrival",
+			stop:   &pb.Stop{Id: "1234"},
+			pred:   &pb.Prediction{Route: "N", Destination: "Caltrain", NextArrivals: []int32{4}},
+			want:   "N-Caltrain\n4 mins",
+			wantOk: true,
+		},
+		{
+			name:   "Nickname",
+			stop:   &pb.Stop{Id: "1234", Nickname: "Home→Work"},
+			pred:   pred,
+			want:   "N-Home→Work\n2 & 7 mins",
+			wantOk: true,
+		},
+		{
+			name:   "WalkingTime",
+			stop:   &pb.Stop{Id: "1234", WalkingMinutes: 5},
+			pred:   pred,
+			want:   "N-Caltrain\n7 & 15 mins",
+			wantOk: true,
+		},
+		{
+			name: "NoneCatchable",
+			stop: &pb.Stop{Id: "1234", WalkingMinutes: 20},
+			pred: pred,
+		},
+		{
+			name: "NoArrivals",
+			stop: &pb.Stop{Id: "1234"},
+			pred: &pb.Prediction{Route: "N", Destination: "Caltrain"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := FormatPrediction(test.stop, test.pred)
+			if got != test.want || ok != test.wantOk {
+				t.Errorf("FormatPrediction() = %q, %t want %q, %t", got, ok, test.want, test.wantOk)
+			}
+		})
+	}
+}
+
+func TestStopColor(t *testing.T) {
+	own := &pb.Color{Green: 0.5}
+	if got := StopColor(&pb.Stop{Color: own}, 3); !proto.Equal(got, own) {
+		t.Errorf("StopColor() of a stop with a color = %v want %v", got, own)
+	}
+	if got, want := StopColor(&pb.Stop{}, len(stopColors)+1), stopColors[1]; !proto.Equal(got, want) {
+		t.Errorf("StopColor() = %v want %v", got, want)
+	}
+}
+
+func TestActiveOverride(t *testing.T) {
+	now := time.Date(2017, time.June, 1, 12, 0, 0, 0, time.UTC)
+	o := &pb.MessageOverride{Text: "Office closed today", ExpireTime: now.Add(time.Hour).Unix()}
+
+	if got := ActiveOverride(&pb.Configuration{Override: o}, now); got != o {
+		t.Errorf("ActiveOverride() = %v want %v", got, o)
+	}
+	if got := ActiveOverride(&pb.Configuration{Override: o}, now.Add(time.Hour)); got != nil {
+		t.Errorf("ActiveOverride() after it expired = %v want <nil>", got)
+	}
+	if got := ActiveOverride(&pb.Configuration{}, now); got != nil {
+		t.Errorf("ActiveOverride() without an override = %v want <nil>", got)
+	}
+}
+
+func TestValidateColor(t *testing.T) {
+	tests := []struct {
+		name    string
+		color   *pb.Color
+		wantErr bool
+	}{
+		{name: "Missing"},
+		{name: "Black", color: &pb.Color{}},
+		{name: "White", color: &pb.Color{Red: 1, Green: 1, Blue: 1}},
+		{name: "TooBright", color: &pb.Color{Green: 1.5}, wantErr: true},
+		{name: "Negative", color: &pb.Color{Blue: -0.1}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ValidateColor(test.color)
+			if test.wantErr && err == nil {
+				t.Errorf("ValidateColor() = <nil> want <non-nil>")
+			}
+			if !test.wantErr && err != nil {
+				t.Errorf("ValidateColor() = %v want <nil>", err)
+			}
+		})
+	}
+}
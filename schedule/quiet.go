@@ -0,0 +1,171 @@
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	pb "github.com/wallaceicy06/muni-sign/proto"
+)
+
+// The furthest that a time of day may be from sunrise or sunset.
+const maxSunOffset = 12 * 60
+
+// The brightness of a dimmed display when the quiet hours do not say.
+const DefaultDimBrightness = 0.2
+
+// InQuietHours reports whether t is within the quiet hours and, if so, when
+// they end. Nil quiet hours are never in effect. On days when the sun does not
+// rise or set, quiet hours that start or end relative to it are not in
+// effect.
+func InQuietHours(q *pb.QuietHours, t time.Time) (bool, time.Time, error) {
+	if q == nil {
+		return false, time.Time{}, nil
+	}
+	loc, err := time.LoadLocation(q.GetTimeZone())
+	if err != nil {
+		return false, time.Time{}, fmt.Errorf("unknown time zone %q", q.GetTimeZone())
+	}
+	t = t.In(loc)
+
+	// Quiet hours that started yesterday may last past midnight.
+	today := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	for _, day := range []time.Time{today.AddDate(0, 0, -1), today} {
+		start, ok := resolve(q, q.GetStart(), day)
+		if !ok {
+			continue
+		}
+		end, ok := resolve(q, q.GetEnd(), day)
+		if ok && !end.After(start) {
+			end, ok = resolve(q, q.GetEnd(), day.AddDate(0, 0, 1))
+		}
+		if !ok {
+			continue
+		}
+		if !t.Before(start) && t.Before(end) {
+			return true, end, nil
+		}
+	}
+	return false, time.Time{}, nil
+}
+
+// resolve returns the time that tod refers to on the given day.
+func resolve(q *pb.QuietHours, tod *pb.TimeOfDay, day time.Time) (time.Time, bool) {
+	offset := tod.GetOffsetMinutes()
+	switch tod.GetReference() {
+	case pb.TimeOfDay_SUNRISE, pb.TimeOfDay_SUNSET:
+		sunrise, sunset, ok := SunriseSunset(day, q.GetLatitude(), q.GetLongitude())
+		if !ok {
+			return time.Time{}, false
+		}
+		if tod.GetReference() == pb.TimeOfDay_SUNRISE {
+			return sunrise.Add(time.Duration(offset) * time.Minute), true
+		}
+		return sunset.Add(time.Duration(offset) * time.Minute), true
+	default:
+		// Count from midnight on the clock rather than adding a duration, so
+		// that fixed times stay put on days when daylight saving time
+		// starts or ends.
+		return time.Date(day.Year(), day.Month(), day.Day(), 0, int(offset), 0, 0, day.Location()), true
+	}
+}
+
+// validateQuietHours checks that quiet hours make sense.
+func validateQuietHours(q *pb.QuietHours) error {
+	if _, err := time.LoadLocation(q.GetTimeZone()); err != nil {
+		return fmt.Errorf("unknown time zone %q", q.GetTimeZone())
+	}
+	usesSun := false
+	for _, tod := range []*pb.TimeOfDay{q.GetStart(), q.GetEnd()} {
+		offset := tod.GetOffsetMinutes()
+		switch tod.GetReference() {
+		case pb.TimeOfDay_MIDNIGHT:
+			if offset < 0 || offset > minutesPerDay {
+				return fmt.Errorf("invalid time of day %d", offset)
+			}
+		case pb.TimeOfDay_SUNRISE, pb.TimeOfDay_SUNSET:
+			usesSun = true
+			if offset < -maxSunOffset || offset > maxSunOffset {
+				return fmt.Errorf("%s is more than 12 hours from sunrise or sunset", FormatTimeOfDay(tod))
+			}
+		default:
+			return fmt.Errorf("unknown time of day reference %v", tod.GetReference())
+		}
+	}
+	if sameTimeOfDay(q.GetStart(), q.GetEnd()) {
+		return errors.New("quiet hours must end at a different time than they start")
+	}
+	if usesSun {
+		if q.GetLatitude() == 0 && q.GetLongitude() == 0 {
+			return errors.New("the location of the sign is needed to use sunrise or sunset")
+		}
+		if q.GetLatitude() < -90 || q.GetLatitude() > 90 || q.GetLongitude() < -180 || q.GetLongitude() > 180 {
+			return fmt.Errorf("invalid location %v, %v", q.GetLatitude(), q.GetLongitude())
+		}
+	}
+	if q.GetBrightness() < 0 || q.GetBrightness() > 1 {
+		return fmt.Errorf("brightness must be between 0 and 1, got %v", q.GetBrightness())
+	}
+	return nil
+}
+
+func sameTimeOfDay(a, b *pb.TimeOfDay) bool {
+	return a.GetReference() == b.GetReference() && a.GetOffsetMinutes() == b.GetOffsetMinutes()
+}
+
+// ParseTimeOfDay parses a time of day that is either fixed, such as "22:00",
+// or relative to sunrise or sunset, such as "sunset", "sunset+30m" or
+// "sunrise-1h30m".
+func ParseTimeOfDay(s string) (*pb.TimeOfDay, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for _, ref := range []pb.TimeOfDay_Reference{pb.TimeOfDay_SUNRISE, pb.TimeOfDay_SUNSET} {
+		name := strings.ToLower(ref.String())
+		if !strings.HasPrefix(s, name) {
+			continue
+		}
+		tod := &pb.TimeOfDay{Reference: ref}
+		if rest := strings.TrimSpace(strings.TrimPrefix(s, name)); rest != "" {
+			if rest[0] != '+' && rest[0] != '-' {
+				return nil, fmt.Errorf("invalid time of day %q", s)
+			}
+			d, err := time.ParseDuration(strings.Replace(rest, " ", "", -1))
+			if err != nil || d%time.Minute != 0 {
+				return nil, fmt.Errorf("invalid time of day %q", s)
+			}
+			tod.OffsetMinutes = int32(d / time.Minute)
+		}
+		return tod, nil
+	}
+
+	m, err := ParseMinute(s)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.TimeOfDay{OffsetMinutes: m}, nil
+}
+
+// FormatTimeOfDay formats a time of day the way ParseTimeOfDay parses it.
+func FormatTimeOfDay(tod *pb.TimeOfDay) string {
+	offset := tod.GetOffsetMinutes()
+	if tod.GetReference() == pb.TimeOfDay_MIDNIGHT {
+		return FormatMinute(offset)
+	}
+	s := strings.ToLower(tod.GetReference().String())
+	if offset == 0 {
+		return s
+	}
+	if offset < 0 {
+		s += "-"
+		offset = -offset
+	} else {
+		s += "+"
+	}
+	if h := offset / 60; h > 0 {
+		s += fmt.Sprintf("%dh", h)
+	}
+	if m := offset % 60; m > 0 {
+		s += fmt.Sprintf("%dm", m)
+	}
+	return s
+}
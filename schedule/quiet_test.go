@@ -0,0 +1,176 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/wallaceicy06/muni-sign/proto"
+)
+
+func TestInQuietHours(t *testing.T) {
+	la, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Fatalf("time.LoadLocation() = _, %v want _, <nil>", err)
+	}
+	night := &pb.QuietHours{
+		TimeZone: "America/Los_Angeles",
+		Start:    &pb.TimeOfDay{OffsetMinutes: 23 * 60},
+		End:      &pb.TimeOfDay{OffsetMinutes: 6 * 60},
+	}
+	lunch := &pb.QuietHours{
+		TimeZone: "America/Los_Angeles",
+		Start:    &pb.TimeOfDay{OffsetMinutes: 12 * 60},
+		End:      &pb.TimeOfDay{OffsetMinutes: 13 * 60},
+	}
+	dark := &pb.QuietHours{
+		TimeZone:  "America/Los_Angeles",
+		Start:     &pb.TimeOfDay{Reference: pb.TimeOfDay_SUNSET, OffsetMinutes: 30},
+		End:       &pb.TimeOfDay{Reference: pb.TimeOfDay_SUNRISE},
+		Latitude:  37.7749,
+		Longitude: -122.4194,
+	}
+
+	tests := []struct {
+		name    string
+		q       *pb.QuietHours
+		t       time.Time
+		want    bool
+		wantEnd time.Time
+	}{
+		{name: "None", q: nil, t: time.Date(2017, 7, 11, 23, 30, 0, 0, la)},
+		{name: "BeforeNight", q: night, t: time.Date(2017, 7, 11, 22, 59, 0, 0, la)},
+		{name: "Night", q: night, t: time.Date(2017, 7, 11, 23, 0, 0, 0, la), want: true, wantEnd: time.Date(2017, 7, 12, 6, 0, 0, 0, la)},
+		{name: "PastMidnight", q: night, t: time.Date(2017, 7, 12, 2, 0, 0, 0, la), want: true, wantEnd: time.Date(2017, 7, 12, 6, 0, 0, 0, la)},
+		{name: "Morning", q: night, t: time.Date(2017, 7, 12, 6, 0, 0, 0, la)},
+		{name: "Lunch", q: lunch, t: time.Date(2017, 7, 11, 12, 30, 0, 0, la), want: true, wantEnd: time.Date(2017, 7, 11, 13, 0, 0, 0, la)},
+		{name: "AfterLunch", q: lunch, t: time.Date(2017, 7, 11, 13, 30, 0, 0, la)},
+		{name: "OtherTimeZone", q: night, t: time.Date(2017, 7, 12, 7, 0, 0, 0, time.UTC), want: true, wantEnd: time.Date(2017, 7, 12, 6, 0, 0, 0, la)},
+		{name: "Dusk", q: dark, t: time.Date(2017, 6, 21, 20, 50, 0, 0, la)},
+		{name: "Dark", q: dark, t: time.Date(2017, 6, 21, 23, 0, 0, 0, la), want: true},
+		{name: "Dawn", q: dark, t: time.Date(2017, 6, 22, 5, 0, 0, 0, la), want: true},
+		{name: "Day", q: dark, t: time.Date(2017, 6, 22, 9, 0, 0, 0, la)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, end, err := InQuietHours(test.q, test.t)
+			if err != nil || got != test.want {
+				t.Fatalf("InQuietHours(%v, %v) = %t, _, %v want %t, _, <nil>", test.q, test.t, got, err, test.want)
+			}
+			if !test.wantEnd.IsZero() && !end.Equal(test.wantEnd) {
+				t.Errorf("InQuietHours(%v, %v) = _, %v, _ want _, %v, _", test.q, test.t, end, test.wantEnd)
+			}
+			if got && !end.After(test.t) {
+				t.Errorf("InQuietHours(%v, %v) = _, %v, _ want an end after %v", test.q, test.t, end, test.t)
+			}
+		})
+	}
+}
+
+func TestValidateQuietHours(t *testing.T) {
+	tests := []struct {
+		name    string
+		q       *pb.QuietHours
+		wantErr bool
+	}{
+		{
+			name: "Fixed",
+			q:    &pb.QuietHours{Start: &pb.TimeOfDay{OffsetMinutes: 23 * 60}, End: &pb.TimeOfDay{OffsetMinutes: 6 * 60}},
+		},
+		{
+			name: "Sun",
+			q: &pb.QuietHours{
+				Start:     &pb.TimeOfDay{Reference: pb.TimeOfDay_SUNSET},
+				End:       &pb.TimeOfDay{Reference: pb.TimeOfDay_SUNRISE},
+				Latitude:  37.7749,
+				Longitude: -122.4194,
+			},
+		},
+		{
+			name:    "SameStartAndEnd",
+			q:       &pb.QuietHours{Start: &pb.TimeOfDay{OffsetMinutes: 60}, End: &pb.TimeOfDay{OffsetMinutes: 60}},
+			wantErr: true,
+		},
+		{
+			name:    "InvalidTime",
+			q:       &pb.QuietHours{Start: &pb.TimeOfDay{OffsetMinutes: 25 * 60}, End: &pb.TimeOfDay{}},
+			wantErr: true,
+		},
+		{
+			name: "FarFromSunset",
+			q: &pb.QuietHours{
+				Start:     &pb.TimeOfDay{Reference: pb.TimeOfDay_SUNSET, OffsetMinutes: 13 * 60},
+				End:       &pb.TimeOfDay{Reference: pb.TimeOfDay_SUNRISE},
+				Latitude:  37.7749,
+				Longitude: -122.4194,
+			},
+			wantErr: true,
+		},
+		{
+			name: "SunWithoutLocation",
+			q: &pb.QuietHours{
+				Start: &pb.TimeOfDay{Reference: pb.TimeOfDay_SUNSET},
+				End:   &pb.TimeOfDay{OffsetMinutes: 6 * 60},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "UnknownTimeZone",
+			q:       &pb.QuietHours{TimeZone: "Mars/Olympus_Mons", Start: &pb.TimeOfDay{OffsetMinutes: 60}, End: &pb.TimeOfDay{}},
+			wantErr: true,
+		},
+		{
+			name:    "TooBright",
+			q:       &pb.QuietHours{Start: &pb.TimeOfDay{OffsetMinutes: 60}, End: &pb.TimeOfDay{}, Brightness: 1.5},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := Validate(&pb.Configuration{QuietHours: test.q})
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Errorf("Validate() = %v want error %t", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseTimeOfDay(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    *pb.TimeOfDay
+		wantErr bool
+	}{
+		{in: "22:00", want: &pb.TimeOfDay{OffsetMinutes: 22 * 60}},
+		{in: "24:00", want: &pb.TimeOfDay{OffsetMinutes: 24 * 60}},
+		{in: "Sunset", want: &pb.TimeOfDay{Reference: pb.TimeOfDay_SUNSET}},
+		{in: "sunset+30m", want: &pb.TimeOfDay{Reference: pb.TimeOfDay_SUNSET, OffsetMinutes: 30}},
+		{in: "sunrise - 1h30m", want: &pb.TimeOfDay{Reference: pb.TimeOfDay_SUNRISE, OffsetMinutes: -90}},
+		{in: "sunset30m", wantErr: true},
+		{in: "sunset+30s", wantErr: true},
+		{in: "dusk", wantErr: true},
+		{in: "", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.in, func(t *testing.T) {
+			got, err := ParseTimeOfDay(test.in)
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("ParseTimeOfDay(%q) = %v, <nil> want _, <non-nil>", test.in, got)
+				}
+				return
+			}
+			if err != nil || !proto.Equal(got, test.want) {
+				t.Errorf("ParseTimeOfDay(%q) = %v, %v want %v, <nil>", test.in, got, err, test.want)
+			}
+			// Formatted times of day parse back to the same time.
+			if parsed, err := ParseTimeOfDay(FormatTimeOfDay(got)); err != nil || !proto.Equal(parsed, got) {
+				t.Errorf("ParseTimeOfDay(%q) = %v, %v want %v, <nil>", FormatTimeOfDay(got), parsed, err, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,231 @@
+// Package schedule picks which profile of a sign's configuration is shown at a
+// given time, and how its predictions are formatted. It is shared by the admin
+// server, which shows the active profile, and the driver, which displays it.
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	// Signs often run on minimal systems without a time zone database.
+	_ "time/tzdata"
+
+	pb "github.com/wallaceicy06/muni-sign/proto"
+)
+
+// The number of minutes in a day, which is the latest that a rule may end.
+const minutesPerDay = 24 * 60
+
+// Selection describes what a sign shows at some time.
+type Selection struct {
+	// The name of the active profile, or empty if the stops of the
+	// configuration itself are shown.
+	Profile string
+	// The stops to show predictions for, with their display settings.
+	Stops []*pb.Stop
+	// The routes to show predictions for, or empty to show every route.
+	Routes []string
+	// A human-friendly explanation of why the profile is active.
+	Reason string
+}
+
+// Shows reports whether predictions for the route at the stop are shown,
+// which they are unless either the profile or the stop is limited to other
+// routes.
+func (s *Selection) Shows(stop *pb.Stop, route string) bool {
+	return hasRoute(s.Routes, route) && hasRoute(stop.GetRoutes(), route)
+}
+
+// hasRoute reports whether route is one of routes, or routes is empty.
+func hasRoute(routes []string, route string) bool {
+	if len(routes) == 0 {
+		return true
+	}
+	for _, r := range routes {
+		if r == route {
+			return true
+		}
+	}
+	return false
+}
+
+// Select returns what a sign with the given configuration shows at t. It only
+// fails if the schedule is invalid, in which case the returned selection
+// still shows the stops of the configuration itself.
+func Select(cfg *pb.Configuration, t time.Time) (*Selection, error) {
+	base := &Selection{Stops: cfg.GetStops(), Reason: "there is no schedule"}
+	sched := cfg.GetSchedule()
+	if sched == nil {
+		return base, nil
+	}
+	loc, err := location(sched)
+	if err != nil {
+		base.Reason = "the schedule is invalid"
+		return base, err
+	}
+	t = t.In(loc)
+
+	for i, rule := range sched.GetRules() {
+		if !matches(rule, t) {
+			continue
+		}
+		p := findProfile(cfg, rule.GetProfile())
+		if p == nil {
+			base.Reason = "the schedule is invalid"
+			return base, fmt.Errorf("rule %d: no profile named %q", i+1, rule.GetProfile())
+		}
+		return &Selection{
+			Profile: p.GetName(),
+			Stops:   profileStops(cfg, p),
+			Routes:  p.GetRoutes(),
+			Reason:  fmt.Sprintf("it is %s, which is within %s", t.Format("Mon 15:04 MST"), DescribeRule(rule)),
+		}, nil
+	}
+
+	reason := fmt.Sprintf("it is %s, when no rule applies", t.Format("Mon 15:04 MST"))
+	if sched.GetDefaultProfile() == "" {
+		base.Reason = reason
+		return base, nil
+	}
+	p := findProfile(cfg, sched.GetDefaultProfile())
+	if p == nil {
+		base.Reason = "the schedule is invalid"
+		return base, fmt.Errorf("no default profile named %q", sched.GetDefaultProfile())
+	}
+	return &Selection{
+		Profile: p.GetName(),
+		Stops:   profileStops(cfg, p),
+		Routes:  p.GetRoutes(),
+		Reason:  reason + " and it is the default",
+	}, nil
+}
+
+// Validate checks that the stops, profiles, schedule and quiet hours of a
+// configuration make sense: stop ids and profile names are unique, colors are
+// within range, every rule names an existing profile and a valid time of the
+// week, and quiet hours start and end at valid times.
+func Validate(cfg *pb.Configuration) error {
+	ids := make(map[string]bool)
+	for _, stop := range cfg.GetStops() {
+		if strings.TrimSpace(stop.GetId()) == "" {
+			return errors.New("stops must have an id")
+		}
+		if ids[stop.GetId()] {
+			return fmt.Errorf("stop %s is listed more than once", stop.GetId())
+		}
+		ids[stop.GetId()] = true
+		if stop.GetWalkingMinutes() < 0 {
+			return fmt.Errorf("stop %s: walking time must not be negative", stop.GetId())
+		}
+		if err := ValidateColor(stop.GetColor()); err != nil {
+			return fmt.Errorf("stop %s: %v", stop.GetId(), err)
+		}
+	}
+	if err := ValidateColor(cfg.GetOverride().GetColor()); err != nil {
+		return fmt.Errorf("override: %v", err)
+	}
+	if q := cfg.GetQuietHours(); q != nil {
+		if err := validateQuietHours(q); err != nil {
+			return fmt.Errorf("quiet hours: %v", err)
+		}
+	}
+
+	names := make(map[string]bool)
+	for _, p := range cfg.GetProfiles() {
+		if strings.TrimSpace(p.GetName()) == "" {
+			return errors.New("profiles must have a name")
+		}
+		if names[p.GetName()] {
+			return fmt.Errorf("more than one profile is named %q", p.GetName())
+		}
+		names[p.GetName()] = true
+	}
+
+	sched := cfg.GetSchedule()
+	if sched == nil {
+		return nil
+	}
+	if _, err := location(sched); err != nil {
+		return err
+	}
+	if d := sched.GetDefaultProfile(); d != "" && !names[d] {
+		return fmt.Errorf("no default profile named %q", d)
+	}
+	for i, rule := range sched.GetRules() {
+		if !names[rule.GetProfile()] {
+			return fmt.Errorf("rule %d: no profile named %q", i+1, rule.GetProfile())
+		}
+		for _, d := range rule.GetDays() {
+			if d < 0 || d > 6 {
+				return fmt.Errorf("rule %d: invalid day %d", i+1, d)
+			}
+		}
+		if rule.GetStartMinute() < 0 || rule.GetEndMinute() > minutesPerDay || rule.GetStartMinute() >= rule.GetEndMinute() {
+			return fmt.Errorf("rule %d: must end after it starts, within the same day", i+1)
+		}
+	}
+	return nil
+}
+
+func location(sched *pb.Schedule) (*time.Location, error) {
+	loc, err := time.LoadLocation(sched.GetTimeZone())
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %q", sched.GetTimeZone())
+	}
+	return loc, nil
+}
+
+// profileStops returns the stops of a profile, with the display settings of
+// the matching stops of the configuration.
+func profileStops(cfg *pb.Configuration, p *pb.Profile) []*pb.Stop {
+	var stops []*pb.Stop
+	for _, id := range p.GetStopIds() {
+		stop := &pb.Stop{Id: id}
+		for _, s := range cfg.GetStops() {
+			if s.GetId() == id {
+				stop = s
+				break
+			}
+		}
+		stops = append(stops, stop)
+	}
+	return stops
+}
+
+func findProfile(cfg *pb.Configuration, name string) *pb.Profile {
+	for _, p := range cfg.GetProfiles() {
+		if p.GetName() == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// matches reports whether t, in the schedule's time zone, is within the rule.
+func matches(rule *pb.ScheduleRule, t time.Time) bool {
+	if days := rule.GetDays(); len(days) > 0 {
+		found := false
+		for _, d := range days {
+			if time.Weekday(d) == t.Weekday() {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	m := int32(t.Hour()*60 + t.Minute())
+	return m >= rule.GetStartMinute() && m < rule.GetEndMinute()
+}
+
+// DescribeRule describes when a rule applies, such as "Mon-Fri 07:00-10:00".
+func DescribeRule(rule *pb.ScheduleRule) string {
+	days := FormatDays(rule.GetDays())
+	if days == "" {
+		days = "every day"
+	}
+	return fmt.Sprintf("%s %s-%s", days, FormatMinute(rule.GetStartMinute()), FormatMinute(rule.GetEndMinute()))
+}
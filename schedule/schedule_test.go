@@ -0,0 +1,287 @@
+package schedule
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/wallaceicy06/muni-sign/proto"
+)
+
+var testConfig = &pb.Configuration{
+	Agency: "sf-muni",
+	Stops:  []*pb.Stop{{Id: "1234"}, {Id: "5678", Nickname: "Work", Routes: []string{"N", "J"}}},
+	Profiles: []*pb.Profile{
+		{Name: "Inbound", StopIds: []string{"5678"}, Routes: []string{"N"}},
+		{Name: "Outbound", StopIds: []string{"9012"}},
+		{Name: "Park", StopIds: []string{"3456"}},
+	},
+	Schedule: &pb.Schedule{
+		TimeZone: "America/Los_Angeles",
+		Rules: []*pb.ScheduleRule{
+			{Profile: "Inbound", Days: []int32{1, 2, 3, 4, 5}, StartMinute: 7 * 60, EndMinute: 10 * 60},
+			{Profile: "Outbound", Days: []int32{1, 2, 3, 4, 5}, StartMinute: 16 * 60, EndMinute: 19 * 60},
+			{Profile: "Park", Days: []int32{0, 6}, StartMinute: 0, EndMinute: 24 * 60},
+		},
+	},
+}
+
+func TestSelect(t *testing.T) {
+	la, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Fatalf("time.LoadLocation() = _, %v want _, <nil>", err)
+	}
+
+	tests := []struct {
+		name        string
+		cfg         *pb.Configuration
+		time        time.Time
+		wantProfile string
+		wantStops   []string
+		wantReason  string
+	}{
+		{
+			name:       "NoSchedule",
+			cfg:        &pb.Configuration{Stops: []*pb.Stop{{Id: "1234"}}},
+			time:       time.Date(2017, 7, 11, 8, 0, 0, 0, la),
+			wantStops:  []string{"1234"},
+			wantReason: "there is no schedule",
+		},
+		{
+			name:        "WeekdayMorning",
+			cfg:         testConfig,
+			time:        time.Date(2017, 7, 11, 8, 0, 0, 0, la),
+			wantProfile: "Inbound",
+			wantStops:   []string{"5678"},
+			wantReason:  "Tue 08:00 PDT, which is within Mon-Fri 07:00-10:00",
+		},
+		{
+			// The rules are in Los Angeles time, whatever the time zone of
+			// the time they are applied to.
+			name:        "OtherTimeZone",
+			cfg:         testConfig,
+			time:        time.Date(2017, 7, 11, 23, 30, 0, 0, time.UTC),
+			wantProfile: "Outbound",
+			wantStops:   []string{"9012"},
+		},
+		{
+			name:        "RuleEndIsExclusive",
+			cfg:         testConfig,
+			time:        time.Date(2017, 7, 11, 10, 0, 0, 0, la),
+			wantStops:   []string{"1234", "5678"},
+			wantReason:  "when no rule applies",
+			wantProfile: "",
+		},
+		{
+			name:        "Weekend",
+			cfg:         testConfig,
+			time:        time.Date(2017, 7, 15, 8, 0, 0, 0, la),
+			wantProfile: "Park",
+			wantStops:   []string{"3456"},
+			wantReason:  "Sun Sat 00:00-24:00",
+		},
+		{
+			name: "DefaultProfile",
+			cfg: &pb.Configuration{
+				Stops:    []*pb.Stop{{Id: "1234"}},
+				Profiles: testConfig.Profiles,
+				Schedule: &pb.Schedule{DefaultProfile: "Park"},
+			},
+			time:        time.Date(2017, 7, 11, 8, 0, 0, 0, time.UTC),
+			wantProfile: "Park",
+			wantStops:   []string{"3456"},
+			wantReason:  "Tue 08:00 UTC, when no rule applies and it is the default",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := Select(test.cfg, test.time)
+			if err != nil {
+				t.Fatalf("Select() = _, %v want _, <nil>", err)
+			}
+			if got.Profile != test.wantProfile || !reflect.DeepEqual(stopIDs(got.Stops), test.wantStops) {
+				t.Errorf("Select() = %+v want profile %q and stops %v", got, test.wantProfile, test.wantStops)
+			}
+			if !strings.Contains(got.Reason, test.wantReason) {
+				t.Errorf("Select().Reason = %q want it to contain %q", got.Reason, test.wantReason)
+			}
+		})
+	}
+}
+
+func TestSelectInvalid(t *testing.T) {
+	cfg := &pb.Configuration{
+		Stops:    []*pb.Stop{{Id: "1234"}},
+		Schedule: &pb.Schedule{TimeZone: "Mars/Olympus_Mons"},
+	}
+	got, err := Select(cfg, time.Now())
+	if err == nil {
+		t.Errorf("Select() = _, <nil> want _, <non-nil>")
+	}
+	if got.Profile != "" || !reflect.DeepEqual(stopIDs(got.Stops), []string{"1234"}) {
+		t.Errorf("Select() = %+v want the configuration's own stops", got)
+	}
+}
+
+func TestSelectProfileStopSettings(t *testing.T) {
+	// Stops of a profile that are also stops of the configuration keep their
+	// settings.
+	la, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Fatalf("time.LoadLocation() = _, %v want _, <nil>", err)
+	}
+	got, err := Select(testConfig, time.Date(2017, 7, 11, 8, 0, 0, 0, la))
+	if err != nil {
+		t.Fatalf("Select() = _, %v want _, <nil>", err)
+	}
+	if len(got.Stops) != 1 || got.Stops[0].GetNickname() != "Work" {
+		t.Errorf("Select().Stops = %v want the stop nicknamed Work", got.Stops)
+	}
+}
+
+func TestShows(t *testing.T) {
+	tests := []struct {
+		name  string
+		sel   *Selection
+		stop  *pb.Stop
+		route string
+		want  bool
+	}{
+		{name: "NoRoutes", sel: &Selection{}, stop: &pb.Stop{}, route: "N", want: true},
+		{name: "ProfileRoute", sel: &Selection{Routes: []string{"N", "J"}}, stop: &pb.Stop{}, route: "J", want: true},
+		{name: "OtherProfileRoute", sel: &Selection{Routes: []string{"N", "J"}}, stop: &pb.Stop{}, route: "KT"},
+		{name: "StopRoute", sel: &Selection{}, stop: &pb.Stop{Routes: []string{"N"}}, route: "N", want: true},
+		{name: "OtherStopRoute", sel: &Selection{}, stop: &pb.Stop{Routes: []string{"N"}}, route: "J"},
+		{name: "Both", sel: &Selection{Routes: []string{"N", "J"}}, stop: &pb.Stop{Routes: []string{"J"}}, route: "J", want: true},
+		{name: "OnlyProfile", sel: &Selection{Routes: []string{"N", "J"}}, stop: &pb.Stop{Routes: []string{"J"}}, route: "N"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.sel.Shows(test.stop, test.route); got != test.want {
+				t.Errorf("Shows(%v, %q) = %t want %t", test.stop, test.route, got, test.want)
+			}
+		})
+	}
+}
+
+func stopIDs(stops []*pb.Stop) []string {
+	var ids []string
+	for _, s := range stops {
+		ids = append(ids, s.GetId())
+	}
+	return ids
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     *pb.Configuration
+		wantErr bool
+	}{
+		{
+			name: "Good",
+			cfg:  testConfig,
+		},
+		{
+			name: "Empty",
+			cfg:  &pb.Configuration{},
+		},
+		{
+			name:    "StopWithoutID",
+			cfg:     &pb.Configuration{Stops: []*pb.Stop{{Nickname: "Home"}}},
+			wantErr: true,
+		},
+		{
+			name:    "DuplicateStop",
+			cfg:     &pb.Configuration{Stops: []*pb.Stop{{Id: "1234"}, {Id: "1234"}}},
+			wantErr: true,
+		},
+		{
+			name:    "NegativeWalkingTime",
+			cfg:     &pb.Configuration{Stops: []*pb.Stop{{Id: "1234", WalkingMinutes: -1}}},
+			wantErr: true,
+		},
+		{
+			name:    "StopColorOutOfRange",
+			cfg:     &pb.Configuration{Stops: []*pb.Stop{{Id: "1234", Color: &pb.Color{Red: 255}}}},
+			wantErr: true,
+		},
+		{
+			name:    "OverrideColorOutOfRange",
+			cfg:     &pb.Configuration{Override: &pb.MessageOverride{Text: "Hello", Color: &pb.Color{Blue: -1}}},
+			wantErr: true,
+		},
+		{
+			name:    "UnnamedProfile",
+			cfg:     &pb.Configuration{Profiles: []*pb.Profile{{Name: " "}}},
+			wantErr: true,
+		},
+		{
+			name:    "DuplicateProfile",
+			cfg:     &pb.Configuration{Profiles: []*pb.Profile{{Name: "Inbound"}, {Name: "Inbound"}}},
+			wantErr: true,
+		},
+		{
+			name:    "UnknownTimeZone",
+			cfg:     &pb.Configuration{Schedule: &pb.Schedule{TimeZone: "Mars/Olympus_Mons"}},
+			wantErr: true,
+		},
+		{
+			name:    "UnknownDefaultProfile",
+			cfg:     &pb.Configuration{Schedule: &pb.Schedule{DefaultProfile: "Inbound"}},
+			wantErr: true,
+		},
+		{
+			name: "UnknownRuleProfile",
+			cfg: &pb.Configuration{Schedule: &pb.Schedule{Rules: []*pb.ScheduleRule{
+				{Profile: "Inbound", StartMinute: 0, EndMinute: 60},
+			}}},
+			wantErr: true,
+		},
+		{
+			name: "InvalidDay",
+			cfg: &pb.Configuration{
+				Profiles: []*pb.Profile{{Name: "Inbound"}},
+				Schedule: &pb.Schedule{Rules: []*pb.ScheduleRule{
+					{Profile: "Inbound", Days: []int32{7}, StartMinute: 0, EndMinute: 60},
+				}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "EndBeforeStart",
+			cfg: &pb.Configuration{
+				Profiles: []*pb.Profile{{Name: "Inbound"}},
+				Schedule: &pb.Schedule{Rules: []*pb.ScheduleRule{
+					{Profile: "Inbound", StartMinute: 22 * 60, EndMinute: 2 * 60},
+				}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "PastMidnight",
+			cfg: &pb.Configuration{
+				Profiles: []*pb.Profile{{Name: "Inbound"}},
+				Schedule: &pb.Schedule{Rules: []*pb.ScheduleRule{
+					{Profile: "Inbound", StartMinute: 22 * 60, EndMinute: 25 * 60},
+				}},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := Validate(test.cfg)
+			if test.wantErr && err == nil {
+				t.Errorf("Validate() = <nil> want <non-nil>")
+			}
+			if !test.wantErr && err != nil {
+				t.Errorf("Validate() = %v want <nil>", err)
+			}
+		})
+	}
+}
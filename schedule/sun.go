@@ -0,0 +1,61 @@
+package schedule
+
+import (
+	"math"
+	"time"
+)
+
+// The Julian date of the Unix epoch and of J2000, the epoch of the sunrise
+// equation.
+const (
+	julianUnixEpoch = 2440587.5
+	julianJ2000     = 2451545.0
+)
+
+// SunriseSunset computes when the sun rises and sets on the given day at a
+// location, in degrees with north and east being positive, using the sunrise
+// equation. The day is the calendar date of the given time, and the result is
+// accurate to within a couple of minutes. It reports false if the sun does not
+// rise or set that day, as happens near the poles.
+func SunriseSunset(day time.Time, latitude, longitude float64) (sunrise, sunset time.Time, ok bool) {
+	noon := time.Date(day.Year(), day.Month(), day.Day(), 12, 0, 0, 0, time.UTC)
+	n := math.Round(toJulian(noon) - julianJ2000 + 0.0008)
+
+	// Mean solar noon, solar mean anomaly, equation of the center and
+	// ecliptic longitude.
+	meanNoon := n - longitude/360
+	m := math.Mod(357.5291+0.98560028*meanNoon, 360)
+	c := 1.9148*sin(m) + 0.0200*sin(2*m) + 0.0003*sin(3*m)
+	lambda := math.Mod(m+c+180+102.9372, 360)
+
+	transit := julianJ2000 + meanNoon + 0.0053*sin(m) - 0.0069*sin(2*lambda)
+	declination := math.Asin(sin(lambda) * sin(23.4397))
+
+	// The hour angle at which the upper limb of the sun touches the horizon,
+	// allowing for refraction.
+	cosHourAngle := (sin(-0.833) - sin(latitude)*math.Sin(declination)) / (cos(latitude) * math.Cos(declination))
+	if cosHourAngle < -1 || cosHourAngle > 1 {
+		return time.Time{}, time.Time{}, false
+	}
+	hourAngle := math.Acos(cosHourAngle) * 180 / math.Pi
+
+	sunrise = fromJulian(transit - hourAngle/360).In(day.Location())
+	sunset = fromJulian(transit + hourAngle/360).In(day.Location())
+	return sunrise, sunset, true
+}
+
+func sin(degrees float64) float64 {
+	return math.Sin(degrees * math.Pi / 180)
+}
+
+func cos(degrees float64) float64 {
+	return math.Cos(degrees * math.Pi / 180)
+}
+
+func toJulian(t time.Time) float64 {
+	return float64(t.Unix())/86400 + julianUnixEpoch
+}
+
+func fromJulian(j float64) time.Time {
+	return time.Unix(int64(math.Round((j-julianUnixEpoch)*86400)), 0)
+}
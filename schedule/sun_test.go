@@ -0,0 +1,75 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSunriseSunset(t *testing.T) {
+	la, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Fatalf("time.LoadLocation() = _, %v want _, <nil>", err)
+	}
+	oslo, err := time.LoadLocation("Europe/Oslo")
+	if err != nil {
+		t.Fatalf("time.LoadLocation() = _, %v want _, <nil>", err)
+	}
+
+	tests := []struct {
+		name        string
+		day         time.Time
+		lat, lon    float64
+		wantSunrise time.Time
+		wantSunset  time.Time
+	}{
+		{
+			name:        "SanFranciscoSummer",
+			day:         time.Date(2017, 6, 21, 0, 0, 0, 0, la),
+			lat:         37.7749,
+			lon:         -122.4194,
+			wantSunrise: time.Date(2017, 6, 21, 5, 48, 0, 0, la),
+			wantSunset:  time.Date(2017, 6, 21, 20, 35, 0, 0, la),
+		},
+		{
+			name:        "SanFranciscoWinter",
+			day:         time.Date(2017, 12, 21, 0, 0, 0, 0, la),
+			lat:         37.7749,
+			lon:         -122.4194,
+			wantSunrise: time.Date(2017, 12, 21, 7, 21, 0, 0, la),
+			wantSunset:  time.Date(2017, 12, 21, 16, 54, 0, 0, la),
+		},
+		{
+			name:        "Oslo",
+			day:         time.Date(2017, 3, 20, 0, 0, 0, 0, oslo),
+			lat:         59.9139,
+			lon:         10.7522,
+			wantSunrise: time.Date(2017, 3, 20, 6, 18, 0, 0, oslo),
+			wantSunset:  time.Date(2017, 3, 20, 18, 30, 0, 0, oslo),
+		},
+	}
+
+	near := func(a, b time.Time) bool {
+		d := a.Sub(b)
+		return d > -3*time.Minute && d < 3*time.Minute
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sunrise, sunset, ok := SunriseSunset(test.day, test.lat, test.lon)
+			if !ok || !near(sunrise, test.wantSunrise) || !near(sunset, test.wantSunset) {
+				t.Errorf("SunriseSunset(%v, %v, %v) = %v, %v, %t want %v, %v, true", test.day, test.lat, test.lon, sunrise, sunset, ok, test.wantSunrise, test.wantSunset)
+			}
+		})
+	}
+}
+
+func TestSunriseSunsetPolar(t *testing.T) {
+	// The sun neither rises nor sets during the polar summer or winter.
+	for _, day := range []time.Time{
+		time.Date(2017, 6, 21, 0, 0, 0, 0, time.UTC),
+		time.Date(2017, 12, 21, 0, 0, 0, 0, time.UTC),
+	} {
+		if _, _, ok := SunriseSunset(day, 78.2232, 15.6267); ok {
+			t.Errorf("SunriseSunset(%v, 78.2232, 15.6267) = _, _, true want _, _, false", day)
+		}
+	}
+}